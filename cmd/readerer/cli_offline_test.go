@@ -37,6 +37,31 @@ func TestExeSuffixFor(t *testing.T) {
 	}
 }
 
+// buildCLI builds the readerer binary into dir and returns its path.
+func buildCLI(t *testing.T, dir string) string {
+	t.Helper()
+	// Ensure the binary name includes the OS executable suffix (e.g., .exe on Windows)
+	exeSuffix := ""
+	if runtime.GOOS == "windows" {
+		exeSuffix = ".exe"
+	}
+	bin := filepath.Join(dir, "readerer"+exeSuffix)
+
+	// Build the CLI binary with a cancellable context so a stuck toolchain doesn't hang the test.
+	buildCtx, buildCancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer buildCancel()
+	build := exec.CommandContext(buildCtx, "go", "build", "-o", bin, "github.com/japaniel/readerer/cmd/readerer")
+	build.Stdout = os.Stdout
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		if buildCtx.Err() == context.DeadlineExceeded {
+			t.Fatalf("go build timed out")
+		}
+		t.Fatalf("failed to build CLI: %v", err)
+	}
+	return bin
+}
+
 func TestCLI_OfflineServer(t *testing.T) {
 	tmp := t.TempDir()
 
@@ -67,30 +92,12 @@ func TestCLI_OfflineServer(t *testing.T) {
 
 	// Paths for binary and DB
 	dbPath := filepath.Join(tmp, "readerer.db")
-	// Ensure the binary name includes the OS executable suffix (e.g., .exe on Windows)
-	exeSuffix := ""
-	if runtime.GOOS == "windows" {
-		exeSuffix = ".exe"
-	}
-	bin := filepath.Join(tmp, "readerer"+exeSuffix)
-
-	// Build the CLI binary with a cancellable context so a stuck toolchain doesn't hang the test.
-	buildCtx, buildCancel := context.WithTimeout(context.Background(), 15*time.Second)
-	defer buildCancel()
-	build := exec.CommandContext(buildCtx, "go", "build", "-o", bin, "github.com/japaniel/readerer/cmd/readerer")
-	build.Stdout = os.Stdout
-	build.Stderr = os.Stderr
-	if err := build.Run(); err != nil {
-		if buildCtx.Err() == context.DeadlineExceeded {
-			t.Fatalf("go build timed out")
-		}
-		t.Fatalf("failed to build CLI: %v", err)
-	}
+	bin := buildCLI(t, tmp)
 
-	// Run the CLI against the test server; run with working dir = tmp so dictionary file is present
+	// Run the CLI against the test server; point -dict-dir at tmp so the dictionary file is present
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
 	defer cancel()
-	cmd := exec.CommandContext(ctx, bin, "-url", srv.URL, "-db", dbPath)
+	cmd := exec.CommandContext(ctx, bin, "-url", srv.URL, "-db", dbPath, "-dict-dir", tmp)
 	cmd.Dir = tmp
 	out, err := cmd.CombinedOutput()
 	if ctx.Err() == context.DeadlineExceeded {
@@ -120,3 +127,150 @@ func TestCLI_OfflineServer(t *testing.T) {
 		t.Fatalf("expected at least one source in DB, found 0")
 	}
 }
+
+func TestCLI_Profiles(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "jmdict-eng-common.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("failed to write dict placeholder: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body><article><p>猫が好きです。犬も好きです。毎日散歩に行きます。</p></article></body></html>"))
+	}))
+	defer srv.Close()
+
+	bin := buildCLI(t, tmp)
+	cpuProfile := filepath.Join(tmp, "cpu.pprof")
+	memProfile := filepath.Join(tmp, "mem.pprof")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "-url", srv.URL, "-db", filepath.Join(tmp, "readerer.db"), "-dict-dir", tmp,
+		"-cpuprofile", cpuProfile, "-memprofile", memProfile)
+	cmd.Dir = tmp
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("cli failed: %v\noutput:\n%s", err, out)
+	}
+
+	for _, p := range []string{cpuProfile, memProfile} {
+		if fi, err := os.Stat(p); err != nil || fi.Size() == 0 {
+			t.Errorf("expected non-empty profile at %s (err=%v)", p, err)
+		}
+	}
+}
+
+func TestCLI_SecondRunFailsWhileDatabaseLocked(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "jmdict-eng-common.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("failed to write dict placeholder: %v", err)
+	}
+
+	// The first run blocks inside the fetch (holding the DB lock) until we release it.
+	fetched := make(chan struct{}, 1)
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched <- struct{}{}
+		<-unblock
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte("<html><body><article><p>猫が好きです。犬も好きです。毎日散歩に行きます。</p></article></body></html>"))
+	}))
+	defer srv.Close()
+	defer func() {
+		select {
+		case <-unblock:
+		default:
+			close(unblock)
+		}
+	}()
+
+	dbPath := filepath.Join(tmp, "readerer.db")
+	bin := buildCLI(t, tmp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	first := exec.CommandContext(ctx, bin, "-url", srv.URL, "-db", dbPath, "-dict-dir", tmp)
+	first.Dir = tmp
+	if err := first.Start(); err != nil {
+		t.Fatalf("failed to start first run: %v", err)
+	}
+	select {
+	case <-fetched:
+	case <-ctx.Done():
+		t.Fatal("first run never fetched the page")
+	}
+
+	second := exec.CommandContext(ctx, bin, "-url", srv.URL, "-db", dbPath, "-dict-dir", tmp)
+	second.Dir = tmp
+	out, err := second.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected second run to fail while the database is locked, output:\n%s", out)
+	}
+	if !strings.Contains(string(out), "database in use") {
+		t.Fatalf("expected a database-in-use error, got:\n%s", out)
+	}
+
+	close(unblock)
+	if err := first.Wait(); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+}
+
+func TestCLI_BatchSkipsFailingURLs(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmp, "jmdict-eng-common.json"), []byte("[]"), 0644); err != nil {
+		t.Fatalf("failed to write dict placeholder: %v", err)
+	}
+
+	body, err := os.ReadFile(filepath.Join("..", "..", "pkg", "readerer", "testdata", "mainichi_article.html"))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(body)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	urlList := filepath.Join(tmp, "urls.txt")
+	if err := os.WriteFile(urlList, []byte("# reading list\n"+srv.URL+"/broken\n\n"+srv.URL+"/ok\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := filepath.Join(tmp, "readerer.db")
+	bin := buildCLI(t, tmp)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin, "-urls", urlList, "-db", dbPath, "-dict-dir", tmp)
+	cmd.Dir = tmp
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected non-zero exit when a URL fails, output:\n%s", out)
+	}
+	outStr := string(out)
+	if !strings.Contains(outStr, "Skipping "+srv.URL+"/broken") {
+		t.Fatalf("expected the broken URL to be skipped, got:\n%s", outStr)
+	}
+	if !strings.Contains(outStr, "Batch complete: 1 of 2 URLs processed, 1 failed.") {
+		t.Fatalf("expected batch summary, got:\n%s", outStr)
+	}
+
+	dbConn, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer dbConn.Close()
+	var cnt int
+	if err := dbConn.QueryRow("SELECT COUNT(*) FROM sources WHERE url = ?", srv.URL+"/ok").Scan(&cnt); err != nil {
+		t.Fatalf("db query failed: %v", err)
+	}
+	if cnt != 1 {
+		t.Fatalf("expected the good URL to be ingested after the failure, found %d sources\noutput:\n%s", cnt, outStr)
+	}
+}
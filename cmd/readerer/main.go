@@ -1,23 +1,29 @@
 package main
 
 import (
-	"bytes"
+	"bufio"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/pprof"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/go-shiori/go-readability"
 	"github.com/japaniel/readerer/pkg/db"
 	"github.com/japaniel/readerer/pkg/dictionary"
+	"github.com/japaniel/readerer/pkg/export"
+	"github.com/japaniel/readerer/pkg/fetch"
 	"github.com/japaniel/readerer/pkg/ingest"
 	"github.com/japaniel/readerer/pkg/readerer"
 
@@ -26,16 +32,118 @@ import (
 
 func main() {
 	urlFlag := flag.String("url", "", "URL to process")
+	urlsFlag := flag.String("urls", "", "File with URLs to process, one per line (blank lines and # comments ignored); failing URLs are skipped")
+	retryFailedFlag := flag.Bool("retry-failed", false, "Process again every URL whose last attempt failed")
 	dbFlag := flag.String("db", "readerer.db", "Path to SQLite database")
 	dictFlag := flag.String("import-dict", "", "Path to JMdict-Simplified JSON file to import definitions")
+	glossLangFlag := flag.String("gloss-lang", dictionary.DefaultGlossLang, "JMdict gloss language to download and keep (e.g. eng, ger, fre, rus)")
+	sinceDictFlag := flag.String("since-dict", "", "With -import-dict, only list stored words whose definitions differ from this older dictionary file; writes nothing")
+	minOccFlag := flag.Int("min-occurrences", 0, "With -import-dict or -fill-definitions, only look up definitions for words seen at least this many times (ingestion still looks up every word)")
+	dictDirFlag := flag.String("dict-dir", dictionary.DefaultDictDir(), "Directory where the JMdict dictionary is cached and downloaded")
+	minContentFlag := flag.Int("min-content-runes", fetch.DefaultMinContentRunes, "Skip ingestion when the extracted article has fewer non-space characters than this (0 disables)")
+	fillDefsFlag := flag.Bool("fill-definitions", false, "Download/load the cached dictionary and fill in definitions for words already in the database, then exit")
+	refreshDictFlag := flag.Bool("refresh-dict", false, "Download a fresh copy of the dictionary, replacing the cached one once it is valid (use if the cached file is corrupt)")
+	cacheOnlyFlag := flag.Bool("definitions-from-cache-only", false, "Only reuse definitions already stored in the database; never load the JMdict file")
+	flattenDefsFlag := flag.Bool("flatten-definitions", false, "Store definitions as numbered plain-text lines (\"1. dog (n)\") instead of JSON")
+	canonicalizeKanaFlag := flag.Bool("canonicalize-kana", false, "Store kana-only words under their kanji headword when the dictionary has a single confident match")
+	readingStyleFlag := flag.String("reading-style", "hiragana", "Script for stored readings: hiragana, katakana or as-is")
+	forceFlag := flag.Bool("force", false, "Skip the database lock check (only if you are sure no other readerer process is using -db)")
+	tokenizerModeFlag := flag.String("tokenizer-mode", "normal", "Kagome segmentation mode: normal, search (split long compounds) or extended")
+	cpuProfileFlag := flag.String("cpuprofile", "", "Write a CPU profile of the analyze and ingest phase to this file")
+	memProfileFlag := flag.String("memprofile", "", "Write a heap profile to this file after the analyze and ingest phase")
+	maxSentencesFlag := flag.Int("max-sentences-per-source", 0, "Stop storing new context sentences for a source after this many (words are still counted; 0 = no limit)")
+	boilerplateFlag := flag.Int("boilerplate-repeats", 0, "Count a sentence's words only once when its exact text repeats at least this many times in a page (0 = off)")
+	unmatchedOutFlag := flag.String("unmatched-out", "", "Append words the dictionary could not define to this file, one per line, for review")
+	followPagesFlag := flag.Int("follow-pages", 0, "Follow up to this many rel=next links from each page and ingest the pages as one article")
+	reingestFlag := flag.Bool("reingest", false, "Ingest a page again even if its extracted text is unchanged since the last run")
+	langFlag := flag.String("lang", "", "Language code recorded for each ingested source and its words (e.g. ja, en); new sources default to "+db.DefaultLanguage+" and existing ones keep theirs")
+	metaFlag := flag.String("meta", "", `JSON metadata to store with the source, e.g. '{"series":"NHK Easy","difficulty":2}'`)
+	pruneFlag := flag.Int("prune", 0, "Delete words seen fewer than this many times across all sources, then exit")
+	maintenanceDryRunFlag := flag.Bool("maintenance-dry-run", false, "With -prune, only report what would be deleted; the database is left unchanged")
+	verifyLinksFlag := flag.Bool("verify-links", false, "Check that word_sources rows point at existing sentences and have non-negative counts, print any problems, then exit")
+	topFlag := flag.Int("top", 0, "Print the n most frequent words across all sources as a table, then exit")
+	noDefsFlag := flag.Bool("no-definitions", false, "With -top, omit the meaning column")
+	exportCSVFlag := flag.String("export-csv", "", "Write the words (of -csv-source, or all sources) to this CSV file, then exit")
+	csvColumnsFlag := flag.String("csv-columns", strings.Join(export.CSVColumns, ","), "Comma-separated -export-csv columns")
+	csvSourceFlag := flag.Int64("csv-source", 0, "With -export-csv, only export words from this source ID")
+	dumpFlag := flag.String("dump", "", "Write sources, words and links to this file as one JSON document, then exit")
+	restoreFlag := flag.String("restore", "", "Load a -dump file into the (empty) database, then exit")
+	reportFlag := flag.Int64("report", 0, "Print a vocabulary report for the given source ID instead of ingesting")
+	jsonStreamFlag := flag.Bool("json-stream", false, "With -url, print the analyzed sentences to stdout as newline-delimited JSON instead of ingesting")
+	moraeFlag := flag.Bool("morae", false, "With -json-stream, add each token's reading split into morae")
+	jsonSchemaFlag := flag.Bool("json-schema", false, "Print the JSON Schema of a -json-stream line, then exit")
+	formatFlag := flag.String("format", "markdown", "Report format (supported: markdown)")
+	outFlag := flag.String("out", "", "Write the report to this file instead of stdout")
 	flag.Parse()
 
+	if *jsonSchemaFlag {
+		schema, err := export.SentenceSchema()
+		if err != nil {
+			log.Fatalf("Failed to build schema: %v", err)
+		}
+		fmt.Println(string(schema))
+		return
+	}
+
+	var formatter dictionary.DefinitionFormatter // nil stores JSON
+	if *flattenDefsFlag {
+		formatter = dictionary.PlainTextFormatter{}
+	}
+
+	if !isGlossLang(*glossLangFlag) {
+		log.Fatalf("Invalid -gloss-lang %q: want a three-letter JMdict language code such as eng", *glossLangFlag)
+	}
+	tokenizerMode, err := readerer.ParseTokenizerMode(*tokenizerModeFlag)
+	if err != nil {
+		log.Fatalf("Invalid -tokenizer-mode: %v", err)
+	}
+	if *metaFlag != "" && !json.Valid([]byte(*metaFlag)) {
+		log.Fatalf("Invalid -meta: %q is not valid JSON", *metaFlag)
+	}
+	if *langFlag != "" && strings.TrimSpace(*langFlag) == "" {
+		log.Fatal("Invalid -lang: must not be blank")
+	}
+
 	// Setup context for graceful shutdown
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
+	// JSON streaming only analyzes the page; it never touches the database.
+	if *jsonStreamFlag {
+		if *urlFlag == "" {
+			log.Fatal("-json-stream requires -url")
+		}
+		analyzer, err := readerer.NewAnalyzer()
+		if err != nil {
+			log.Fatalf("Failed to create analyzer: %v", err)
+		}
+		analyzer.Mode = tokenizerMode
+		if *moraeFlag {
+			analyzer.MoraSplitter = dictionary.SplitMorae
+		}
+		extractor := fetch.NewExtractor()
+		extractor.MinContentRunes = *minContentFlag
+		p := &processor{fetcher: fetch.NewFetcher(), extractor: extractor, analyzer: analyzer, followPages: *followPagesFlag, progress: os.Stderr}
+		if err := streamJSON(ctx, os.Stdout, p, *urlFlag); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Make sure no other readerer process is writing to the same database.
+	if !*forceFlag {
+		release, err := db.AcquireLock(*dbFlag)
+		if err != nil {
+			if errors.Is(err, db.ErrDatabaseInUse) {
+				log.Fatalf("%v. Wait for the other run to finish or pass -force to override.", err)
+			}
+			log.Fatalf("Failed to lock database: %v", err)
+		}
+		defer release()
+	}
+
 	// Initialize DB
-	conn, err := sql.Open("sqlite3", *dbFlag)
+	conn, err := db.Open(*dbFlag, db.Options{})
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -55,8 +163,27 @@ func main() {
 		}
 		fmt.Printf("Loaded %d entries. Processing updates...\n", len(entries))
 
-		importer := dictionary.NewImporter(conn, entries)
-		count, err := importer.ProcessUpdates()
+		importer, err := dictionary.NewImporterCtx(ctx, conn, entries)
+		if err != nil {
+			log.Fatalf("Dictionary indexing aborted: %v", err)
+		}
+		importer.MinOccurrencesForDefinition = *minOccFlag
+		importer.GlossLang = *glossLangFlag
+		importer.Formatter = formatter
+		importer.CheckpointScope = dictionaryScope("import-dict", *dictFlag)
+
+		if *sinceDictFlag != "" {
+			if err := printDefinitionDiff(ctx, conn, importer, *sinceDictFlag, *glossLangFlag); err != nil {
+				log.Fatalf("Failed to compare dictionaries: %v", err)
+			}
+			return
+		}
+
+		count, err := importer.ProcessUpdatesCtx(ctx)
+		if errors.Is(err, context.Canceled) {
+			fmt.Printf("Interrupted after updating %d words. Run -import-dict again to resume.\n", count)
+			return
+		}
 		if err != nil {
 			log.Fatalf("Failed to update definitions: %v", err)
 		}
@@ -64,120 +191,400 @@ func main() {
 		return
 	}
 
-	if *urlFlag == "" {
-		log.Fatal("Please provide a -url or -import-dict")
+	// Backfill definitions from the cached dictionary (e.g. after ingesting without one)
+	if *fillDefsFlag {
+		dictPath := dictionary.DictPathForLang(*dictDirFlag, *glossLangFlag)
+		ensure := dictionary.EnsureDictionaryLang
+		if *refreshDictFlag {
+			ensure = dictionary.RefreshDictionaryLang
+		}
+		if err := ensure(ctx, dictPath, *glossLangFlag); err != nil {
+			log.Fatalf("Failed to ensure dictionary at %s: %v", dictPath, err)
+		}
+		count, err := fillDefinitions(ctx, conn, dictPath, *glossLangFlag, *minOccFlag, formatter)
+		if errors.Is(err, context.Canceled) {
+			fmt.Printf("Interrupted after updating %d words. Run -fill-definitions again to resume.\n", count)
+			return
+		}
+		if err != nil {
+			log.Fatalf("Failed to fill definitions: %v", err)
+		}
+		fmt.Printf("Successfully updated definitions for %d words.\n", count)
+		return
 	}
 
-	// Prepare Dictionary for Pipeline (Auto-Download / Cache)
-	// We load it here so we can inject definitions as we ingest words.
-	const dictPath = "jmdict-eng-common.json"
-	if err := dictionary.EnsureDictionary(ctx, dictPath); err != nil {
-		log.Printf("Warning: Failed to ensure dictionary at %s: %v. Continuing without definitions.", dictPath, err)
+	// Handle the word_sources integrity check
+	if *verifyLinksFlag {
+		issues, err := db.VerifyLinks(conn)
+		if err != nil {
+			log.Fatalf("Failed to verify links: %v", err)
+		}
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+		if len(issues) > 0 {
+			log.Fatalf("Found %d link problems.", len(issues))
+		}
+		fmt.Println("All word_sources links are valid.")
+		return
 	}
 
-	var defsImporter *dictionary.Importer
-	// Only load if file exists
-	if _, err := os.Stat(dictPath); err == nil {
-		fmt.Println("Loading dictionary into memory...")
-		start := time.Now()
-		entries, err := dictionary.LoadJMdictSimplified(dictPath)
+	// Handle Pruning (Maintenance)
+	if *pruneFlag > 0 {
+		report, err := db.PruneWordsBelowFrequency(conn, *pruneFlag, *maintenanceDryRunFlag)
 		if err != nil {
-			log.Printf("Warning: Failed to load dictionary: %v", err)
-		} else {
-			defsImporter = dictionary.NewImporter(conn, entries)
-			fmt.Printf("Dictionary loaded (%d entries) in %v\n", len(entries), time.Since(start))
+			log.Fatalf("Failed to prune words: %v", err)
+		}
+		verb := "Pruned"
+		if report.DryRun {
+			verb = "Dry run: would prune"
+		}
+		fmt.Printf("%s %d words seen fewer than %d times (%d links, %d contexts).\n", verb, len(report.WordIDs), *pruneFlag, report.LinksRemoved, report.ContextsRemoved)
+		if report.DryRun && len(report.WordIDs) > 0 {
+			fmt.Printf("Word ids: %v\n", report.WordIDs)
+		}
+		return
+	}
+
+	// Handle the whole-database frequency table
+	if *topFlag > 0 {
+		words, err := db.GetWordFrequencies(conn, 0, *topFlag)
+		if err != nil {
+			log.Fatalf("Failed to load word frequencies: %v", err)
+		}
+		if err := writeTopWords(os.Stdout, words, !*noDefsFlag); err != nil {
+			log.Fatalf("Failed to print word frequencies: %v", err)
+		}
+		return
+	}
+
+	// Handle CSV export
+	if *exportCSVFlag != "" {
+		if err := exportCSV(conn, *csvSourceFlag, *csvColumnsFlag, *exportCSVFlag); err != nil {
+			log.Fatalf("Failed to export CSV: %v", err)
 		}
+		fmt.Printf("Wrote %s.\n", *exportCSVFlag)
+		return
+	}
+
+	// Handle JSON backup and restore
+	if *dumpFlag != "" {
+		if err := dumpDatabase(conn, *dumpFlag); err != nil {
+			log.Fatalf("Failed to dump database: %v", err)
+		}
+		fmt.Printf("Wrote %s.\n", *dumpFlag)
+		return
+	}
+	if *restoreFlag != "" {
+		if err := restoreDatabase(conn, *restoreFlag); err != nil {
+			log.Fatalf("Failed to restore database: %v", err)
+		}
+		fmt.Printf("Restored %s.\n", *restoreFlag)
+		return
+	}
+
+	// Handle Report Generation
+	if *reportFlag != 0 {
+		if err := writeReport(conn, *reportFlag, *formatFlag, *outFlag); err != nil {
+			log.Fatalf("Failed to write report: %v", err)
+		}
+		return
+	}
+
+	if *urlFlag == "" && *urlsFlag == "" && !*retryFailedFlag {
+		log.Fatal("Please provide a -url, -urls, -retry-failed, -import-dict, -fill-definitions, -prune, -top, -export-csv, -dump, -restore or -report")
+	}
+
+	// Prepare Dictionary for Pipeline (Auto-Download / Cache)
+	// We load it here so we can inject definitions as we ingest words.
+	var defsImporter *dictionary.Importer
+	if *cacheOnlyFlag {
+		fmt.Println("Using cached definitions only; skipping dictionary load.")
 	} else {
-		fmt.Println("Skipping dictionary load (file missing). Definitions will be empty.")
+		dictPath := dictionary.DictPathForLang(*dictDirFlag, *glossLangFlag)
+		ensure := dictionary.EnsureDictionaryLang
+		if *refreshDictFlag {
+			fmt.Printf("Refreshing dictionary at %s...\n", dictPath)
+			ensure = dictionary.RefreshDictionaryLang
+		}
+		if err := ensure(ctx, dictPath, *glossLangFlag); err != nil {
+			log.Printf("Warning: Failed to ensure dictionary at %s: %v. Continuing without definitions.", dictPath, err)
+		}
+
+		// Only load if file exists
+		if _, err := os.Stat(dictPath); err == nil {
+			fmt.Println("Loading dictionary into memory...")
+			start := time.Now()
+			entries, err := dictionary.LoadJMdictSimplified(dictPath)
+			if errors.Is(err, dictionary.ErrDictionaryEmpty) {
+				log.Printf("Warning: %v. Continuing without definitions.", err)
+			} else if err != nil {
+				log.Printf("Warning: Failed to load dictionary: %v. The cached file at %s may be corrupt; rerun with -refresh-dict to download it again.", err, dictPath)
+			} else if defsImporter, err = dictionary.NewImporterCtx(ctx, conn, entries); err != nil {
+				log.Fatalf("Dictionary indexing aborted: %v", err)
+			} else {
+				defsImporter.GlossLang = *glossLangFlag
+				defsImporter.Formatter = formatter
+				fmt.Printf("Dictionary loaded (%d entries) in %v\n", len(entries), time.Since(start))
+			}
+		} else {
+			fmt.Println("Skipping dictionary load (file missing). Definitions will be empty.")
+		}
 	}
 
-	fmt.Printf("Fetching %s...\n", *urlFlag)
+	// Only hand over a non-nil importer: a nil *Importer stored in the interface
+	// would compare non-nil and be dereferenced during lookups.
+	var defs ingest.DefinitionProvider
+	if defsImporter != nil {
+		defs = defsImporter
+	}
 
-	// Create a custom request with a User-Agent to avoid being blocked (e.g. 403 Forbidden or Cloudflare)
-	req, err := http.NewRequestWithContext(ctx, "GET", *urlFlag, nil)
+	analyzer, err := readerer.NewAnalyzer()
 	if err != nil {
-		log.Fatalf("Failed to create request: %v", err)
+		log.Fatalf("Failed to create analyzer: %v", err)
+	}
+	analyzer.Mode = tokenizerMode
+
+	extractor := fetch.NewExtractor()
+	extractor.MinContentRunes = *minContentFlag
+
+	p := &processor{
+		conn:             conn,
+		fetcher:          fetch.NewFetcher(),
+		extractor:        extractor,
+		analyzer:         analyzer,
+		defs:             defs,
+		meta:             *metaFlag,
+		lang:             *langFlag,
+		cacheOnly:        *cacheOnlyFlag,
+		canonicalizeKana: *canonicalizeKanaFlag,
+		readingStyle:     ingest.ReadingStyle(*readingStyleFlag),
+		reingest:         *reingestFlag,
+		maxSentences:     *maxSentencesFlag,
+		followPages:      *followPagesFlag,
+		boilerplate:      *boilerplateFlag,
 	}
-	// Mimic a real browser (Windows Chrome as requested)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9,ja;q=0.8")
-	req.Header.Set("Referer", "https://www.google.com/")
-	req.Header.Set("Sec-Ch-Ua", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
-	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
-	req.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
-	req.Header.Set("Sec-Fetch-Dest", "document")
-	req.Header.Set("Sec-Fetch-Mode", "navigate")
-	req.Header.Set("Sec-Fetch-Site", "cross-site")
-	req.Header.Set("Sec-Fetch-User", "?1")
-	req.Header.Set("Upgrade-Insecure-Requests", "1")
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	if *unmatchedOutFlag != "" {
+		if defs == nil && !*cacheOnlyFlag {
+			log.Fatal("-unmatched-out needs a dictionary (or -definitions-from-cache-only)")
+		}
+		f, err := os.OpenFile(*unmatchedOutFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			log.Fatalf("Failed to open -unmatched-out file: %v", err)
+		}
+		defer f.Close()
+		p.unmatched = &uniqueLineWriter{w: f, seen: make(map[string]bool)}
+	}
+
+	stopProfiling, err := startProfiling(*cpuProfileFlag, *memProfileFlag)
 	if err != nil {
-		log.Fatalf("Failed to fetch URL: %v", err)
+		log.Fatalf("Failed to start profiling: %v", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("Error: Got status code %d (Blocking or API Error)", resp.StatusCode)
+	if *urlFlag != "" {
+		err := p.processAndRecord(ctx, *urlFlag)
+		stopProfiling()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
-	// Read content with size limit to prevent OOM from untrusted URLs
-	const maxBodySize = 10 * 1024 * 1024 // 10 MB limit for HTML content
+	// Batch mode: a failing URL is reported and skipped so the rest still get ingested.
+	var urls []string
+	if *retryFailedFlag {
+		if urls, err = db.GetFailedSourceURLs(conn); err != nil {
+			log.Fatalf("Failed to list failed sources: %v", err)
+		}
+		if len(urls) == 0 {
+			stopProfiling()
+			fmt.Println("No failed sources to retry.")
+			return
+		}
+		fmt.Printf("Retrying %d failed sources.\n", len(urls))
+	} else if urls, err = readURLList(*urlsFlag); err != nil {
+		log.Fatalf("Failed to read URL list: %v", err)
+	}
+	failed := 0
+	for i, u := range urls {
+		if ctx.Err() != nil {
+			stopProfiling()
+			log.Fatalf("Interrupted after %d of %d URLs", i, len(urls))
+		}
+		fmt.Printf("[%d/%d] ", i+1, len(urls))
+		if err := p.processAndRecord(ctx, u); err != nil {
+			log.Printf("Skipping %s: %v", u, err)
+			failed++
+		}
+	}
+	stopProfiling()
+	fmt.Printf("Batch complete: %d of %d URLs processed, %d failed.\n", len(urls)-failed, len(urls), failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// shutdownGrace is how long pending database writes may run after an interrupt before
+// they are rolled back; progress up to the last committed batch is kept.
+const shutdownGrace = 10 * time.Second
+
+// processor runs the fetch → extract → analyze → ingest pipeline for one URL at a time,
+// sharing the dictionary, analyzer and database across a batch.
+type processor struct {
+	conn             *sql.DB
+	fetcher          *fetch.Fetcher
+	extractor        *fetch.Extractor
+	analyzer         *readerer.Analyzer
+	defs             ingest.DefinitionProvider
+	meta             string
+	lang             string // -lang; "" keeps an existing source's language (new ones get db.DefaultLanguage)
+	cacheOnly        bool
+	canonicalizeKana bool
+	readingStyle     ingest.ReadingStyle
+	reingest         bool
+	maxSentences     int
+	followPages      int
+	boilerplate      int
+	unmatched        io.Writer
+	progress         io.Writer // fetch warnings and page counts; nil means stdout
+}
+
+// uniqueLineWriter passes each distinct line to w once, so a word left undefined in
+// several pages is only listed once per run. Every Write must be exactly one line.
+type uniqueLineWriter struct {
+	w    io.Writer
+	seen map[string]bool
+}
+
+func (u *uniqueLineWriter) Write(line []byte) (int, error) {
+	if u.seen[string(line)] {
+		return len(line), nil
+	}
+	u.seen[string(line)] = true
+	return u.w.Write(line)
+}
 
-	if resp.ContentLength > int64(maxBodySize) {
-		log.Fatalf("Content-Length %d exceeds limit of %d bytes", resp.ContentLength, maxBodySize)
+// processAndRecord runs processURL and records the outcome in source_errors, so failed
+// URLs can be picked up by -retry-failed. Interruptions are not recorded as failures.
+// A page without usable article text is recorded as failed, since it may have been
+// served incomplete, but only warned about so it doesn't fail the run.
+func (p *processor) processAndRecord(ctx context.Context, pageURL string) error {
+	err := p.processURL(ctx, pageURL)
+	var recErr error
+	switch {
+	case err == nil:
+		recErr = db.RecordSourceSuccess(p.conn, pageURL)
+	case ctx.Err() == nil:
+		recErr = db.RecordSourceFailure(p.conn, pageURL, err.Error())
+	}
+	if recErr != nil {
+		log.Printf("Warning: failed to record the outcome for %s: %v", pageURL, recErr)
+	}
+	if errors.Is(err, fetch.ErrNoContent) {
+		fmt.Printf("Warning: %v. Skipping ingestion.\n", err)
+		return nil
 	}
+	return err
+}
 
-	bodyBytes, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+// fetchArticle fetches and extracts pageURL. With followPages set, the pages after it
+// (per rel=next links) are fetched too and their text is appended to the first page's
+// article, one paragraph break apart, so they are stored under one source.
+func (p *processor) fetchArticle(ctx context.Context, pageURL string) (readability.Article, error) {
+	pages, err := p.fetcher.FetchPages(ctx, pageURL, p.followPages)
+	if len(pages) == 0 {
+		if errors.Is(err, fetch.ErrBodyTooLarge) {
+			return readability.Article{}, fmt.Errorf("refusing to process %s: %w", pageURL, err)
+		}
+		return readability.Article{}, fmt.Errorf("failed to fetch URL: %w", err)
+	}
+	progress := p.progress
+	if progress == nil {
+		progress = os.Stdout
+	}
+	if err != nil {
+		fmt.Fprintf(progress, "Warning: stopping after %d pages: %v\n", len(pages), err)
+	}
+
+	article, err := p.extractor.ExtractArticle(pages[0].Body, pages[0].URL)
 	if err != nil {
-		log.Fatalf("Failed to read response body: %v", err)
+		return article, err
 	}
-	// Note: io.ReadAll(LimitReader) returns EOF when limit is reached.
-	// If the buffer is full, we assume it might be truncated (or exactly the limit).
-	// To distinguish, one could read one more byte, but typically hitting the limit is failure enough.
-	if int64(len(bodyBytes)) >= int64(maxBodySize) {
-		log.Fatalf("Response body exceeded maximum size limit of %d bytes", maxBodySize)
+	for _, page := range pages[1:] {
+		more, err := p.extractor.ExtractArticle(page.Body, page.URL)
+		if err != nil {
+			fmt.Fprintf(progress, "Warning: skipping %s: %v\n", page.URL, err)
+			continue
+		}
+		article.TextContent += "\n\n" + more.TextContent
 	}
+	if len(pages) > 1 {
+		fmt.Fprintf(progress, "Fetched %d pages.\n", len(pages))
+	}
+	return article, nil
+}
 
-	// Sanitize Ruby tags (remove <rt>...</rt>) to prevent duplicate text
-	bodyBytes = readerer.SanitizeRuby(bodyBytes)
+// processURL ingests a single page. Failures are returned so batch runs can move on; a
+// page without usable article text returns an error wrapping fetch.ErrNoContent.
+func (p *processor) processURL(ctx context.Context, pageURL string) error {
+	fmt.Printf("Fetching %s...\n", pageURL)
 
-	parsedURL, _ := url.Parse(*urlFlag)
-	article, err := readability.FromReader(bytes.NewReader(bodyBytes), parsedURL)
+	article, err := p.fetchArticle(ctx, pageURL)
+	if errors.Is(err, fetch.ErrNoContent) {
+		return fmt.Errorf("%q has no usable article text: %w", article.Title, err)
+	}
 	if err != nil {
-		log.Fatalf("Failed to extract article: %v", err)
+		return err
 	}
 
 	fmt.Printf("Title: %s\n", article.Title)
 	fmt.Printf("Extracted Text Length: %d chars\n", len(article.TextContent))
 
 	// Persist Source
-	sourceID, err := db.CreateOrGetSource(conn, "website_article", article.Title, article.Byline, article.SiteName, *urlFlag, "")
+	sourceID, created, err := db.CreateOrGetSourceEx(p.conn, db.SourceTypeWebsiteArticle, article.Title, article.Byline, article.SiteName, pageURL, p.meta)
 	if err != nil {
-		log.Fatalf("Failed to persist source: %v", err)
+		return fmt.Errorf("failed to persist source: %w", err)
+	}
+	if p.meta != "" {
+		// CreateOrGetSource leaves existing sources untouched; apply the new metadata explicitly.
+		if err := db.SetSourceMeta(p.conn, sourceID, p.meta); err != nil {
+			return fmt.Errorf("failed to store source metadata: %w", err)
+		}
+	}
+	if p.lang != "" {
+		if err := db.SetSourceLanguage(p.conn, sourceID, p.lang); err != nil {
+			return fmt.Errorf("failed to store source language: %w", err)
+		}
+	}
+	if article.Image != "" {
+		if err := db.SetSourceImage(p.conn, sourceID, article.Image); err != nil {
+			return fmt.Errorf("failed to store source image: %w", err)
+		}
+	}
+	if created {
+		fmt.Printf("New source saved with ID: %d\n", sourceID)
+	} else {
+		fmt.Printf("Existing source (resuming) with ID: %d\n", sourceID)
 	}
-	fmt.Printf("Source saved with ID: %d\n", sourceID)
 	fmt.Println("---------------------------------------------------")
-	// fmt.Println(article.TextContent) // Debug: Print full text
 
 	// Analyze
-	analyzer, err := readerer.NewAnalyzer()
-	if err != nil {
-		log.Fatalf("Failed to create analyzer: %v", err)
-	}
-
-	sentences, err := analyzer.AnalyzeDocument(article.TextContent)
+	sentences, err := p.analyzer.AnalyzeDocument(article.TextContent)
 	if err != nil {
-		log.Fatalf("Analysis failed: %v", err)
+		return fmt.Errorf("analysis failed: %w", err)
 	}
-
-	var linkCount int
-
 	fmt.Printf("Analyzed %d sentences.\n", len(sentences))
 
-	ingester := ingest.NewIngester(conn, defsImporter)
+	ingester := ingest.NewIngester(p.conn, p.defs)
+	ingester.CachedDefinitionsOnly = p.cacheOnly
+	ingester.CanonicalizeKana = p.canonicalizeKana
+	ingester.ReadingStyle = p.readingStyle
+	ingester.Force = p.reingest
+	ingester.MaxSentencesPerSource = p.maxSentences
+	ingester.BoilerplateRepeats = p.boilerplate
+	ingester.UnmatchedWriter = p.unmatched
+	ingester.ShutdownGrace = shutdownGrace
 
 	// Configure logging and progress for CLI output
 	ingester.Logger = log.New(os.Stderr, "", 0) // Log info to stderr without timestamp prefix for cleaner output
@@ -188,10 +595,285 @@ func main() {
 		}
 	}
 
-	linkCount, err = ingester.Ingest(ctx, sourceID, sentences)
+	linkCount, err := ingester.IngestContent(ctx, sourceID, article.TextContent, sentences)
+	if errors.Is(err, ingest.ErrContentUnchanged) {
+		fmt.Println("Content unchanged since the last run. Skipping ingestion (pass -reingest to override).")
+		return nil
+	}
+	if errors.Is(err, ingest.ErrResumeMismatch) {
+		return fmt.Errorf("ingestion failed: %w; pass -reingest to start this page over", err)
+	}
 	if err != nil {
-		log.Fatalf("Ingestion failed: %v", err)
+		return fmt.Errorf("ingestion failed: %w", err)
 	}
 
 	fmt.Printf("Processing complete. Linked %d word occurrences.\n", linkCount)
+	return nil
+}
+
+// fillDefinitions loads the dictionary at dictPath and stores definitions for the words
+// already in the database, returning how many were updated. A nil formatter stores JSON.
+func fillDefinitions(ctx context.Context, conn *sql.DB, dictPath, glossLang string, minOccurrences int, formatter dictionary.DefinitionFormatter) (int, error) {
+	fmt.Printf("Loading dictionary from %s...\n", dictPath)
+	entries, err := dictionary.LoadJMdictSimplified(dictPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load dictionary: %w", err)
+	}
+	importer, err := dictionary.NewImporterCtx(ctx, conn, entries)
+	if err != nil {
+		return 0, err
+	}
+	importer.MinOccurrencesForDefinition = minOccurrences
+	importer.GlossLang = glossLang
+	importer.Formatter = formatter
+	importer.CheckpointScope = dictionaryScope("fill-definitions", dictPath)
+	return importer.ProcessUpdatesCtx(ctx)
+}
+
+// dictionaryScope identifies a definitions backfill for its resume checkpoint: the mode,
+// the dictionary file, and its size and modification time, so replacing the file (e.g.
+// with -refresh-dict) starts the next run over.
+func dictionaryScope(mode, dictPath string) string {
+	scope := mode + ":" + dictPath
+	if fi, err := os.Stat(dictPath); err == nil {
+		scope += fmt.Sprintf("@%d:%d", fi.Size(), fi.ModTime().UnixNano())
+	}
+	return scope
+}
+
+// printDefinitionDiff lists the stored words whose definitions would change when moving
+// from the dictionary at oldPath to newDict.
+func printDefinitionDiff(ctx context.Context, conn *sql.DB, newDict *dictionary.Importer, oldPath, glossLang string) error {
+	entries, err := dictionary.LoadJMdictSimplified(oldPath)
+	if err != nil {
+		return fmt.Errorf("failed to load %s: %w", oldPath, err)
+	}
+	oldDict, err := dictionary.NewImporterCtx(ctx, conn, entries)
+	if err != nil {
+		return err
+	}
+	oldDict.GlossLang = glossLang
+	changes, err := newDict.DiffDefinitions(oldDict)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		fmt.Printf("%s\n  - %s\n  + %s\n", c.Word, dictionary.FlattenDefinitions(c.Old), dictionary.FlattenDefinitions(c.New))
+	}
+	fmt.Printf("%d stored words have changed definitions.\n", len(changes))
+	return nil
+}
+
+// streamJSON fetches pageURL, following pages like processURL, and writes its analyzed
+// sentences to w as newline-delimited JSON while analysis proceeds, keeping memory flat
+// for book-length pages. p needs no database. Progress goes to stderr, and p.progress
+// should too, so stdout stays machine-readable.
+func streamJSON(ctx context.Context, w io.Writer, p *processor, pageURL string) error {
+	article, err := p.fetchArticle(ctx, pageURL)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sentences := make(chan readerer.Sentence, 16)
+	errc := make(chan error, 1)
+	go func() { errc <- p.analyzer.StreamDocument(ctx, article.TextContent, sentences) }()
+
+	bw := bufio.NewWriter(w)
+	n, err := export.WriteSentencesNDJSON(bw, sentences)
+	if err != nil {
+		// Stop the analyzer and let it close the channel before returning.
+		cancel()
+		for range sentences {
+		}
+		<-errc
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	if err := <-errc; err != nil {
+		return fmt.Errorf("analysis failed: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to write JSON: %w", err)
+	}
+	log.Printf("Streamed %d sentences from %q", n, article.Title)
+	return nil
+}
+
+// startProfiling starts a CPU profile written to cpuPath, if set. The returned function
+// stops it and writes a heap profile to memPath, if set; failures there are only logged.
+func startProfiling(cpuPath, memPath string) (stop func(), err error) {
+	var cpuFile *os.File
+	if cpuPath != "" {
+		cpuFile, err = os.Create(cpuPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(cpuFile); err != nil {
+			cpuFile.Close()
+			return nil, err
+		}
+	}
+	return func() {
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			if err := cpuFile.Close(); err != nil {
+				log.Printf("Failed to write CPU profile: %v", err)
+			}
+		}
+		if memPath == "" {
+			return
+		}
+		f, err := os.Create(memPath)
+		if err != nil {
+			log.Printf("Failed to create heap profile: %v", err)
+			return
+		}
+		defer f.Close()
+		runtime.GC() // report up-to-date allocation statistics
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			log.Printf("Failed to write heap profile: %v", err)
+		}
+	}, nil
+}
+
+// isGlossLang reports whether s looks like a JMdict language code (three lowercase letters).
+func isGlossLang(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+// readURLList reads one URL per line from path, ignoring blank lines and # comments.
+func readURLList(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no URLs found in %s", path)
+	}
+	return urls, nil
+}
+
+// exportCSV writes export.ExportCSV output for sourceID to path. columns is a
+// comma-separated list.
+func exportCSV(conn *sql.DB, sourceID int64, columns, path string) error {
+	var cols []string
+	for _, c := range strings.Split(columns, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cols = append(cols, c)
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := export.ExportCSV(conn, sourceID, cols, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// dumpDatabase writes the db.DumpDatabase document to path.
+func dumpDatabase(conn *sql.DB, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := db.DumpDatabase(conn, w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// restoreDatabase loads a dump from path in a single transaction.
+func restoreDatabase(conn *sql.DB, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.ImportDatabase(tx, bufio.NewReader(f)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeTopWords prints words as an aligned table of rank, word, reading, total count and,
+// if withDefinitions is set, the flattened meanings.
+func writeTopWords(w io.Writer, words []db.WordFrequency, withDefinitions bool) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "#\tWORD\tREADING\tCOUNT"
+	if withDefinitions {
+		header += "\tMEANING"
+	}
+	fmt.Fprintln(tw, header)
+	for i, wf := range words {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d", i+1, wf.Word.Word, wf.Word.Pronunciation, wf.Count)
+		if withDefinitions {
+			fmt.Fprintf(tw, "\t%s", dictionary.FlattenDefinitions(wf.Word.Definitions))
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// writeReport renders the vocabulary of a stored source in the given format to outPath,
+// or to stdout when outPath is empty.
+func writeReport(conn *sql.DB, sourceID int64, format, outPath string) error {
+	if format != "markdown" {
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	src, err := db.GetSource(conn, sourceID)
+	if err != nil {
+		return fmt.Errorf("load source %d: %w", sourceID, err)
+	}
+	words, err := db.GetWordFrequencies(conn, sourceID, 0)
+	if err != nil {
+		return fmt.Errorf("load words: %w", err)
+	}
+	if err := export.FillExamples(conn, words); err != nil {
+		return fmt.Errorf("load examples: %w", err)
+	}
+
+	if outPath == "" {
+		return export.WriteMarkdown(os.Stdout, src, words)
+	}
+	f, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	if err := export.WriteMarkdown(f, src, words); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/fetch"
+	"github.com/japaniel/readerer/pkg/readerer"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// fixtureDoer serves a fixed HTML page for every request, standing in for the network.
+type fixtureDoer struct{ html string }
+
+func (d fixtureDoer) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(d.html)),
+		Request:    req,
+	}, nil
+}
+
+// newTestDB opens an in-memory database with the schema applied; it is closed when the
+// test ends.
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetMaxOpenConns(1)
+	if err := db.InitDB(conn); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	return conn
+}
+
+// newTestProcessor returns a processor over a fresh newTestDB whose requests are served
+// by doer, with the extractor's minimum article length lifted for short fixtures.
+func newTestProcessor(t *testing.T, doer fetch.HTTPDoer) *processor {
+	t.Helper()
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatalf("new analyzer: %v", err)
+	}
+	fetcher := fetch.NewFetcher()
+	fetcher.Client = doer
+	extractor := fetch.NewExtractor()
+	extractor.MinContentRunes = 0
+	return &processor{conn: newTestDB(t), fetcher: fetcher, extractor: extractor, analyzer: analyzer}
+}
+
+// TestProcessURL_InjectedClient runs the fetch → extract → ingest pipeline in-process,
+// with no server or CLI binary.
+func TestProcessURL_InjectedClient(t *testing.T) {
+	p := newTestProcessor(t, fixtureDoer{html: `<html><head><title>猫の記事</title><meta property="og:image" content="https://example.invalid/cat.jpg"></head><body><article><p>猫が好きです。犬も好きです。毎日散歩に行きます。</p></article></body></html>`})
+	if err := p.processURL(context.Background(), "https://example.invalid/cats"); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+
+	stats, err := db.GetDBStats(p.conn)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Sources != 1 || stats.Words == 0 || stats.Links == 0 {
+		t.Fatalf("expected the page to be ingested, got %+v", stats)
+	}
+
+	src, err := db.GetSource(p.conn, 1)
+	if err != nil {
+		t.Fatalf("get source: %v", err)
+	}
+	if src.ImageURL != "https://example.invalid/cat.jpg" {
+		t.Errorf("expected the extracted image to be stored as the source image, got %q", src.ImageURL)
+	}
+	if src.Language != db.DefaultLanguage {
+		t.Errorf("expected the default source language, got %q", src.Language)
+	}
+}
+
+// TestProcessURLLanguage checks that -lang is stored on the source and on its words.
+func TestProcessURLLanguage(t *testing.T) {
+	p := newTestProcessor(t, fixtureDoer{html: `<html><head><title>猫の記事</title></head><body><article><p>猫が好きです。犬も好きです。</p></article></body></html>`})
+	p.lang = "en"
+	if err := p.processURL(context.Background(), "https://example.invalid/cats"); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+
+	src, err := db.GetSource(p.conn, 1)
+	if err != nil {
+		t.Fatalf("get source: %v", err)
+	}
+	if src.Language != "en" {
+		t.Errorf("expected source language en, got %q", src.Language)
+	}
+	var total, en int
+	if err := p.conn.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN language = 'en' THEN 1 END) FROM words`).Scan(&total, &en); err != nil {
+		t.Fatalf("count words: %v", err)
+	}
+	if total == 0 || en != total {
+		t.Fatalf("expected every word stored as en, got %d of %d", en, total)
+	}
+	// Resuming without -lang keeps the language recorded for the source.
+	p.lang = ""
+	if err := p.processURL(context.Background(), "https://example.invalid/cats"); err != nil {
+		t.Fatalf("processURL without -lang: %v", err)
+	}
+	if src, err = db.GetSource(p.conn, 1); err != nil {
+		t.Fatalf("get source: %v", err)
+	}
+	if src.Language != "en" {
+		t.Errorf("expected source language to stay en, got %q", src.Language)
+	}
+}
+
+func TestFillDefinitionsAfterIngestWithoutDictionary(t *testing.T) {
+	// No dictionary: words are stored without definitions.
+	p := newTestProcessor(t, fixtureDoer{html: `<html><body><article><p>猫が好きです。犬も好きです。毎日散歩に行きます。</p></article></body></html>`})
+	if err := p.processURL(context.Background(), "https://example.invalid/cats"); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+	definition := func() string {
+		t.Helper()
+		var defs sql.NullString
+		if err := p.conn.QueryRow(`SELECT definitions FROM words WHERE word = '猫'`).Scan(&defs); err != nil {
+			t.Fatalf("query 猫: %v", err)
+		}
+		return defs.String
+	}
+	if d := definition(); d != "" {
+		t.Fatalf("expected no definition before filling, got %q", d)
+	}
+
+	dictPath := filepath.Join(t.TempDir(), "jmdict-eng-common.json")
+	dict := `[{"id":"1","kanji":[{"text":"猫","common":true}],"kana":[{"text":"ねこ","common":true}],"sense":[{"partOfSpeech":["n"],"gloss":[{"lang":"eng","text":"cat"}]}]}]`
+	if err := os.WriteFile(dictPath, []byte(dict), 0644); err != nil {
+		t.Fatalf("write dict: %v", err)
+	}
+	count, err := fillDefinitions(context.Background(), p.conn, dictPath, "eng", 0, nil)
+	if err != nil {
+		t.Fatalf("fillDefinitions: %v", err)
+	}
+	if count == 0 || !strings.Contains(definition(), "cat") {
+		t.Fatalf("expected 猫 to get a definition, updated %d, got %q", count, definition())
+	}
+}
+
+func TestWriteTopWords(t *testing.T) {
+	conn := newTestDB(t)
+	sourceID, err := db.CreateOrGetSource(conn, db.SourceTypeWebsiteArticle, "", "", "", "https://example.invalid/top", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for word, n := range map[string]int{"猫": 2, "犬": 7, "鳥": 1} {
+		id, err := db.CreateOrGetWord(conn, word, word, "", `[{"senses":["animal"],"pos":["n"]}]`, "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.LinkWordToSource(conn, id, sourceID, word+"。", "", n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	words, err := db.GetWordFrequencies(conn, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := writeTopWords(&out, words, true); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "#") || !strings.Contains(lines[0], "MEANING") {
+		t.Fatalf("expected a header and 2 rows, got:\n%s", out.String())
+	}
+	if f := strings.Fields(lines[1]); len(f) != 4 || f[0] != "1" || f[1] != "犬" || f[2] != "7" || f[3] != "animal" {
+		t.Fatalf("expected 犬 first with count 7, got %q", lines[1])
+	}
+
+	out.Reset()
+	if err := writeTopWords(&out, words, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "MEANING") || strings.Contains(out.String(), "animal") {
+		t.Fatalf("expected no meaning column, got:\n%s", out.String())
+	}
+}
+
+func TestWriteReportUsesPrimaryExample(t *testing.T) {
+	conn := newTestDB(t)
+	primary, err := db.CreateOrGetSource(conn, db.SourceTypeWebsiteArticle, "猫の話", "", "", "https://example.invalid/primary", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := db.CreateOrGetSource(conn, db.SourceTypeWebsiteArticle, "", "", "", "https://example.invalid/other", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catID, err := db.CreateOrGetWord(conn, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, catID, primary, "猫だ。", "猫だ。", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, catID, other, "今日は庭で猫がのんびり遊んでいました。", "今日は庭で猫がのんびり遊んでいました。", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPrimarySource(conn, catID, primary); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(t.TempDir(), "report.md")
+	if err := writeReport(conn, primary, "markdown", out); err != nil {
+		t.Fatalf("writeReport: %v", err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row := "| 猫 | ねこ |  | 1 | 猫だ。 |"; !strings.Contains(string(got), row) {
+		t.Fatalf("expected row %q with the primary source's example, got:\n%s", row, got)
+	}
+}
+
+// flakyDoer fails its first request and then behaves like fixtureDoer.
+type flakyDoer struct {
+	fixtureDoer
+	calls int
+}
+
+func (d *flakyDoer) Do(req *http.Request) (*http.Response, error) {
+	d.calls++
+	if d.calls == 1 {
+		return nil, errors.New("connection reset")
+	}
+	return d.fixtureDoer.Do(req)
+}
+
+func TestRetryFailedSource(t *testing.T) {
+	p := newTestProcessor(t, &flakyDoer{fixtureDoer: fixtureDoer{html: `<html><body><article><p>猫が好きです。犬も好きです。</p></article></body></html>`}})
+
+	const pageURL = "https://example.invalid/flaky"
+	if err := p.processAndRecord(context.Background(), pageURL); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	se, err := db.GetSourceError(p.conn, pageURL)
+	if err != nil {
+		t.Fatalf("get source error: %v", err)
+	}
+	if se.Status != db.SourceStatusFailed || se.Attempts != 1 || !strings.Contains(se.Error, "connection reset") {
+		t.Fatalf("unexpected record after failure: %+v", se)
+	}
+
+	failed, err := db.GetFailedSourceURLs(p.conn)
+	if err != nil || len(failed) != 1 || failed[0] != pageURL {
+		t.Fatalf("expected %s to be listed for retry, got %v (err %v)", pageURL, failed, err)
+	}
+	if err := p.processAndRecord(context.Background(), failed[0]); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+	se, err = db.GetSourceError(p.conn, pageURL)
+	if err != nil {
+		t.Fatalf("get source error: %v", err)
+	}
+	if se.Status != db.SourceStatusSucceeded || se.Attempts != 2 {
+		t.Fatalf("expected the retry to mark the source succeeded after 2 attempts, got %+v", se)
+	}
+	if failed, _ := db.GetFailedSourceURLs(p.conn); len(failed) != 0 {
+		t.Fatalf("expected no failed sources left, got %v", failed)
+	}
+}
+
+func TestNoContentSourceIsRetried(t *testing.T) {
+	p := newTestProcessor(t, fixtureDoer{html: `<html><body><article><p>猫。</p></article></body></html>`})
+	p.extractor.MinContentRunes = 50
+
+	// The page is skipped without failing the run, but stays listed for -retry-failed.
+	const pageURL = "https://example.invalid/empty"
+	if err := p.processAndRecord(context.Background(), pageURL); err != nil {
+		t.Fatalf("expected a page without content to be skipped, got %v", err)
+	}
+	se, err := db.GetSourceError(p.conn, pageURL)
+	if err != nil {
+		t.Fatalf("get source error: %v", err)
+	}
+	if se.Status != db.SourceStatusFailed || !strings.Contains(se.Error, fetch.ErrNoContent.Error()) {
+		t.Fatalf("unexpected record after an empty page: %+v", se)
+	}
+	if failed, _ := db.GetFailedSourceURLs(p.conn); len(failed) != 1 || failed[0] != pageURL {
+		t.Fatalf("expected %s to be listed for retry, got %v", pageURL, failed)
+	}
+	if stats, err := db.GetDBStats(p.conn); err != nil || stats.Sources != 0 {
+		t.Fatalf("expected nothing ingested, got %+v (err %v)", stats, err)
+	}
+}
+
+// pagedDoer serves one HTML page per URL.
+type pagedDoer map[string]string
+
+func (d pagedDoer) Do(req *http.Request) (*http.Response, error) {
+	html, ok := d[req.URL.String()]
+	if !ok {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}
+	return fixtureDoer{html: html}.Do(req)
+}
+
+func TestProcessURLFollowsPages(t *testing.T) {
+	p := newTestProcessor(t, pagedDoer{
+		"https://example.invalid/story":        `<html><head><title>物語</title><link rel="next" href="/story?page=2"></head><body><article><p>猫が好きです。毎日散歩に行きます。</p></article></body></html>`,
+		"https://example.invalid/story?page=2": `<html><head><title>物語 (2)</title></head><body><article><p>鳥が空を飛んでいます。</p></article></body></html>`,
+	})
+	p.followPages = 3
+	if err := p.processURL(context.Background(), "https://example.invalid/story"); err != nil {
+		t.Fatalf("processURL: %v", err)
+	}
+
+	stats, err := db.GetDBStats(p.conn)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.Sources != 1 {
+		t.Fatalf("expected both pages under one source, got %d sources", stats.Sources)
+	}
+	words, err := db.GetWordsBySource(p.conn, 1)
+	if err != nil {
+		t.Fatalf("words: %v", err)
+	}
+	found := map[string]bool{}
+	for _, w := range words {
+		found[w.Word] = true
+	}
+	if !found["猫"] || !found["鳥"] {
+		t.Fatalf("expected words from both pages, got %v", found)
+	}
+}
+
+func TestStreamJSONFollowsPages(t *testing.T) {
+	p := newTestProcessor(t, pagedDoer{
+		"https://example.invalid/story":        `<html><head><title>物語</title><link rel="next" href="/story?page=2"></head><body><article><p>猫が好きです。</p></article></body></html>`,
+		"https://example.invalid/story?page=2": `<html><head><title>物語 (2)</title></head><body><article><p>鳥が空を飛んでいます。</p></article></body></html>`,
+	})
+	p.followPages = 3
+	var progress strings.Builder
+	p.progress = &progress
+
+	var out strings.Builder
+	if err := streamJSON(context.Background(), &out, p, "https://example.invalid/story"); err != nil {
+		t.Fatalf("streamJSON: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "猫") || !strings.Contains(lines[1], "鳥") {
+		t.Fatalf("expected one JSON line per sentence from both pages, got:\n%s", out.String())
+	}
+	if !strings.Contains(progress.String(), "Fetched 2 pages.") {
+		t.Errorf("expected the page count on the progress writer, got %q", progress.String())
+	}
+}
@@ -7,6 +7,8 @@ require (
 	github.com/ikawaha/kagome-dict/ipa v1.2.6
 	github.com/ikawaha/kagome/v2 v2.10.3
 	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/net v0.35.0
+	golang.org/x/text v0.32.0
 )
 
 require (
@@ -15,6 +17,4 @@ require (
 	github.com/go-shiori/dom v0.0.0-20230515143342-73569d674e1c // indirect
 	github.com/gogs/chardet v0.0.0-20211120154057-b7413eaefb8f // indirect
 	github.com/ikawaha/kagome-dict v1.1.7 // indirect
-	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/text v0.32.0 // indirect
 )
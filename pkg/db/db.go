@@ -3,10 +3,72 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// sqliteCaps records capabilities of the linked SQLite library. They are fixed when the
+// driver is compiled, so they are probed once per process (by InitDB, or by the first
+// upsert if InitDB was not called) and shared by every handle.
+var sqliteCaps struct {
+	mu     sync.Mutex
+	probed bool
+	// returning is false when SQLite is older than 3.35 and rejects INSERT ... RETURNING;
+	// upserts then look the id up with a separate SELECT.
+	returning bool
+}
+
+// returningOverride, when set by tests, replaces the probed RETURNING support.
+var returningOverride func() bool
+
+// probeCapabilities checks the SQLite version behind db unless it was already probed.
+// A failed probe is retried on the next call.
+func probeCapabilities(db DBExecutor) error {
+	sqliteCaps.mu.Lock()
+	defer sqliteCaps.mu.Unlock()
+	if sqliteCaps.probed {
+		return nil
+	}
+	var version string
+	if err := db.QueryRow(`SELECT sqlite_version()`).Scan(&version); err != nil {
+		return fmt.Errorf("query sqlite version: %w", err)
+	}
+	sqliteCaps.returning = versionAtLeast(version, 3, 35)
+	sqliteCaps.probed = true
+	return nil
+}
+
+// supportsReturning reports whether SQLite accepts INSERT ... RETURNING.
+func supportsReturning(db DBExecutor) (bool, error) {
+	if returningOverride != nil {
+		return returningOverride(), nil
+	}
+	if err := probeCapabilities(db); err != nil {
+		return false, err
+	}
+	sqliteCaps.mu.Lock()
+	defer sqliteCaps.mu.Unlock()
+	return sqliteCaps.returning, nil
+}
+
+// versionAtLeast reports whether a "major.minor.patch" version is at least major.minor.
+func versionAtLeast(version string, major, minor int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	gotMajor, err1 := strconv.Atoi(parts[0])
+	gotMinor, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return gotMajor > major || gotMajor == major && gotMinor >= minor
+}
+
 // InitDB runs migrations on the given DB connection using the embedded SQL.
 // We execute the full SQL batch so that statement parsing is delegated to SQLite
 // (safer than naive semicolon-splitting which can break on semicolons inside
@@ -20,6 +82,9 @@ func InitDB(db *sql.DB) error {
 	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
 		return err
 	}
+	if err := probeCapabilities(db); err != nil {
+		return err
+	}
 	_, err := db.Exec(migrationsSQL)
 	if err != nil {
 		return err
@@ -29,11 +94,334 @@ func InitDB(db *sql.DB) error {
 	if err := ensureColumnExists(db, "sources", "last_processed_sentence", "INTEGER DEFAULT -1"); err != nil {
 		return fmt.Errorf("failed to migrate schema: %w", err)
 	}
+	if err := ensureColumnExists(db, "sources", "total_sentences", "INTEGER"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "sources", "content_hash", "TEXT"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "sources", "image_url", "TEXT"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "sources", "language", "TEXT DEFAULT 'ja'"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "word_sources", "is_primary", "INTEGER DEFAULT 0"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "words", "gloss_text", "TEXT"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := ensureColumnExists(db, "words", "status", "TEXT NOT NULL DEFAULT 'new'"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	// SQLite's ALTER TABLE rejects non-constant defaults, so older rows start out NULL.
+	if err := ensureColumnExists(db, "word_sources", "last_seen_at", "DATETIME"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	if err := ensureColumnExists(db, "source_sentences", "ordinal", "INTEGER"); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+	if err := rebuildSourceSentences(db); err != nil {
+		return fmt.Errorf("failed to migrate schema: %w", err)
+	}
+
+	// Data written before a column or normalization existed is brought up to date once.
+	if err := runOnce(db, "backfill_gloss_text", backfillGlossText); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+	if err := runOnce(db, "utc_word_source_times", normalizeWordSourceTimes); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+	if err := runOnce(db, "normalize_sentences", normalizeStoredSentences); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+	if err := runOnce(db, "normalize_source_titles", normalizeSourceTitles); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+	if err := runOnce(db, "normalize_source_types", normalizeSourceTypes); err != nil {
+		return fmt.Errorf("failed to migrate data: %w", err)
+	}
+
+	return nil
+}
+
+// rebuildSourceSentences replaces a source_sentences table created with the old
+// PRIMARY KEY(source_id, sentence_id), which silently drops a sentence repeated at a
+// later position, by one keyed on (source_id, ordinal) as in migrations.sql. Tables
+// already in the new shape are left alone.
+func rebuildSourceSentences(db *sql.DB) error {
+	var pkColumns int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('source_sentences') WHERE pk > 0`).Scan(&pkColumns); err != nil {
+		return fmt.Errorf("failed to check table info: %w", err)
+	}
+	if pkColumns == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		`CREATE TABLE source_sentences_new (
+			source_id INTEGER NOT NULL REFERENCES sources(id) ON DELETE CASCADE,
+			sentence_id INTEGER NOT NULL REFERENCES sentences(id) ON DELETE CASCADE,
+			ordinal INTEGER,
+			UNIQUE(source_id, ordinal)
+		)`,
+		`INSERT INTO source_sentences_new (source_id, sentence_id, ordinal)
+			SELECT source_id, sentence_id, ordinal FROM source_sentences`,
+		`DROP TABLE source_sentences`,
+		`ALTER TABLE source_sentences_new RENAME TO source_sentences`,
+		`CREATE INDEX IF NOT EXISTS idx_source_sentences_sentence ON source_sentences(source_id, sentence_id)`,
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to rebuild source_sentences: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// runOnce applies the one-time data migration name unless applied_migrations already
+// records it. The migration and its record are committed together, so a failed run is
+// retried on the next InitDB.
+func runOnce(db *sql.DB, name string, migrate func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT OR IGNORE INTO applied_migrations (name, applied_at) VALUES (?, ?)`, name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return nil
+	}
+	if err := migrate(tx); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return tx.Commit()
+}
+
+// backfillGlossText fills gloss_text for words stored before the column existed.
+func backfillGlossText(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, definitions FROM words WHERE gloss_text IS NULL AND COALESCE(definitions, '') != ''`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id          int64
+		definitions string
+	}
+	var words []pending
+	for rows.Next() {
+		var w pending
+		if err := rows.Scan(&w.id, &w.definitions); err != nil {
+			rows.Close()
+			return err
+		}
+		words = append(words, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, w := range words {
+		if _, err := tx.Exec(`UPDATE words SET gloss_text = ? WHERE id = ?`, glossText(w.definitions), w.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// No runtime conversion performed here; we assume a fresh DB is created
-	// on startup. If upgrade support is added later, implement a guarded
-	// migration with explicit schema checks and tests.
+// normalizeWordSourceTimes rewrites link times stored with a local offset, as they were
+// before LinkWordToSource switched to UTC, so time windows compare them correctly as text.
+func normalizeWordSourceTimes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, first_seen_at, last_seen_at FROM word_sources
+		WHERE first_seen_at NOT LIKE '%+00:00' OR last_seen_at NOT LIKE '%+00:00'`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id                  int64
+		firstSeen, lastSeen sql.NullTime
+	}
+	var links []pending
+	for rows.Next() {
+		var l pending
+		if err := rows.Scan(&l.id, &l.firstSeen, &l.lastSeen); err != nil {
+			rows.Close()
+			return err
+		}
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	utc := func(t sql.NullTime) interface{} {
+		if !t.Valid {
+			return nil
+		}
+		return t.Time.UTC()
+	}
+	for _, l := range links {
+		if _, err := tx.Exec(`UPDATE word_sources SET first_seen_at = ?, last_seen_at = ? WHERE id = ?`, utc(l.firstSeen), utc(l.lastSeen), l.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// normalizeStoredSentences applies normalizeSentence to sentences stored before it
+// existed. Sentences that become equal are merged into one, and the links, contexts and
+// source positions that used the others are moved to it.
+func normalizeStoredSentences(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, text FROM sentences ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type group struct {
+		keep    int64
+		keepRaw string
+		others  []int64
+	}
+	groups := make(map[string]*group)
+	var order []string
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		norm := normalizeSentence(text)
+		if norm == "" {
+			continue
+		}
+		g, ok := groups[norm]
+		if !ok {
+			groups[norm] = &group{keep: id, keepRaw: text}
+			order = append(order, norm)
+			continue
+		}
+		// Prefer keeping the row that is already normalized, so renaming it cannot collide.
+		if text == norm {
+			g.others = append(g.others, g.keep)
+			g.keep, g.keepRaw = id, text
+		} else {
+			g.others = append(g.others, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, norm := range order {
+		g := groups[norm]
+		for _, dup := range g.others {
+			for _, stmt := range []string{
+				`UPDATE word_sources SET context_sentence_id = ?1 WHERE context_sentence_id = ?2`,
+				`UPDATE word_sources SET example_sentence_id = ?1 WHERE example_sentence_id = ?2`,
+				`UPDATE OR IGNORE word_contexts SET sentence_id = ?1 WHERE sentence_id = ?2`,
+				`DELETE FROM word_contexts WHERE sentence_id = ?2`,
+				`UPDATE source_sentences SET sentence_id = ?1 WHERE sentence_id = ?2`,
+				`DELETE FROM sentences WHERE id = ?2`,
+			} {
+				if _, err := tx.Exec(stmt, g.keep, dup); err != nil {
+					return err
+				}
+			}
+		}
+		if g.keepRaw != norm {
+			if _, err := tx.Exec(`UPDATE sentences SET text = ? WHERE id = ?`, norm, g.keep); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeSourceTitles applies normalizeSourceText to the titles and authors of sources
+// stored before CreateOrGetSource normalized them, so re-crawls match them again. A
+// source whose normalized form already belongs to another source is left as it is rather
+// than merged, since both may hold separate ingestion progress.
+func normalizeSourceTitles(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, IFNULL(url, ''), IFNULL(title, ''), IFNULL(author, '') FROM sources ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	type pending struct {
+		id                 int64
+		url, title, author string
+	}
+	var sources []pending
+	for rows.Next() {
+		var s pending
+		if err := rows.Scan(&s.id, &s.url, &s.title, &s.author); err != nil {
+			rows.Close()
+			return err
+		}
+		sources = append(sources, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, s := range sources {
+		title, author := normalizeSourceText(s.title), normalizeSourceText(s.author)
+		if title == s.title && author == s.author {
+			continue
+		}
+		var taken bool
+		if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM sources WHERE IFNULL(url, '') = ? AND IFNULL(title, '') = ? AND IFNULL(author, '') = ? AND id != ?)`,
+			s.url, title, author, s.id).Scan(&taken); err != nil {
+			return err
+		}
+		if taken {
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE sources SET title = ?, author = ? WHERE id = ?`, title, author, s.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeSourceTypes maps source types stored before the SourceType constants existed
+// (e.g. "website" or "test") through NormalizeSourceType.
+func normalizeSourceTypes(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT DISTINCT source_type FROM sources`)
+	if err != nil {
+		return err
+	}
+	var types []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			rows.Close()
+			return err
+		}
+		types = append(types, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, t := range types {
+		if known := NormalizeSourceType(t); known != t {
+			if _, err := tx.Exec(`UPDATE sources SET source_type = ? WHERE source_type = ?`, known, t); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,299 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// DumpVersion is the document version written by DumpDatabase. ImportDatabase rejects
+// newer versions.
+const DumpVersion = 1
+
+// dumpSource is a sources row as it appears in a dump.
+type dumpSource struct {
+	ID                    int64     `json:"id"`
+	SourceType            string    `json:"source_type"`
+	Title                 string    `json:"title,omitempty"`
+	Author                string    `json:"author,omitempty"`
+	Website               string    `json:"website,omitempty"`
+	URL                   string    `json:"url,omitempty"`
+	Meta                  string    `json:"meta,omitempty"`
+	ImageURL              string    `json:"image_url,omitempty"`
+	Language              string    `json:"language,omitempty"`
+	ContentHash           string    `json:"content_hash,omitempty"`
+	LastProcessedSentence int       `json:"last_processed_sentence"`
+	TotalSentences        *int      `json:"total_sentences,omitempty"`
+	AddedAt               time.Time `json:"added_at"`
+}
+
+// dumpWord is a words row as it appears in a dump.
+type dumpWord struct {
+	ID            int64  `json:"id"`
+	Word          string `json:"word"`
+	Lemma         string `json:"lemma"`
+	Language      string `json:"language"`
+	Pronunciation string `json:"pronunciation,omitempty"`
+	ImageURL      string `json:"image_url,omitempty"`
+	MnemonicText  string `json:"mnemonic_text,omitempty"`
+	Definitions   string `json:"definitions,omitempty"`
+	Status        string `json:"status"`
+}
+
+// dumpLink is a word_sources row as it appears in a dump, with its sentences inlined.
+type dumpLink struct {
+	WordID          int64     `json:"word_id"`
+	SourceID        int64     `json:"source_id"`
+	ContextSentence string    `json:"context_sentence,omitempty"`
+	ExampleSentence string    `json:"example_sentence,omitempty"`
+	OccurrenceCount int       `json:"occurrence_count"`
+	FirstSeenAt     time.Time `json:"first_seen_at"`
+	LastSeenAt      time.Time `json:"last_seen_at"`
+	IsPrimary       bool      `json:"is_primary,omitempty"`
+}
+
+// DumpDatabase writes sources, words (with definitions) and word-source links to w as
+// one JSON document:
+//
+//	{"version": 1, "sources": [...], "words": [...], "links": [...]}
+//
+// Rows are streamed one at a time, so the database is never held in memory. Links carry
+// their context and example sentences as text; the per-source sentence log, extra word
+// contexts, notes and checkpoints are not included.
+func DumpDatabase(db DBExecutor, w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "{\"version\":%d,\n\"sources\":", DumpVersion); err != nil {
+		return err
+	}
+	err := dumpArray(w, db, `SELECT id, source_type, title, author, website, url, meta, image_url, language, content_hash, last_processed_sentence, total_sentences, added_at
+		FROM sources ORDER BY id`, func(rows *sql.Rows) (any, error) {
+		var s dumpSource
+		var title, author, website, url, meta, imageURL, language, hash sql.NullString
+		var last, total sql.NullInt64
+		var addedAt sql.NullTime
+		if err := rows.Scan(&s.ID, &s.SourceType, &title, &author, &website, &url, &meta, &imageURL, &language, &hash, &last, &total, &addedAt); err != nil {
+			return nil, err
+		}
+		s.Title, s.Author, s.Website, s.URL = title.String, author.String, website.String, url.String
+		s.Meta, s.ImageURL, s.Language, s.ContentHash = meta.String, imageURL.String, language.String, hash.String
+		s.LastProcessedSentence = -1
+		if last.Valid {
+			s.LastProcessedSentence = int(last.Int64)
+		}
+		if total.Valid {
+			n := int(total.Int64)
+			s.TotalSentences = &n
+		}
+		s.AddedAt = addedAt.Time
+		return s, nil
+	})
+	if err != nil {
+		return fmt.Errorf("dump sources: %w", err)
+	}
+
+	if _, err := io.WriteString(w, ",\n\"words\":"); err != nil {
+		return err
+	}
+	err = dumpArray(w, db, `SELECT id, word, lemma, language, pronunciation, image_url, mnemonic_text, definitions, status
+		FROM words ORDER BY id`, func(rows *sql.Rows) (any, error) {
+		var wd dumpWord
+		var lemma, lang, pron, img, mn, defs sql.NullString
+		if err := rows.Scan(&wd.ID, &wd.Word, &lemma, &lang, &pron, &img, &mn, &defs, &wd.Status); err != nil {
+			return nil, err
+		}
+		wd.Lemma, wd.Language, wd.Pronunciation = lemma.String, lang.String, pron.String
+		wd.ImageURL, wd.MnemonicText, wd.Definitions = img.String, mn.String, defs.String
+		return wd, nil
+	})
+	if err != nil {
+		return fmt.Errorf("dump words: %w", err)
+	}
+
+	if _, err := io.WriteString(w, ",\n\"links\":"); err != nil {
+		return err
+	}
+	err = dumpArray(w, db, `SELECT ws.word_id, ws.source_id, cs.text, es.text, ws.occurrence_count, ws.first_seen_at, ws.last_seen_at, ws.is_primary
+		FROM word_sources ws
+		LEFT JOIN sentences cs ON cs.id = ws.context_sentence_id
+		LEFT JOIN sentences es ON es.id = ws.example_sentence_id
+		ORDER BY ws.id`, func(rows *sql.Rows) (any, error) {
+		var l dumpLink
+		var ctxText, exText sql.NullString
+		var firstSeen, lastSeen sql.NullTime
+		var isPrimary sql.NullBool
+		if err := rows.Scan(&l.WordID, &l.SourceID, &ctxText, &exText, &l.OccurrenceCount, &firstSeen, &lastSeen, &isPrimary); err != nil {
+			return nil, err
+		}
+		l.ContextSentence, l.ExampleSentence = ctxText.String, exText.String
+		l.FirstSeenAt, l.LastSeenAt = firstSeen.Time, lastSeen.Time
+		l.IsPrimary = isPrimary.Bool
+		return l, nil
+	})
+	if err != nil {
+		return fmt.Errorf("dump links: %w", err)
+	}
+
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+// dumpArray writes the rows of query as a JSON array, one element per line.
+func dumpArray(w io.Writer, db DBExecutor, query string, scan func(*sql.Rows) (any, error)) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	sep := "[\n"
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, sep); err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		sep = ",\n"
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if sep == "[\n" {
+		_, err = io.WriteString(w, "[]")
+	} else {
+		_, err = io.WriteString(w, "\n]")
+	}
+	return err
+}
+
+// ImportDatabase restores a document written by DumpDatabase, decoding its arrays one
+// element at a time. It is meant for an empty database: rows get new ids (links are
+// remapped to them), and rows that collide with existing ones make it fail. Pass a
+// transaction to restore all or nothing.
+func ImportDatabase(db DBExecutor, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	sourceIDs := make(map[int64]int64)
+	wordIDs := make(map[int64]int64)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "version":
+			var v int
+			if err := dec.Decode(&v); err != nil {
+				return fmt.Errorf("read version: %w", err)
+			}
+			if v > DumpVersion {
+				return fmt.Errorf("unsupported dump version %d (this build reads up to %d)", v, DumpVersion)
+			}
+		case "sources":
+			err = importArray(dec, func(s *dumpSource) error {
+				res, err := db.Exec(`INSERT INTO sources (source_type, title, author, website, url, meta, image_url, language, content_hash, last_processed_sentence, total_sentences, added_at)
+					VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), COALESCE(NULLIF(?, ''), ?), NULLIF(?, ''), ?, ?, ?)`,
+					s.SourceType, s.Title, s.Author, s.Website, s.URL, s.Meta, s.ImageURL, s.Language, DefaultLanguage, s.ContentHash, s.LastProcessedSentence, s.TotalSentences, s.AddedAt.UTC())
+				if err != nil {
+					return fmt.Errorf("source %d: %w", s.ID, err)
+				}
+				sourceIDs[s.ID], err = res.LastInsertId()
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("import sources: %w", err)
+			}
+		case "words":
+			err = importArray(dec, func(wd *dumpWord) error {
+				if wd.Status == "" {
+					wd.Status = WordStatusNew
+				}
+				res, err := db.Exec(`INSERT INTO words (word, lemma, language, pronunciation, image_url, mnemonic_text, definitions, gloss_text, status)
+					VALUES (?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?)`,
+					wd.Word, wd.Lemma, wd.Language, wd.Pronunciation, wd.ImageURL, wd.MnemonicText, wd.Definitions, glossText(wd.Definitions), wd.Status)
+				if err != nil {
+					return fmt.Errorf("word %d: %w", wd.ID, err)
+				}
+				wordIDs[wd.ID], err = res.LastInsertId()
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("import words: %w", err)
+			}
+		case "links":
+			err = importArray(dec, func(l *dumpLink) error {
+				wordID, ok := wordIDs[l.WordID]
+				if !ok {
+					return fmt.Errorf("link references unknown word %d", l.WordID)
+				}
+				sourceID, ok := sourceIDs[l.SourceID]
+				if !ok {
+					return fmt.Errorf("link references unknown source %d", l.SourceID)
+				}
+				ctxID, err := getOrCreateSentence(db, l.ContextSentence)
+				if err != nil {
+					return err
+				}
+				exID, err := getOrCreateSentence(db, l.ExampleSentence)
+				if err != nil {
+					return err
+				}
+				_, err = db.Exec(`INSERT INTO word_sources (word_id, source_id, context_sentence_id, example_sentence_id, occurrence_count, first_seen_at, last_seen_at, is_primary)
+					VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+					wordID, sourceID, nullableInt64(ctxID), nullableInt64(exID), l.OccurrenceCount, l.FirstSeenAt.UTC(), l.LastSeenAt.UTC(), l.IsPrimary)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("import links: %w", err)
+			}
+		default:
+			// Skip sections added by newer writers.
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// importArray decodes a JSON array from dec, calling fn for each element as it is read.
+func importArray[T any](dec *json.Decoder, fn func(*T) error) error {
+	if err := expectDelim(dec, '['); err != nil {
+		return err
+	}
+	for dec.More() {
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, ']')
+}
+
+// expectDelim reads the next token from dec and fails unless it is want.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("malformed dump: expected %q, got %v", want, tok)
+	}
+	return nil
+}
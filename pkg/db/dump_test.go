@@ -0,0 +1,123 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDumpImportRoundTrip(t *testing.T) {
+	src := setupTestDB(t)
+	defer src.Close()
+
+	articleID, err := CreateOrGetSource(src, "website_article", "猫の記事", "著者", "example.com", "https://example.com/cat", `{"difficulty":2}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bookID, err := CreateOrGetSource(src, "epub", "本", "", "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSourceTotalSentences(src, articleID, 12); err != nil {
+		t.Fatal(err)
+	}
+	catID, err := CreateOrGetWord(src, "猫", "猫", "ねこ", `[{"senses":["cat"],"pos":["n"]}]`, "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dogID, err := CreateOrGetWord(src, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetWordStatus(src, catID, WordStatusKnown); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []struct {
+		word, source int64
+		ctx          string
+	}{{catID, articleID, "猫が好き。"}, {catID, bookID, "猫と犬。"}, {dogID, bookID, "猫と犬。"}} {
+		if err := LinkWordToSource(src, l.word, l.source, l.ctx, l.ctx, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := SetPrimarySource(src, catID, bookID); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := DumpDatabase(src, &buf); err != nil {
+		t.Fatalf("DumpDatabase: %v", err)
+	}
+	var doc struct {
+		Version int               `json:"version"`
+		Sources []json.RawMessage `json:"sources"`
+		Words   []json.RawMessage `json:"words"`
+		Links   []json.RawMessage `json:"links"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("dump is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if doc.Version != DumpVersion || len(doc.Sources) != 2 || len(doc.Words) != 2 || len(doc.Links) != 3 {
+		t.Fatalf("unexpected dump contents: %s", buf.String())
+	}
+
+	dst := setupTestDB(t)
+	defer dst.Close()
+	if err := ImportDatabase(dst, &buf); err != nil {
+		t.Fatalf("ImportDatabase: %v", err)
+	}
+
+	before, err := GetDBStats(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, err := GetDBStats(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Fatalf("stats differ after round trip: before %+v, after %+v", before, after)
+	}
+
+	cat, err := GetWord(dst, "猫", "猫", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat.Pronunciation != "ねこ" || !strings.Contains(cat.Definitions, "cat") {
+		t.Errorf("unexpected restored word %+v", cat)
+	}
+	if matches, err := SearchWordsByGloss(dst, "cat"); err != nil || len(matches) != 1 {
+		t.Errorf("expected the restored definitions to be searchable, got %v (err %v)", matches, err)
+	}
+	var status string
+	if err := dst.QueryRow(`SELECT status FROM words WHERE id = ?`, cat.ID).Scan(&status); err != nil || status != WordStatusKnown {
+		t.Errorf("expected status %q, got %q (err %v)", WordStatusKnown, status, err)
+	}
+	links, err := GetWordSources(dst, cat.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 2 || !links[0].IsPrimary || links[0].ContextSentence != "猫と犬。" || links[0].OccurrenceCount != 2 {
+		t.Errorf("unexpected restored links %+v", links)
+	}
+	if pct, err := GetSourceProgressPercent(dst, links[1].SourceID); err != nil || pct != 0 {
+		t.Errorf("expected the article's sentence total to survive, got %v (err %v)", pct, err)
+	}
+	article, err := GetSource(dst, links[1].SourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if article.Title != "猫の記事" || article.Meta != `{"difficulty":2}` || article.AddedAt.IsZero() {
+		t.Errorf("unexpected restored source %+v", article)
+	}
+}
+
+func TestImportDatabaseRejectsNewerVersion(t *testing.T) {
+	conn := setupTestDB(t)
+	defer conn.Close()
+	err := ImportDatabase(conn, strings.NewReader(`{"version":99,"sources":[],"words":[],"links":[]}`))
+	if err == nil || !strings.Contains(err.Error(), "unsupported dump version") {
+		t.Fatalf("expected a version error, got %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrDatabaseInUse is returned by AcquireLock when another process holds the database lock.
+var ErrDatabaseInUse = errors.New("database in use")
+
+// LockPath returns the advisory lock file used for the database at dbPath.
+func LockPath(dbPath string) string {
+	return dbPath + ".lock"
+}
+
+// AcquireLock takes an advisory, process-wide lock on the database file at dbPath so two
+// readerer processes cannot interleave writes and progress checkpoints. It returns a
+// function that releases the lock. If another process holds it, the error wraps
+// ErrDatabaseInUse. In-memory databases are not locked.
+func AcquireLock(dbPath string) (release func() error, err error) {
+	if dbPath == "" || dbPath == ":memory:" {
+		return func() error { return nil }, nil
+	}
+	release, err = lockFile(LockPath(dbPath))
+	if errors.Is(err, ErrDatabaseInUse) {
+		return nil, fmt.Errorf("%w: %s is locked by another process (%s)", ErrDatabaseInUse, dbPath, LockPath(dbPath))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock database: %w", err)
+	}
+	return release, nil
+}
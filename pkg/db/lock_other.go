@@ -0,0 +1,23 @@
+//go:build !unix && !windows
+
+package db
+
+import (
+	"os"
+)
+
+// lockFile creates path exclusively and removes it on release. Unlike flock the file
+// survives a crash, so a stale lock has to be cleared by hand (or bypassed with -force).
+func lockFile(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, err
+	}
+	f.Close()
+	return func() error {
+		return os.Remove(path)
+	}, nil
+}
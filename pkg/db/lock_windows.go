@@ -0,0 +1,31 @@
+//go:build windows
+
+package db
+
+import (
+	"syscall"
+)
+
+// errSharingViolation is ERROR_SHARING_VIOLATION, returned when another handle has the
+// file open without sharing.
+const errSharingViolation syscall.Errno = 32
+
+// lockFile opens path with no sharing allowed, so a second process cannot open it until
+// the handle is closed. Windows closes the handle when the process exits, so a crashed
+// run never leaves a stale lock behind.
+func lockFile(path string) (func() error, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		if err == errSharingViolation {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, err
+	}
+	return func() error {
+		return syscall.CloseHandle(h)
+	}, nil
+}
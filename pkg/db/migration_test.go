@@ -2,7 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -69,3 +72,301 @@ func TestInitDBCreatesFinalSchema(t *testing.T) {
 		t.Fatalf("expected sentence_id in word_contexts, got %v", cols2)
 	}
 }
+
+// TestInitDBRebuildsOldSourceSentencesKey upgrades a database whose source_sentences
+// table still has the PRIMARY KEY(source_id, sentence_id) it was first created with.
+func TestInitDBRebuildsOldSourceSentencesKey(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+
+	if _, err := dbConn.Exec(`CREATE TABLE source_sentences (
+		source_id INTEGER NOT NULL,
+		sentence_id INTEGER NOT NULL,
+		PRIMARY KEY(source_id, sentence_id)
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	var pk int
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM pragma_table_info('source_sentences') WHERE pk > 0`).Scan(&pk); err != nil || pk != 0 {
+		t.Fatalf("expected the old primary key to be gone, got %d pk columns (%v)", pk, err)
+	}
+
+	// A sentence repeated at a later position gets its own row again.
+	src, err := CreateOrGetSource(dbConn, "test", "Repeat", "", "", "http://repeat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, text := range []string{"はい。", "いいえ。", "はい。"} {
+		if _, err := RecordSourceSentence(dbConn, src, text, i, 0); err != nil {
+			t.Fatalf("record sentence %d: %v", i, err)
+		}
+	}
+	got, err := ReconstructSource(dbConn, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "はい。\nいいえ。\nはい。" {
+		t.Errorf("expected all three positions after the rebuild, got %q", got)
+	}
+
+	// Running InitDB again leaves the rebuilt table alone.
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+}
+
+// TestInitDBBackfillsGlossText upgrades a database whose words predate gloss_text.
+func TestInitDBBackfillsGlossText(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+
+	if _, err := dbConn.Exec(`CREATE TABLE words (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		word TEXT NOT NULL,
+		lemma TEXT,
+		language TEXT DEFAULT 'und',
+		pronunciation TEXT,
+		image_url TEXT,
+		mnemonic_text TEXT,
+		definitions TEXT,
+		UNIQUE(word, lemma, language)
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbConn.Exec(`INSERT INTO words (word, lemma, language, definitions) VALUES ('犬', '犬', 'ja', '[{"senses":["dog","hound"],"pos":["n"]}]')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+
+	words, err := SearchWordsByGloss(dbConn, "dog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 1 || words[0].Word != "犬" {
+		t.Fatalf("expected the old word to be searchable by gloss, got %+v", words)
+	}
+
+	// The backfill is recorded and not repeated.
+	if _, err := dbConn.Exec(`UPDATE words SET gloss_text = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+	var gloss sql.NullString
+	if err := dbConn.QueryRow(`SELECT gloss_text FROM words`).Scan(&gloss); err != nil || gloss.Valid {
+		t.Fatalf("expected the backfill to run once, got %q (%v)", gloss.String, err)
+	}
+}
+
+// TestInitDBNormalizesLinkTimesToUTC upgrades link times written with a local offset.
+func TestInitDBNormalizesLinkTimesToUTC(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+
+	src, err := CreateOrGetSource(dbConn, "test", "Old", "", "", "http://old", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordID, err := CreateOrGetWord(dbConn, "猫", "猫", "", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 09:30 in Tokyo is 00:30 UTC, inside the window below; as text it sorts after it.
+	tokyo := time.FixedZone("JST", 9*60*60)
+	local := time.Date(2024, 3, 1, 9, 30, 0, 0, tokyo)
+	if _, err := dbConn.Exec(`INSERT INTO word_sources (word_id, source_id, occurrence_count, first_seen_at, last_seen_at) VALUES (?, ?, 1, ?, ?)`,
+		wordID, src, local, local); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dbConn.Exec(`DELETE FROM applied_migrations WHERE name = 'utc_word_source_times'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+
+	words, err := GetWordsFirstSeenBetween(dbConn, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 1, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 1 || words[0].Word != "猫" {
+		t.Fatalf("expected the normalized link inside the window, got %+v", words)
+	}
+	var firstSeen string
+	if err := dbConn.QueryRow(`SELECT CAST(first_seen_at AS TEXT) FROM word_sources`).Scan(&firstSeen); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(firstSeen, "+00:00") {
+		t.Errorf("expected first_seen_at stored in UTC, got %q", firstSeen)
+	}
+}
+
+// TestInitDBNormalizesStoredSentences merges sentences stored before normalizeSentence
+// that differ only in whitespace.
+func TestInitDBNormalizesStoredSentences(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+
+	src, err := CreateOrGetSource(dbConn, "test", "Old", "", "", "http://old", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordID, err := CreateOrGetWord(dbConn, "猫", "猫", "", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int64
+	for _, text := range []string{" 猫が　いる。", "猫が　　いる。\n"} {
+		res, err := dbConn.Exec(`INSERT INTO sentences (text) VALUES (?)`, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+	res, err := dbConn.Exec(`INSERT INTO word_sources (word_id, source_id, context_sentence_id, example_sentence_id, occurrence_count) VALUES (?, ?, ?, ?, 2)`,
+		wordID, src, ids[0], ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	wsID, _ := res.LastInsertId()
+	for i, id := range ids {
+		if _, err := dbConn.Exec(`INSERT INTO word_contexts (word_source_id, sentence_id) VALUES (?, ?)`, wsID, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := dbConn.Exec(`INSERT INTO source_sentences (source_id, sentence_id, ordinal) VALUES (?, ?, ?)`, src, id, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dbConn.Exec(`DELETE FROM applied_migrations WHERE name = 'normalize_sentences'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+
+	var sentences, contexts int
+	var text string
+	if err := dbConn.QueryRow(`SELECT COUNT(*), MAX(text) FROM sentences`).Scan(&sentences, &text); err != nil {
+		t.Fatal(err)
+	}
+	if sentences != 1 || text != "猫が　いる。" {
+		t.Fatalf("expected one normalized sentence, got %d (%q)", sentences, text)
+	}
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM word_contexts`).Scan(&contexts); err != nil || contexts != 1 {
+		t.Fatalf("expected the duplicate contexts merged into one, got %d (%v)", contexts, err)
+	}
+	var ctxID, exID int64
+	if err := dbConn.QueryRow(`SELECT context_sentence_id, example_sentence_id FROM word_sources`).Scan(&ctxID, &exID); err != nil {
+		t.Fatal(err)
+	}
+	if ctxID != exID {
+		t.Errorf("expected context and example to point at the merged sentence, got %d and %d", ctxID, exID)
+	}
+	got, err := ReconstructSource(dbConn, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "猫が　いる。\n猫が　いる。" {
+		t.Errorf("expected both positions to keep the merged sentence, got %q", got)
+	}
+}
+
+// TestInitDBNormalizesSourceTitles upgrades titles stored before NFKC normalization, so a
+// re-crawl with a half-width title finds the old source.
+func TestInitDBNormalizesSourceTitles(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+
+	res, err := dbConn.Exec(`INSERT INTO sources (source_type, title, author, url) VALUES ('website_article', '猫の話　第１回', ' 夏目　漱石 ', 'http://cat')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldID, _ := res.LastInsertId()
+	if _, err := dbConn.Exec(`DELETE FROM applied_migrations WHERE name = 'normalize_source_titles'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+
+	id, created, err := CreateOrGetSourceEx(dbConn, "website_article", "猫の話 第1回", "夏目 漱石", "", "http://cat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || id != oldID {
+		t.Fatalf("expected the re-crawl to find source %d, got %d (created=%v)", oldID, id, created)
+	}
+}
+
+// TestInitDBNormalizesSourceTypes maps free-form source types stored before the
+// SourceType constants onto them.
+func TestInitDBNormalizesSourceTypes(t *testing.T) {
+	dbConn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer dbConn.Close()
+	dbConn.SetMaxOpenConns(1)
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+
+	for i, sourceType := range []string{" Website_Article", "test", "epub"} {
+		if _, err := dbConn.Exec(`INSERT INTO sources (source_type, url) VALUES (?, ?)`, sourceType, fmt.Sprintf("http://%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := dbConn.Exec(`DELETE FROM applied_migrations WHERE name = 'normalize_source_types'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitDB(dbConn); err != nil {
+		t.Fatalf("second InitDB failed: %v", err)
+	}
+
+	want := []string{SourceTypeWebsiteArticle, SourceTypeOther, SourceTypeEPUB}
+	for i, w := range want {
+		src, err := GetSource(dbConn, int64(i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.SourceType != w {
+			t.Errorf("source %d: expected type %q, got %q", i+1, w, src.SourceType)
+		}
+	}
+}
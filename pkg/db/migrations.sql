@@ -4,11 +4,13 @@ CREATE TABLE IF NOT EXISTS words (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     word TEXT NOT NULL,
     lemma TEXT,
-    language TEXT DEFAULT 'und',
+    language TEXT DEFAULT 'ja',
     pronunciation TEXT,
     image_url TEXT,
     mnemonic_text TEXT,
     definitions TEXT,
+    gloss_text TEXT,
+    status TEXT NOT NULL DEFAULT 'new',
     UNIQUE(word, lemma, language)
 );
 
@@ -21,6 +23,10 @@ CREATE TABLE IF NOT EXISTS sources (
     url TEXT,
     meta TEXT,
     last_processed_sentence INTEGER DEFAULT -1,
+    total_sentences INTEGER,
+    content_hash TEXT,
+    image_url TEXT,
+    language TEXT DEFAULT 'ja',
     added_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -35,6 +41,17 @@ CREATE TABLE IF NOT EXISTS sentences (
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Which sentences each source contributed and where: one row per position, so the
+-- source text can be rebuilt in order. Used to cap per-source sentence rows.
+CREATE TABLE IF NOT EXISTS source_sentences (
+    source_id INTEGER NOT NULL REFERENCES sources(id) ON DELETE CASCADE,
+    sentence_id INTEGER NOT NULL REFERENCES sentences(id) ON DELETE CASCADE,
+    ordinal INTEGER,
+    UNIQUE(source_id, ordinal)
+);
+
+CREATE INDEX IF NOT EXISTS idx_source_sentences_sentence ON source_sentences(source_id, sentence_id);
+
 CREATE TABLE IF NOT EXISTS word_sources (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
@@ -43,6 +60,7 @@ CREATE TABLE IF NOT EXISTS word_sources (
     example_sentence_id INTEGER REFERENCES sentences(id) ON DELETE SET NULL,
     occurrence_count INTEGER DEFAULT 1,
     first_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     is_primary INTEGER DEFAULT 0,
     UNIQUE(word_id, source_id)
 );
@@ -60,3 +78,33 @@ CREATE TABLE IF NOT EXISTS word_contexts (
 
 CREATE INDEX IF NOT EXISTS idx_word_contexts_ws_id ON word_contexts(word_source_id);
 
+-- Free-form study notes attached to a word, oldest first.
+CREATE TABLE IF NOT EXISTS word_notes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    word_id INTEGER NOT NULL REFERENCES words(id) ON DELETE CASCADE,
+    note TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_word_notes_word_id ON word_notes(word_id);
+
+-- URLs whose last processing attempt failed (or that failed before succeeding), for retries.
+CREATE TABLE IF NOT EXISTS source_errors (
+    url TEXT PRIMARY KEY,
+    status TEXT NOT NULL,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_attempt_at DATETIME
+);
+
+-- Resume positions for long-running maintenance jobs (e.g. dictionary import).
+CREATE TABLE IF NOT EXISTS checkpoints (
+    name TEXT PRIMARY KEY,
+    position INTEGER NOT NULL
+);
+
+-- One-time data migrations InitDB has applied (see runOnce), by name.
+CREATE TABLE IF NOT EXISTS applied_migrations (
+    name TEXT PRIMARY KEY,
+    applied_at DATETIME
+);
@@ -15,6 +15,27 @@ type Word struct {
 	Definitions string
 }
 
+// Learning statuses stored in words.status.
+const (
+	WordStatusNew      = "new"
+	WordStatusLearning = "learning"
+	WordStatusKnown    = "known"
+)
+
+// DefaultLanguage is the language of sources (and their words) unless set otherwise.
+const DefaultLanguage = "ja"
+
+// Known source types stored in sources.source_type. Anything else is stored as
+// SourceTypeOther; see NormalizeSourceType.
+const (
+	SourceTypeWebsiteArticle = "website_article"
+	SourceTypeFile           = "file"
+	SourceTypeEPUB           = "epub"
+	SourceTypeSubtitles      = "srt"
+	SourceTypePlainText      = "plain_text"
+	SourceTypeOther          = "other"
+)
+
 // Source is a provenance record for where a word was seen.
 type Source struct {
 	ID         int64
@@ -24,7 +45,11 @@ type Source struct {
 	Website    string
 	URL        string
 	Meta       string
-	AddedAt    time.Time
+	// ImageURL is the article's lead image (e.g. og:image), used as a thumbnail.
+	ImageURL string
+	// Language is the source's language code, also given to the words ingested from it.
+	Language string
+	AddedAt  time.Time
 }
 
 // WordSource links a Word with a Source and holds contextual metadata.
@@ -36,5 +61,69 @@ type WordSource struct {
 	ExampleSentence string
 	OccurrenceCount int
 	FirstSeenAt     time.Time
-	IsPrimary       bool
+	// LastSeenAt is when the word was most recently linked to the source.
+	LastSeenAt time.Time
+	IsPrimary  bool
+}
+
+// WordFrequency pairs a word with the number of times it occurred.
+type WordFrequency struct {
+	Word  Word
+	Count int
+	// Status is the word's learning status (WordStatusNew, ...).
+	Status string
+	// Score is Count weighted by recency; only set by GetWordFrequenciesByRecency.
+	Score float64
+	// Example is the word's best example sentence across its sources (see BestExample);
+	// only set by export.FillExamples.
+	Example string
+}
+
+// SourceWithWords is a source with its most frequent words, as returned by
+// GetRecentSourcesWithTopWords.
+type SourceWithWords struct {
+	Source Source
+	// Words are the source's words, most frequent in it first.
+	Words []WordFrequency
+}
+
+// WordNote is a timestamped free-form note on a word.
+type WordNote struct {
+	ID        int64
+	WordID    int64
+	Note      string
+	CreatedAt time.Time
+}
+
+// SourceError tracks processing failures of a URL so it can be retried later.
+type SourceError struct {
+	URL string
+	// Status is SourceStatusFailed or SourceStatusSucceeded.
+	Status string
+	// Error is the message of the most recent failure.
+	Error string
+	// Attempts counts every attempt since the first failure, including the successful one.
+	Attempts      int
+	LastAttemptAt time.Time
+}
+
+// Statuses of a SourceError.
+const (
+	SourceStatusFailed    = "failed"
+	SourceStatusSucceeded = "succeeded"
+)
+
+// WordReading is a distinct word/reading pair, e.g. for generating study audio.
+type WordReading struct {
+	Word    string
+	Reading string
+}
+
+// DBStats holds top-line totals for the whole database.
+type DBStats struct {
+	Sources     int
+	Words       int
+	Links       int // word-source pairs
+	Sentences   int
+	Occurrences int // sum of occurrence counts over all links
 }
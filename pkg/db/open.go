@@ -0,0 +1,117 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Defaults applied by Open to file databases.
+const (
+	DefaultMaxOpenConns = 4
+	DefaultCacheSizeKiB = 64 * 1024         // 64 MiB page cache per connection
+	DefaultMmapSize     = 256 * 1024 * 1024 // 256 MiB
+	DefaultBusyTimeout  = 5000              // milliseconds
+)
+
+// Options tunes the pool and per-connection PRAGMAs set by Open. Zero fields take the
+// defaults for the kind of database being opened.
+type Options struct {
+	// MaxOpenConns caps the connection pool. In-memory databases always use a single
+	// connection, since every connection would otherwise see its own empty database.
+	// 0 means DefaultMaxOpenConns.
+	MaxOpenConns int
+	// CacheSizeKiB sets PRAGMA cache_size for file databases. 0 means DefaultCacheSizeKiB.
+	CacheSizeKiB int
+	// MmapSize sets PRAGMA mmap_size (bytes) for file databases. 0 means DefaultMmapSize;
+	// a negative value disables memory-mapped I/O.
+	MmapSize int64
+	// BusyTimeout is how long (milliseconds) a connection waits for another one's write
+	// lock before failing with SQLITE_BUSY. 0 means DefaultBusyTimeout.
+	BusyTimeout int
+}
+
+// isMemoryPath reports whether path names an in-memory database.
+func isMemoryPath(path string) bool {
+	return path == "" || path == ":memory:" || strings.Contains(path, "mode=memory") || strings.HasPrefix(path, "file::memory:")
+}
+
+// pragmas returns the statements run on every new connection to path.
+func (o Options) pragmas(path string) []string {
+	// foreign_keys is per connection, so setting it once in InitDB is not enough for a pool.
+	stmts := []string{"PRAGMA foreign_keys = ON", "PRAGMA temp_store = MEMORY"}
+	if isMemoryPath(path) {
+		return stmts
+	}
+	cache := o.CacheSizeKiB
+	if cache <= 0 {
+		cache = DefaultCacheSizeKiB
+	}
+	mmap := o.MmapSize
+	switch {
+	case mmap == 0:
+		mmap = DefaultMmapSize
+	case mmap < 0:
+		mmap = 0
+	}
+	busy := o.BusyTimeout
+	if busy <= 0 {
+		busy = DefaultBusyTimeout
+	}
+	// A negative cache_size is in KiB rather than pages.
+	return append(stmts,
+		fmt.Sprintf("PRAGMA cache_size = -%d", cache),
+		fmt.Sprintf("PRAGMA mmap_size = %d", mmap),
+		fmt.Sprintf("PRAGMA busy_timeout = %d", busy),
+	)
+}
+
+// connector opens SQLite connections through a driver whose ConnectHook applies the
+// PRAGMAs, so every pooled connection is configured, not just the first.
+type connector struct {
+	dsn    string
+	driver *sqlite3.SQLiteDriver
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+
+func (c connector) Driver() driver.Driver { return c.driver }
+
+// Open opens the SQLite database at path (":memory:" for an in-memory one) with a pool
+// and PRAGMAs suited to it: file databases get a larger page cache, memory-mapped I/O, a
+// busy timeout and in-memory temp storage; in-memory databases are limited to one
+// connection. It checks the database can be opened but does not run InitDB.
+func Open(path string, opts Options) (*sql.DB, error) {
+	stmts := opts.pragmas(path)
+	drv := &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			for _, stmt := range stmts {
+				if _, err := conn.Exec(stmt, nil); err != nil {
+					return fmt.Errorf("%s: %w", stmt, err)
+				}
+			}
+			return nil
+		},
+	}
+	conn := sql.OpenDB(connector{dsn: path, driver: drv})
+
+	maxConns := opts.MaxOpenConns
+	if maxConns <= 0 {
+		maxConns = DefaultMaxOpenConns
+	}
+	if isMemoryPath(path) {
+		maxConns = 1
+	}
+	conn.SetMaxOpenConns(maxConns)
+	conn.SetMaxIdleConns(maxConns)
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	return conn, nil
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAppliesPragmasToFileDB(t *testing.T) {
+	conn, err := Open(filepath.Join(t.TempDir(), "pragmas.db"), Options{CacheSizeKiB: 2048})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+	if err := InitDB(conn); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if got := conn.Stats().MaxOpenConnections; got != DefaultMaxOpenConns {
+		t.Fatalf("expected a pool of %d, got %d", DefaultMaxOpenConns, got)
+	}
+
+	// Hold two connections at once so both are checked, not just the first.
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		for pragma, want := range map[string]int64{
+			"cache_size":   -2048,
+			"temp_store":   2, // MEMORY
+			"mmap_size":    DefaultMmapSize,
+			"busy_timeout": DefaultBusyTimeout,
+			"foreign_keys": 1,
+		} {
+			var got int64
+			if err := c.QueryRowContext(ctx, "PRAGMA "+pragma).Scan(&got); err != nil {
+				t.Fatalf("connection %d: PRAGMA %s: %v", i, pragma, err)
+			}
+			if got != want {
+				t.Errorf("connection %d: PRAGMA %s = %d, want %d", i, pragma, got, want)
+			}
+		}
+	}
+}
+
+func TestOpenMemoryDBUsesOneConnection(t *testing.T) {
+	conn, err := Open(":memory:", Options{MaxOpenConns: 8})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer conn.Close()
+	if got := conn.Stats().MaxOpenConnections; got != 1 {
+		t.Fatalf("expected in-memory databases to use one connection, got %d", got)
+	}
+	if err := InitDB(conn); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if _, err := CreateOrGetSource(conn, "test", "t", "", "", "", ""); err != nil {
+		t.Fatalf("expected the schema to be visible: %v", err)
+	}
+}
@@ -2,9 +2,15 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
 	"strings"
 	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
 )
 
 // DBExecutor is an interface that allows methods to accept either *sql.DB or *sql.Tx
@@ -31,42 +37,112 @@ func CreateOrGetWord(db DBExecutor, word, lemma, reading, definitions, language
 	}
 
 	var id int64
-	query := `INSERT INTO words (word, lemma, pronunciation, definitions, language) 
-			  VALUES (?, ?, ?, ?, ?)
+	query := `INSERT INTO words (word, lemma, pronunciation, definitions, gloss_text, language) 
+			  VALUES (?, ?, ?, ?, ?, ?)
 			  ON CONFLICT(word, lemma, language) 
 			  DO UPDATE SET 
 			    pronunciation = COALESCE(NULLIF(excluded.pronunciation, ''), words.pronunciation),
-				definitions = COALESCE(NULLIF(excluded.definitions, ''), words.definitions)
-			  RETURNING id`
+				definitions = COALESCE(NULLIF(excluded.definitions, ''), words.definitions),
+				gloss_text = COALESCE(NULLIF(excluded.gloss_text, ''), words.gloss_text)`
+	args := []interface{}{trimmedWord, lemma, reading, definitions, glossText(definitions), language}
 
-	err := db.QueryRow(query, trimmedWord, lemma, reading, definitions, language).Scan(&id)
+	returning, err := supportsReturning(db)
 	if err != nil {
+		return 0, err
+	}
+	if !returning {
+		// LastInsertId is not updated when the upsert takes the DO UPDATE branch, so
+		// look the row up by its unique key instead.
+		if _, err := db.Exec(query, args...); err != nil {
+			return 0, fmt.Errorf("upsert word: %w", err)
+		}
+		if err := db.QueryRow(`SELECT id FROM words WHERE word = ? AND lemma = ? AND language = ?`, trimmedWord, lemma, language).Scan(&id); err != nil {
+			return 0, fmt.Errorf("get upserted word id: %w", err)
+		}
+		return id, nil
+	}
+
+	if err := db.QueryRow(query+" RETURNING id", args...).Scan(&id); err != nil {
 		return 0, fmt.Errorf("upsert word: %w", err)
 	}
 	return id, nil
 }
 
+// normalizeSourceText applies NFKC (folding full-width letters, digits and spaces to their
+// ASCII forms) and collapses runs of whitespace, so re-crawled titles dedupe reliably.
+func normalizeSourceText(s string) string {
+	return strings.Join(strings.Fields(norm.NFKC.String(s)), " ")
+}
+
+// NormalizeSourceType maps sourceType to one of the SourceType constants, ignoring case
+// and surrounding space. Unknown values become SourceTypeOther.
+func NormalizeSourceType(sourceType string) string {
+	t := strings.ToLower(strings.TrimSpace(sourceType))
+	switch t {
+	case SourceTypeWebsiteArticle, SourceTypeFile, SourceTypeEPUB, SourceTypeSubtitles, SourceTypePlainText:
+		return t
+	default:
+		return SourceTypeOther
+	}
+}
+
+// SourceRetries is how many times CreateOrGetSource looks up and inserts a source before
+// giving up, when each insert loses a unique-constraint race to a concurrent writer.
+// Raise it for heavily parallel ingestion of many sources.
+var SourceRetries = 3
+
+// SourceRetryBackoff is the delay before CreateOrGetSource's second attempt; each later
+// attempt waits one more multiple of it. Calls made inside a transaction retry without
+// waiting, so the caller's locks are not held while sleeping; retrying the whole
+// transaction is up to the caller.
+var SourceRetryBackoff = 2 * time.Millisecond
+
+// inTransaction reports whether db is a transaction (or wraps one), judged by whether it
+// can be committed.
+func inTransaction(db DBExecutor) bool {
+	_, ok := db.(interface{ Commit() error })
+	return ok
+}
+
 // CreateOrGetSource returns existing source id or inserts a new source and returns its id.
+// sourceType is normalized with NormalizeSourceType; title and author are NFKC-normalized
+// and whitespace-collapsed before matching and storing.
 func CreateOrGetSource(db DBExecutor, sourceType, title, author, website, url, meta string) (int64, error) {
-	trimmedSourceType := strings.TrimSpace(sourceType)
-	if trimmedSourceType == "" {
-		return 0, fmt.Errorf("sourceType must be non-empty")
+	id, _, err := CreateOrGetSourceEx(db, sourceType, title, author, website, url, meta)
+	return id, err
+}
+
+// CreateOrGetSourceEx is CreateOrGetSource but also reports whether the source was newly
+// inserted (false when an existing row matched, including one inserted concurrently).
+func CreateOrGetSourceEx(db DBExecutor, sourceType, title, author, website, url, meta string) (id int64, created bool, err error) {
+	if strings.TrimSpace(sourceType) == "" {
+		return 0, false, fmt.Errorf("sourceType must be non-empty")
 	}
+	trimmedSourceType := NormalizeSourceType(sourceType)
+	title = normalizeSourceText(title)
+	author = normalizeSourceText(author)
 
-	const maxRetries = 3
+	maxRetries := SourceRetries
+	if maxRetries < 1 {
+		maxRetries = 1
+	}
 
-	var id int64
+	backoff := !inTransaction(db)
 	for attempt := 0; attempt < maxRetries; attempt++ {
+		if attempt > 0 && backoff {
+			// Give the concurrent writer that won the race time to commit.
+			time.Sleep(time.Duration(attempt) * SourceRetryBackoff)
+		}
 		// First, try to find an existing source.
 		err := db.QueryRow(
 			`SELECT id FROM sources WHERE IFNULL(url, '') = ? AND IFNULL(title, '') = ? AND IFNULL(author, '') = ?`,
 			url, title, author,
 		).Scan(&id)
 		if err == nil {
-			return id, nil
+			return id, false, nil
 		}
 		if err != sql.ErrNoRows {
-			return 0, err
+			return 0, false, err
 		}
 
 		// No existing row; try to insert one.
@@ -79,20 +155,173 @@ func CreateOrGetSource(db DBExecutor, sourceType, title, author, website, url, m
 			if isUniqueConstraintErr(err) {
 				continue
 			}
-			return 0, err
+			return 0, false, err
 		}
 
 		// Insert succeeded; return the id directly
-		return res.LastInsertId()
+		id, err = res.LastInsertId()
+		return id, err == nil, err
 	}
 
 	// If we've exhausted all retries, return an error
-	return 0, fmt.Errorf("could not create or get source after %d retries", maxRetries)
+	return 0, false, fmt.Errorf("could not create or get source after %d retries", maxRetries)
 }
 
-// LinkWordToSource links the word and source, creating or updating an entry in word_sources.
+// sourceColumns is the column list read by scanSource.
+const sourceColumns = `id, source_type, title, author, website, url, meta, image_url, language, added_at`
+
+// GetSource returns the source with the given id, or sql.ErrNoRows if it does not exist.
+func GetSource(db DBExecutor, sourceID int64) (Source, error) {
+	return scanSource(db.QueryRow(`SELECT `+sourceColumns+` FROM sources WHERE id = ?`, sourceID))
+}
+
+// GetSourcesByAuthor returns every source whose author matches author after the same
+// NFKC and whitespace normalization CreateOrGetSource applies, oldest first.
+func GetSourcesByAuthor(db DBExecutor, author string) ([]Source, error) {
+	author = normalizeSourceText(author)
+	if author == "" {
+		return nil, fmt.Errorf("author must be non-empty")
+	}
+	rows, err := db.Query(`SELECT `+sourceColumns+` FROM sources WHERE author = ? ORDER BY id`, author)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Source
+	for rows.Next() {
+		src, err := scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, src)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scanSource scans sourceColumns, tolerating NULLs.
+func scanSource(r rowScanner) (Source, error) {
+	var src Source
+	var title, author, website, url, meta, imageURL, language sql.NullString
+	var addedAt sql.NullTime
+	if err := r.Scan(&src.ID, &src.SourceType, &title, &author, &website, &url, &meta, &imageURL, &language, &addedAt); err != nil {
+		return Source{}, err
+	}
+	src.Title = title.String
+	src.Author = author.String
+	src.Website = website.String
+	src.URL = url.String
+	src.Meta = meta.String
+	src.ImageURL = imageURL.String
+	src.Language = language.String
+	if src.Language == "" {
+		src.Language = DefaultLanguage
+	}
+	src.AddedAt = addedAt.Time
+	return src, nil
+}
+
+// GetSourceMeta returns the raw metadata stored for a source ("" if none was set).
+func GetSourceMeta(db DBExecutor, sourceID int64) (string, error) {
+	var meta sql.NullString
+	if err := db.QueryRow(`SELECT meta FROM sources WHERE id = ?`, sourceID).Scan(&meta); err != nil {
+		return "", err
+	}
+	return meta.String, nil
+}
+
+// SetSourceMeta replaces the metadata stored for a source.
+func SetSourceMeta(db DBExecutor, sourceID int64, meta string) error {
+	res, err := db.Exec(`UPDATE sources SET meta = ? WHERE id = ?`, meta, sourceID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("source %d not found", sourceID)
+	}
+	return nil
+}
+
+// GetSourceImage returns the lead image URL stored for a source ("" if none was set).
+// It is unrelated to the per-word image_url.
+func GetSourceImage(db DBExecutor, sourceID int64) (string, error) {
+	var imageURL sql.NullString
+	if err := db.QueryRow(`SELECT image_url FROM sources WHERE id = ?`, sourceID).Scan(&imageURL); err != nil {
+		return "", err
+	}
+	return imageURL.String, nil
+}
+
+// SetSourceImage records the lead image URL of a source.
+func SetSourceImage(db DBExecutor, sourceID int64, imageURL string) error {
+	res, err := db.Exec(`UPDATE sources SET image_url = ? WHERE id = ?`, imageURL, sourceID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("source %d not found", sourceID)
+	}
+	return nil
+}
+
+// GetSourceLanguage returns the language of a source (DefaultLanguage if none was set).
+func GetSourceLanguage(db DBExecutor, sourceID int64) (string, error) {
+	var language sql.NullString
+	if err := db.QueryRow(`SELECT language FROM sources WHERE id = ?`, sourceID).Scan(&language); err != nil {
+		return "", err
+	}
+	if language.String == "" {
+		return DefaultLanguage, nil
+	}
+	return language.String, nil
+}
+
+// SetSourceLanguage sets the language of a source. Words ingested from it afterwards are
+// stored under this language.
+func SetSourceLanguage(db DBExecutor, sourceID int64, language string) error {
+	res, err := db.Exec(`UPDATE sources SET language = ? WHERE id = ?`, language, sourceID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("source %d not found", sourceID)
+	}
+	return nil
+}
+
+// normalizeSentence trims text and collapses each run of internal whitespace to its first
+// character, so contexts that differ only in layout are stored as one sentence. Keeping
+// that character preserves meaningful spacing such as a full-width space (U+3000) in
+// Japanese text.
+func normalizeSentence(text string) string {
+	var b strings.Builder
+	inSpace := false
+	for _, r := range strings.TrimSpace(text) {
+		if unicode.IsSpace(r) {
+			if inSpace {
+				continue
+			}
+			inSpace = true
+		} else {
+			inSpace = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// getOrCreateSentence returns the id of the normalized text in sentences, inserting it if
+// needed. Blank text gives id 0.
 func getOrCreateSentence(db DBExecutor, text string) (int64, error) {
-	trimmed := strings.TrimSpace(text)
+	trimmed := normalizeSentence(text)
 	if trimmed == "" {
 		return 0, nil
 	}
@@ -137,18 +366,39 @@ func LinkWordToSource(db DBExecutor, wordID, sourceID int64, context, example st
 	}
 
 	// Use SQLite UPSERT to atomically insert or update occurrence_count and sentence ids
+	// first_seen_at is only set on insert; last_seen_at advances on every link.
+	// Times are stored in UTC so range queries can compare them as text.
 	var wordSourceID int64
-	err = db.QueryRow(`INSERT INTO word_sources (word_id, source_id, context_sentence_id, example_sentence_id, occurrence_count, first_seen_at)
-	VALUES (?, ?, ?, ?, ?, ?)
+	now := time.Now().UTC()
+	query := `INSERT INTO word_sources (word_id, source_id, context_sentence_id, example_sentence_id, occurrence_count, first_seen_at, last_seen_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
 	ON CONFLICT(word_id, source_id) DO UPDATE SET
 	  occurrence_count = word_sources.occurrence_count + excluded.occurrence_count,
-	  context_sentence_id = excluded.context_sentence_id,
-	  example_sentence_id = excluded.example_sentence_id
-	RETURNING id`, wordID, sourceID, nullableInt64(ctxID), nullableInt64(exID), incrementAmount, time.Now()).Scan(&wordSourceID)
+	  context_sentence_id = COALESCE(excluded.context_sentence_id, word_sources.context_sentence_id),
+	  example_sentence_id = COALESCE(excluded.example_sentence_id, word_sources.example_sentence_id),
+	  last_seen_at = excluded.last_seen_at`
+	args := []interface{}{wordID, sourceID, nullableInt64(ctxID), nullableInt64(exID), incrementAmount, now, now}
+	returning, err := supportsReturning(db)
+	if err != nil {
+		return err
+	}
+	if !returning {
+		if _, err := db.Exec(query, args...); err != nil {
+			return err
+		}
+		err = db.QueryRow(`SELECT id FROM word_sources WHERE word_id = ? AND source_id = ?`, wordID, sourceID).Scan(&wordSourceID)
+	} else {
+		err = db.QueryRow(query+"\n\tRETURNING id", args...).Scan(&wordSourceID)
+	}
 	if err != nil {
 		return err
 	}
 
+	if ctxID == 0 {
+		// No context sentence (e.g. capped by MaxSentencesPerSource); only the count changes.
+		return nil
+	}
+
 	// Limit stored contexts to 5 per word-source pair
 	// Atomic insert using INSERT ... SELECT ... WHERE count < 5
 	_, err = db.Exec(`
@@ -161,6 +411,108 @@ func LinkWordToSource(db DBExecutor, wordID, sourceID int64, context, example st
 	return err
 }
 
+// RecordSourceSentence registers text as the sentence at position ordinal of sourceID.
+// Once the source has maxSentences distinct sentences (0 means no limit), new sentences
+// are refused: nothing is stored and ok is false. Sentences the source already
+// contributed are always accepted. Recording the same ordinal again is a no-op.
+func RecordSourceSentence(db DBExecutor, sourceID int64, text string, ordinal, maxSentences int) (ok bool, err error) {
+	trimmed := normalizeSentence(text)
+	if trimmed == "" {
+		return false, nil
+	}
+	known, err := SourceHasSentence(db, sourceID, trimmed)
+	if err != nil {
+		return false, err
+	}
+	if !known && maxSentences > 0 {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(DISTINCT sentence_id) FROM source_sentences WHERE source_id = ?`, sourceID).Scan(&n); err != nil {
+			return false, err
+		}
+		if n >= maxSentences {
+			return false, nil
+		}
+	}
+	sentenceID, err := getOrCreateSentence(db, trimmed)
+	if err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(`INSERT OR IGNORE INTO source_sentences (source_id, sentence_id, ordinal) VALUES (?, ?, ?)`, sourceID, sentenceID, ordinal); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SourceHasSentence reports whether text was recorded as a sentence of sourceID.
+func SourceHasSentence(db DBExecutor, sourceID int64, text string) (bool, error) {
+	var exists int
+	err := db.QueryRow(`SELECT 1 FROM source_sentences ss JOIN sentences s ON s.id = ss.sentence_id
+		WHERE ss.source_id = ? AND s.text = ? LIMIT 1`, sourceID, normalizeSentence(text)).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetWordSourceExample returns the example sentence stored for a word in a source, or ""
+// if the pair is not linked or has no example.
+func GetWordSourceExample(db DBExecutor, wordID, sourceID int64) (string, error) {
+	var text sql.NullString
+	err := db.QueryRow(`SELECT s.text FROM word_sources ws JOIN sentences s ON s.id = ws.example_sentence_id
+		WHERE ws.word_id = ? AND ws.source_id = ?`, wordID, sourceID).Scan(&text)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return text.String, err
+}
+
+// ClearSourceSentences forgets which sentences a source contributed, e.g. before
+// re-ingesting changed content. The sentences themselves are kept.
+func ClearSourceSentences(db DBExecutor, sourceID int64) error {
+	_, err := db.Exec(`DELETE FROM source_sentences WHERE source_id = ?`, sourceID)
+	return err
+}
+
+// ResetSourceIngestion undoes what ingesting a source has written so it can be ingested
+// again from the start without double counting: its progress, sentence order and word
+// links (with their contexts) are removed. Words themselves are kept, even if no other
+// source links them; see PruneWordsBelowFrequency.
+func ResetSourceIngestion(db DBExecutor, sourceID int64) error {
+	if err := UpdateSourceProgress(db, sourceID, -1); err != nil {
+		return fmt.Errorf("failed to reset progress: %w", err)
+	}
+	if err := ClearSourceSentences(db, sourceID); err != nil {
+		return fmt.Errorf("failed to reset sentence order: %w", err)
+	}
+	if _, err := db.Exec(`DELETE FROM word_sources WHERE source_id = ?`, sourceID); err != nil {
+		return fmt.Errorf("failed to remove word links: %w", err)
+	}
+	return nil
+}
+
+// ReconstructSource rebuilds a source's text from its recorded sentences in their
+// original order, one sentence per line. Sentences dropped by a per-source cap are missing.
+func ReconstructSource(db DBExecutor, sourceID int64) (string, error) {
+	rows, err := db.Query(`SELECT s.text FROM source_sentences ss JOIN sentences s ON s.id = ss.sentence_id
+		WHERE ss.source_id = ? AND ss.ordinal IS NOT NULL ORDER BY ss.ordinal`, sourceID)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	var lines []string
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return "", err
+		}
+		lines = append(lines, text)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
 // nullableInt64 returns nil for 0 (meaning no sentence) else the value.
 func nullableInt64(v int64) interface{} {
 	if v == 0 {
@@ -174,10 +526,90 @@ func UpdateWordDefinitions(db DBExecutor, wordID int64, definitions string) erro
 	if wordID <= 0 {
 		return fmt.Errorf("wordID must be positive")
 	}
-	_, err := db.Exec(`UPDATE words SET definitions = ? WHERE id = ?`, definitions, wordID)
+	_, err := db.Exec(`UPDATE words SET definitions = ?, gloss_text = ? WHERE id = ?`, definitions, glossText(definitions), wordID)
 	return err
 }
 
+// glossText derives the LIKE-searchable gloss_text value from a definitions string: the
+// glosses of every entry joined with ", ". Values that are not definitions JSON (see
+// dictionary.FormatDefinitions) are stored as-is.
+func glossText(definitions string) string {
+	trimmed := strings.TrimSpace(definitions)
+	if trimmed == "" {
+		return ""
+	}
+	var defs []struct {
+		Senses []string `json:"senses"`
+	}
+	if err := json.Unmarshal([]byte(trimmed), &defs); err != nil {
+		return trimmed
+	}
+	var glosses []string
+	for _, d := range defs {
+		glosses = append(glosses, d.Senses...)
+	}
+	return strings.Join(glosses, ", ")
+}
+
+// SearchWordsByGloss returns words whose glosses contain term (case-insensitive for ASCII).
+// It is a simple LIKE scan over gloss_text rather than a full-text index.
+func SearchWordsByGloss(db DBExecutor, term string) ([]Word, error) {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return nil, fmt.Errorf("search term must be non-empty")
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	rows, err := db.Query(`SELECT id, word, lemma, language, pronunciation, image_url, mnemonic_text, definitions FROM words WHERE gloss_text LIKE ? ESCAPE '\' ORDER BY word`, "%"+escaped+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Word
+	for rows.Next() {
+		w, err := scanWord(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetWordStatus records the learner's status for a word (WordStatusNew, WordStatusLearning
+// or WordStatusKnown).
+func SetWordStatus(db DBExecutor, wordID int64, status string) error {
+	switch status {
+	case WordStatusNew, WordStatusLearning, WordStatusKnown:
+	default:
+		return fmt.Errorf("unknown word status %q", status)
+	}
+	res, err := db.Exec(`UPDATE words SET status = ? WHERE id = ?`, status, wordID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("word %d not found", wordID)
+	}
+	return nil
+}
+
+// SourceCoverage returns how many of a source's word occurrences belong to words marked
+// WordStatusKnown, and the source's total occurrences. known/total estimates how much of
+// the text the learner can already read; both are 0 for a source with no words.
+func SourceCoverage(db DBExecutor, sourceID int64) (knownOccurrences, totalOccurrences int, err error) {
+	err = db.QueryRow(`SELECT
+			COALESCE(SUM(CASE WHEN w.status = ? THEN ws.occurrence_count ELSE 0 END), 0),
+			COALESCE(SUM(ws.occurrence_count), 0)
+		FROM word_sources ws JOIN words w ON w.id = ws.word_id
+		WHERE ws.source_id = ?`, WordStatusKnown, sourceID).Scan(&knownOccurrences, &totalOccurrences)
+	return knownOccurrences, totalOccurrences, err
+}
+
 // GetWordsBySource returns words associated with a given source id.
 func GetWordsBySource(db DBExecutor, sourceID int64) ([]Word, error) {
 	rows, err := db.Query(`SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions FROM words w JOIN word_sources ws ON ws.word_id = w.id WHERE ws.source_id = ?`, sourceID)
@@ -187,32 +619,315 @@ func GetWordsBySource(db DBExecutor, sourceID int64) ([]Word, error) {
 	defer rows.Close()
 	var out []Word
 	for rows.Next() {
-		var w Word
-		var lemma, lang sql.NullString
-		var pron, img, mn sql.NullString
-		var defs sql.NullString
-		if err := rows.Scan(&w.ID, &w.Word, &lemma, &lang, &pron, &img, &mn, &defs); err != nil {
+		w, err := scanWord(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddWordNote attaches a note to a word.
+func AddWordNote(db DBExecutor, wordID int64, note string) error {
+	if strings.TrimSpace(note) == "" {
+		return fmt.Errorf("note must not be empty")
+	}
+	if err := requireWord(db, wordID); err != nil {
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO word_notes (word_id, note, created_at) VALUES (?, ?, ?)`, wordID, note, time.Now().UTC())
+	return err
+}
+
+// GetWordNotes returns a word's notes, oldest first.
+func GetWordNotes(db DBExecutor, wordID int64) ([]WordNote, error) {
+	rows, err := db.Query(`SELECT id, word_id, note, created_at FROM word_notes WHERE word_id = ? ORDER BY created_at, id`, wordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WordNote
+	for rows.Next() {
+		var n WordNote
+		var createdAt sql.NullTime
+		if err := rows.Scan(&n.ID, &n.WordID, &n.Note, &createdAt); err != nil {
+			return nil, err
+		}
+		n.CreatedAt = createdAt.Time
+		out = append(out, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetWordsFirstSeenBetween returns the words whose earliest link to any source has
+// first_seen_at in [start, end), ordered by that time.
+func GetWordsFirstSeenBetween(db DBExecutor, start, end time.Time) ([]Word, error) {
+	rows, err := db.Query(`SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions
+	FROM words w
+	JOIN (SELECT word_id, MIN(first_seen_at) AS first_seen FROM word_sources GROUP BY word_id) f ON f.word_id = w.id
+	WHERE f.first_seen >= ? AND f.first_seen < ?
+	ORDER BY f.first_seen, w.id`, start.UTC(), end.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Word
+	for rows.Next() {
+		w, err := scanWord(rows)
+		if err != nil {
 			return nil, err
 		}
-		if lemma.Valid {
-			w.Lemma = lemma.String
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetWordsBySourceCount returns the words linked to at least minSources distinct sources,
+// most widespread first (ties broken by word). Unlike raw frequency, this favors words
+// that keep turning up in different texts. minSources below 1 is treated as 1.
+func GetWordsBySourceCount(db DBExecutor, minSources int) ([]Word, error) {
+	if minSources < 1 {
+		minSources = 1
+	}
+	rows, err := db.Query(`SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions
+	FROM words w
+	JOIN (SELECT word_id, COUNT(DISTINCT source_id) AS n FROM word_sources GROUP BY word_id) c ON c.word_id = w.id
+	WHERE c.n >= ?
+	ORDER BY c.n DESC, w.word, w.id`, minSources)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Word
+	for rows.Next() {
+		w, err := scanWord(rows)
+		if err != nil {
+			return nil, err
 		}
-		if lang.Valid {
-			w.Language = lang.String
+		out = append(out, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetWordFrequencies returns words with their occurrence counts, most frequent first
+// (ties broken by word). sourceID 0 sums occurrences across all sources. limit <= 0
+// returns every word.
+func GetWordFrequencies(db DBExecutor, sourceID int64, limit int) ([]WordFrequency, error) {
+	query := `SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions, w.status, SUM(ws.occurrence_count) AS total
+		FROM words w JOIN word_sources ws ON ws.word_id = w.id`
+	var args []interface{}
+	if sourceID != 0 {
+		query += ` WHERE ws.source_id = ?`
+		args = append(args, sourceID)
+	}
+	query += ` GROUP BY w.id ORDER BY total DESC, w.word`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WordFrequency
+	for rows.Next() {
+		var wf WordFrequency
+		wf.Word, err = scanWord(trailingScanner{rows, []interface{}{&wf.Status, &wf.Count}})
+		if err != nil {
+			return nil, err
 		}
-		if pron.Valid {
-			w.Pronunciation = pron.String
+		out = append(out, wf)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetWordFrequenciesByRecency is GetWordFrequencies ranked by recency-weighted counts:
+// each word-source link contributes its occurrence count halved for every halfLife that
+// has passed between the link's last_seen_at (first_seen_at for rows from before it was
+// tracked) and now. Words met often but long ago thus rank below words met recently.
+// WordFrequency.Count stays the plain total; Score holds the weighted one.
+func GetWordFrequenciesByRecency(db DBExecutor, sourceID int64, limit int, halfLife time.Duration, now time.Time) ([]WordFrequency, error) {
+	if halfLife <= 0 {
+		return nil, fmt.Errorf("halfLife must be positive, got %v", halfLife)
+	}
+	query := `SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions, w.status,
+		ws.occurrence_count, ws.first_seen_at, ws.last_seen_at
+		FROM words w JOIN word_sources ws ON ws.word_id = w.id`
+	var args []interface{}
+	if sourceID != 0 {
+		query += ` WHERE ws.source_id = ?`
+		args = append(args, sourceID)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*WordFrequency)
+	var out []*WordFrequency
+	for rows.Next() {
+		var wf WordFrequency
+		var count int
+		var firstSeen, lastSeen sql.NullTime
+		wf.Word, err = scanWord(trailingScanner{rows, []interface{}{&wf.Status, &count, &firstSeen, &lastSeen}})
+		if err != nil {
+			return nil, err
 		}
-		if img.Valid {
-			w.ImageURL = img.String
+		seen := lastSeen
+		if !seen.Valid {
+			seen = firstSeen
 		}
-		if mn.Valid {
-			w.MnemonicText = mn.String
+		weight := 1.0
+		if age := now.Sub(seen.Time); seen.Valid && age > 0 {
+			weight = math.Pow(0.5, float64(age)/float64(halfLife))
 		}
-		if defs.Valid {
-			w.Definitions = defs.String
+		acc := byID[wf.Word.ID]
+		if acc == nil {
+			acc = &wf
+			byID[wf.Word.ID] = acc
+			out = append(out, acc)
 		}
-		out = append(out, w)
+		acc.Count += count
+		acc.Score += float64(count) * weight
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Score != out[j].Score {
+			return out[i].Score > out[j].Score
+		}
+		return out[i].Word.Word < out[j].Word.Word
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	result := make([]WordFrequency, len(out))
+	for i, wf := range out {
+		result[i] = *wf
+	}
+	return result, nil
+}
+
+// ListSources returns sources newest first (by added_at, then id). limit <= 0 returns all.
+func ListSources(db DBExecutor, limit int) ([]Source, error) {
+	query := `SELECT ` + sourceColumns + ` FROM sources ORDER BY added_at DESC, id DESC`
+	var args []interface{}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Source
+	for rows.Next() {
+		src, err := scanSource(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, src)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetRecentSourcesWithTopWords returns the sourceLimit most recent sources (see
+// ListSources), each with its wordsPerSource most frequent words (ties broken by word).
+// It runs two queries whatever the number of sources: one for the sources and one
+// ranking the words of all of them at once.
+func GetRecentSourcesWithTopWords(db DBExecutor, sourceLimit, wordsPerSource int) ([]SourceWithWords, error) {
+	if sourceLimit <= 0 || wordsPerSource <= 0 {
+		return nil, fmt.Errorf("sourceLimit and wordsPerSource must be positive, got %d and %d", sourceLimit, wordsPerSource)
+	}
+	sources, err := ListSources(db, sourceLimit)
+	if err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	out := make([]SourceWithWords, len(sources))
+	bySource := make(map[int64]*SourceWithWords, len(sources))
+	ids := make([]interface{}, len(sources))
+	for i, src := range sources {
+		out[i].Source = src
+		bySource[src.ID] = &out[i]
+		ids[i] = src.ID
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := db.Query(`SELECT id, word, lemma, language, pronunciation, image_url, mnemonic_text, definitions, status, occurrence_count, source_id
+		FROM (SELECT w.id, w.word, w.lemma, w.language, w.pronunciation, w.image_url, w.mnemonic_text, w.definitions, w.status,
+				ws.occurrence_count, ws.source_id,
+				ROW_NUMBER() OVER (PARTITION BY ws.source_id ORDER BY ws.occurrence_count DESC, w.word) AS rn
+			FROM words w JOIN word_sources ws ON ws.word_id = w.id
+			WHERE ws.source_id IN (`+placeholders+`))
+		WHERE rn <= ?
+		ORDER BY source_id, rn`, append(ids, wordsPerSource)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wf WordFrequency
+		var sourceID int64
+		wf.Word, err = scanWord(trailingScanner{rows, []interface{}{&wf.Status, &wf.Count, &sourceID}})
+		if err != nil {
+			return nil, err
+		}
+		if sw := bySource[sourceID]; sw != nil {
+			sw.Words = append(sw.Words, wf)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetAllReadings returns every distinct (word, pronunciation) pair in the database, ordered
+// by word. Words without a reading are skipped.
+func GetAllReadings(db DBExecutor) ([]WordReading, error) {
+	rows, err := db.Query(`SELECT DISTINCT word, pronunciation FROM words
+		WHERE pronunciation IS NOT NULL AND pronunciation != ''
+		ORDER BY word, pronunciation`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WordReading
+	for rows.Next() {
+		var wr WordReading
+		if err := rows.Scan(&wr.Word, &wr.Reading); err != nil {
+			return nil, err
+		}
+		out = append(out, wr)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -220,6 +935,242 @@ func GetWordsBySource(db DBExecutor, sourceID int64) ([]Word, error) {
 	return out, nil
 }
 
+// GetWord returns the stored word matching word, lemma and language.
+// It returns sql.ErrNoRows if the word has not been stored yet.
+func GetWord(db DBExecutor, word, lemma, language string) (Word, error) {
+	row := db.QueryRow(`SELECT id, word, lemma, language, pronunciation, image_url, mnemonic_text, definitions FROM words WHERE word = ? AND lemma = ? AND language = ?`, strings.TrimSpace(word), lemma, language)
+	return scanWord(row)
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// trailingScanner lets scanWord read rows that select extra columns after the standard
+// word columns; the extra destinations are appended to each Scan call.
+type trailingScanner struct {
+	r     rowScanner
+	extra []interface{}
+}
+
+func (s trailingScanner) Scan(dest ...interface{}) error {
+	return s.r.Scan(append(dest, s.extra...)...)
+}
+
+// scanWord scans the standard word column list (id, word, lemma, language,
+// pronunciation, image_url, mnemonic_text, definitions), tolerating NULLs.
+func scanWord(r rowScanner) (Word, error) {
+	var w Word
+	var lemma, lang sql.NullString
+	var pron, img, mn sql.NullString
+	var defs sql.NullString
+	if err := r.Scan(&w.ID, &w.Word, &lemma, &lang, &pron, &img, &mn, &defs); err != nil {
+		return Word{}, err
+	}
+	w.Lemma = lemma.String
+	w.Language = lang.String
+	w.Pronunciation = pron.String
+	w.ImageURL = img.String
+	w.MnemonicText = mn.String
+	w.Definitions = defs.String
+	return w, nil
+}
+
+// SetPrimarySource marks sourceID as the primary source for wordID and clears the flag
+// on the word's other sources, in a single transaction. It fails if the word has not
+// been linked to sourceID.
+func SetPrimarySource(db *sql.DB, wordID, sourceID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE word_sources SET is_primary = 1 WHERE word_id = ? AND source_id = ?`, wordID, sourceID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("word %d is not linked to source %d", wordID, sourceID)
+	}
+	if _, err := tx.Exec(`UPDATE word_sources SET is_primary = 0 WHERE word_id = ? AND source_id != ?`, wordID, sourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetWordSources returns the sources a word was seen in, with their context and example
+// sentences, primary source first.
+func GetWordSources(db DBExecutor, wordID int64) ([]WordSource, error) {
+	rows, err := db.Query(`SELECT ws.id, ws.word_id, ws.source_id, cs.text, es.text, ws.occurrence_count, ws.first_seen_at, ws.last_seen_at, ws.is_primary
+		FROM word_sources ws
+		LEFT JOIN sentences cs ON cs.id = ws.context_sentence_id
+		LEFT JOIN sentences es ON es.id = ws.example_sentence_id
+		WHERE ws.word_id = ?
+		ORDER BY ws.is_primary DESC, ws.id`, wordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []WordSource
+	for rows.Next() {
+		var ws WordSource
+		var ctxText, exText sql.NullString
+		var firstSeen, lastSeen sql.NullTime
+		var isPrimary sql.NullBool
+		if err := rows.Scan(&ws.ID, &ws.WordID, &ws.SourceID, &ctxText, &exText, &ws.OccurrenceCount, &firstSeen, &lastSeen, &isPrimary); err != nil {
+			return nil, err
+		}
+		ws.ContextSentence = ctxText.String
+		ws.ExampleSentence = exText.String
+		ws.FirstSeenAt = firstSeen.Time
+		ws.LastSeenAt = lastSeen.Time
+		ws.IsPrimary = isPrimary.Bool
+		out = append(out, ws)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BestExample picks the link whose example sentence best illustrates a word, from links
+// as returned by GetWordSources. A primary source with an example wins outright; otherwise
+// the example with the highest score(sentence) is chosen, ties going to the source where
+// the word occurred most. ok is false if no link has an example.
+func BestExample(links []WordSource, score func(sentence string) int) (best WordSource, ok bool) {
+	bestScore := 0
+	for _, ws := range links {
+		if ws.ExampleSentence == "" {
+			continue
+		}
+		if ws.IsPrimary {
+			return ws, true
+		}
+		s := score(ws.ExampleSentence)
+		if !ok || s > bestScore || (s == bestScore && ws.OccurrenceCount > best.OccurrenceCount) {
+			best, bestScore, ok = ws, s, true
+		}
+	}
+	return best, ok
+}
+
+// GetBestExample returns the example sentence BestExample picks across every source of
+// wordID, or "" if none was stored.
+func GetBestExample(db DBExecutor, wordID int64, score func(sentence string) int) (string, error) {
+	links, err := GetWordSources(db, wordID)
+	if err != nil {
+		return "", err
+	}
+	best, _ := BestExample(links, score)
+	return best.ExampleSentence, nil
+}
+
+// GetSourceContentHash returns the content hash recorded for a source ("" if none).
+func GetSourceContentHash(db DBExecutor, sourceID int64) (string, error) {
+	var hash sql.NullString
+	if err := db.QueryRow(`SELECT content_hash FROM sources WHERE id = ?`, sourceID).Scan(&hash); err != nil {
+		return "", err
+	}
+	return hash.String, nil
+}
+
+// SetSourceContentHash records the hash of the content last ingested for a source.
+func SetSourceContentHash(db DBExecutor, sourceID int64, hash string) error {
+	_, err := db.Exec(`UPDATE sources SET content_hash = ? WHERE id = ?`, hash, sourceID)
+	return err
+}
+
+// RecordSourceFailure marks url as failed with errMsg and counts the attempt.
+func RecordSourceFailure(db DBExecutor, url, errMsg string) error {
+	_, err := db.Exec(`INSERT INTO source_errors (url, status, error, attempts, last_attempt_at) VALUES (?, ?, ?, 1, ?)
+	ON CONFLICT(url) DO UPDATE SET status = excluded.status, error = excluded.error,
+	  attempts = source_errors.attempts + 1, last_attempt_at = excluded.last_attempt_at`,
+		url, SourceStatusFailed, errMsg, time.Now().UTC())
+	return err
+}
+
+// RecordSourceSuccess marks a previously failed url as succeeded and counts the attempt.
+// URLs that never failed are not tracked, so it does nothing for them.
+func RecordSourceSuccess(db DBExecutor, url string) error {
+	_, err := db.Exec(`UPDATE source_errors SET status = ?, attempts = attempts + 1, last_attempt_at = ? WHERE url = ?`,
+		SourceStatusSucceeded, time.Now().UTC(), url)
+	return err
+}
+
+// GetSourceError returns the failure record of url, or sql.ErrNoRows if it never failed.
+func GetSourceError(db DBExecutor, url string) (SourceError, error) {
+	var se SourceError
+	var errMsg sql.NullString
+	var last sql.NullTime
+	err := db.QueryRow(`SELECT url, status, error, attempts, last_attempt_at FROM source_errors WHERE url = ?`, url).
+		Scan(&se.URL, &se.Status, &errMsg, &se.Attempts, &last)
+	if err != nil {
+		return SourceError{}, err
+	}
+	se.Error = errMsg.String
+	se.LastAttemptAt = last.Time
+	return se, nil
+}
+
+// GetFailedSourceURLs returns the URLs whose most recent attempt failed, oldest attempt first.
+func GetFailedSourceURLs(db DBExecutor) ([]string, error) {
+	rows, err := db.Query(`SELECT url FROM source_errors WHERE status = ? ORDER BY last_attempt_at, url`, SourceStatusFailed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
+}
+
+// GetDBStats returns totals of sources, words, word-source links, sentences and word
+// occurrences across the database.
+func GetDBStats(db DBExecutor) (DBStats, error) {
+	var st DBStats
+	err := db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM sources),
+		(SELECT COUNT(*) FROM words),
+		(SELECT COUNT(*) FROM word_sources),
+		(SELECT COUNT(*) FROM sentences),
+		(SELECT COALESCE(SUM(occurrence_count), 0) FROM word_sources)`).
+		Scan(&st.Sources, &st.Words, &st.Links, &st.Sentences, &st.Occurrences)
+	return st, err
+}
+
+// GetCheckpoint returns the saved position of the named job, or 0 if it has none.
+func GetCheckpoint(db DBExecutor, name string) (int64, error) {
+	var pos int64
+	err := db.QueryRow(`SELECT position FROM checkpoints WHERE name = ?`, name).Scan(&pos)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return pos, err
+}
+
+// SetCheckpoint saves the position reached by the named job.
+func SetCheckpoint(db DBExecutor, name string, position int64) error {
+	_, err := db.Exec(`INSERT INTO checkpoints (name, position) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET position = excluded.position`, name, position)
+	return err
+}
+
+// ClearCheckpoint forgets the named job's position so its next run starts over.
+func ClearCheckpoint(db DBExecutor, name string) error {
+	_, err := db.Exec(`DELETE FROM checkpoints WHERE name = ?`, name)
+	return err
+}
+
 // GetSourceProgress returns the last processed sentence index for a source.
 func GetSourceProgress(db DBExecutor, sourceID int64) (int, error) {
 	var index int
@@ -235,3 +1186,332 @@ func UpdateSourceProgress(db DBExecutor, sourceID int64, index int) error {
 	_, err := db.Exec("UPDATE sources SET last_processed_sentence = ? WHERE id = ?", index, sourceID)
 	return err
 }
+
+// SetSourceTotalSentences records how many sentences the source's document has, so
+// progress can be shown as a percentage.
+func SetSourceTotalSentences(db DBExecutor, sourceID int64, total int) error {
+	_, err := db.Exec("UPDATE sources SET total_sentences = ? WHERE id = ?", total, sourceID)
+	return err
+}
+
+// GetSourceTotalSentences returns the sentence total recorded with
+// SetSourceTotalSentences, or -1 if none was.
+func GetSourceTotalSentences(db DBExecutor, sourceID int64) (int, error) {
+	var total sql.NullInt64
+	if err := db.QueryRow("SELECT total_sentences FROM sources WHERE id = ?", sourceID).Scan(&total); err != nil {
+		return 0, err
+	}
+	if !total.Valid {
+		return -1, nil
+	}
+	return int(total.Int64), nil
+}
+
+// GetSourceProgressPercent returns how much of a source has been ingested, from 0 to 100.
+// It returns -1 when the sentence total is unknown, e.g. for sources ingested before
+// totals were recorded.
+func GetSourceProgressPercent(db DBExecutor, sourceID int64) (float64, error) {
+	var last int
+	var total sql.NullInt64
+	err := db.QueryRow("SELECT last_processed_sentence, total_sentences FROM sources WHERE id = ?", sourceID).Scan(&last, &total)
+	if err != nil {
+		return 0, err
+	}
+	if !total.Valid || total.Int64 < 0 {
+		return -1, nil
+	}
+	if total.Int64 == 0 {
+		return 100, nil
+	}
+	return min(float64(last+1)/float64(total.Int64)*100, 100), nil
+}
+
+// MaintenanceReport describes what a maintenance operation changed, or with dryRun
+// what it would have changed.
+type MaintenanceReport struct {
+	// DryRun is true when the changes were rolled back instead of committed.
+	DryRun bool
+	// WordIDs are the words removed (pruned, or merged into another word).
+	WordIDs []int64
+	// LinksRemoved counts deleted word_sources rows, including links combined into
+	// another word's link to the same source.
+	LinksRemoved int
+	// LinksMoved counts word_sources rows re-pointed to another word.
+	LinksMoved int
+	// ContextsRemoved counts deleted word_contexts rows.
+	ContextsRemoved int
+}
+
+// finishMaintenance commits tx, or rolls it back when dryRun is set so the report
+// reflects exactly what a real run would do without changing anything.
+func finishMaintenance(tx *sql.Tx, report *MaintenanceReport, dryRun bool) error {
+	report.DryRun = dryRun
+	if dryRun {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
+
+// PruneWordsBelowFrequency deletes words whose occurrence_count summed across all sources
+// is below minTotalOccurrences (words with no links count as 0), together with their
+// word_sources and word_contexts rows. It runs in a single transaction; with dryRun the
+// transaction is rolled back and the report lists what would have been deleted. A
+// threshold below 1 removes nothing.
+func PruneWordsBelowFrequency(db *sql.DB, minTotalOccurrences int, dryRun bool) (MaintenanceReport, error) {
+	var report MaintenanceReport
+	if minTotalOccurrences < 1 {
+		report.DryRun = dryRun
+		return report, nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	// Child rows are deleted explicitly rather than relying on ON DELETE CASCADE, since
+	// foreign key enforcement is per-connection in SQLite.
+	const pruneSet = `SELECT w.id FROM words w LEFT JOIN word_sources ws ON ws.word_id = w.id
+		GROUP BY w.id HAVING COALESCE(SUM(ws.occurrence_count), 0) < ?`
+	if report.WordIDs, err = queryIDs(tx, pruneSet+` ORDER BY w.id`, minTotalOccurrences); err != nil {
+		return report, fmt.Errorf("find words: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM word_notes WHERE word_id IN (`+pruneSet+`)`, minTotalOccurrences); err != nil {
+		return report, fmt.Errorf("delete notes: %w", err)
+	}
+	res, err := tx.Exec(`DELETE FROM word_contexts WHERE word_source_id IN (SELECT id FROM word_sources WHERE word_id IN (`+pruneSet+`))`, minTotalOccurrences)
+	if err != nil {
+		return report, fmt.Errorf("delete contexts: %w", err)
+	}
+	if report.ContextsRemoved, err = rowsAffected(res); err != nil {
+		return report, err
+	}
+	res, err = tx.Exec(`DELETE FROM word_sources WHERE word_id IN (`+pruneSet+`)`, minTotalOccurrences)
+	if err != nil {
+		return report, fmt.Errorf("delete word sources: %w", err)
+	}
+	if report.LinksRemoved, err = rowsAffected(res); err != nil {
+		return report, err
+	}
+	if _, err := tx.Exec(`DELETE FROM words WHERE id IN (`+pruneSet+`)`, minTotalOccurrences); err != nil {
+		return report, fmt.Errorf("delete words: %w", err)
+	}
+	if err := finishMaintenance(tx, &report, dryRun); err != nil {
+		return MaintenanceReport{}, err
+	}
+	return report, nil
+}
+
+// queryIDs runs a query selecting a single integer column.
+func queryIDs(db DBExecutor, query string, args ...any) ([]int64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func rowsAffected(res sql.Result) (int, error) {
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// MergeWords folds the words in mergeIDs into keepID, e.g. 猫, ねこ and ネコ stored as
+// separate rows. Their source links are moved to keepID; where keepID is already linked
+// to the same source the two links are combined (occurrence counts summed, contexts
+// kept) and keepID's primary source, if any, stays the only one. Notes move to keepID
+// too. The merged words are then deleted. Everything happens in one transaction, which
+// dryRun rolls back after filling in the report.
+func MergeWords(db *sql.DB, keepID int64, mergeIDs []int64, dryRun bool) (MaintenanceReport, error) {
+	var report MaintenanceReport
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	if err := requireWord(tx, keepID); err != nil {
+		return report, err
+	}
+	for _, id := range mergeIDs {
+		if id == keepID {
+			return report, fmt.Errorf("cannot merge word %d into itself", id)
+		}
+		if err := requireWord(tx, id); err != nil {
+			return report, err
+		}
+		if err := moveWordSources(tx, keepID, id, &report); err != nil {
+			return report, fmt.Errorf("merge word %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`UPDATE word_notes SET word_id = ? WHERE word_id = ?`, keepID, id); err != nil {
+			return report, fmt.Errorf("move notes of word %d: %w", id, err)
+		}
+		if _, err := tx.Exec(`DELETE FROM words WHERE id = ?`, id); err != nil {
+			return report, fmt.Errorf("delete word %d: %w", id, err)
+		}
+		report.WordIDs = append(report.WordIDs, id)
+	}
+	if err := finishMaintenance(tx, &report, dryRun); err != nil {
+		return MaintenanceReport{}, err
+	}
+	return report, nil
+}
+
+// requireWord returns an error if no word has the given id.
+func requireWord(db DBExecutor, wordID int64) error {
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM words WHERE id = ?)`, wordID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("word %d not found", wordID)
+	}
+	return nil
+}
+
+// moveWordSources re-points every word_sources row of fromID to toID, combining rows
+// for sources both words are linked to, and tallies the changes in report.
+func moveWordSources(tx *sql.Tx, toID, fromID int64, report *MaintenanceReport) error {
+	rows, err := tx.Query(`SELECT m.id, k.id FROM word_sources m
+		LEFT JOIN word_sources k ON k.word_id = ? AND k.source_id = m.source_id
+		WHERE m.word_id = ?`, toID, fromID)
+	if err != nil {
+		return err
+	}
+	type link struct {
+		from int64
+		into sql.NullInt64
+	}
+	var links []link
+	for rows.Next() {
+		var l link
+		if err := rows.Scan(&l.from, &l.into); err != nil {
+			rows.Close()
+			return err
+		}
+		links = append(links, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range links {
+		if !l.into.Valid {
+			// Keep at most one primary source: toID's, if it has one.
+			if _, err := tx.Exec(`UPDATE word_sources SET word_id = ?1,
+				is_primary = CASE WHEN EXISTS(SELECT 1 FROM word_sources WHERE word_id = ?1 AND is_primary = 1) THEN 0 ELSE is_primary END
+				WHERE id = ?2`, toID, l.from); err != nil {
+				return err
+			}
+			report.LinksMoved++
+			continue
+		}
+		if _, err := tx.Exec(`UPDATE word_sources SET
+			occurrence_count = occurrence_count + (SELECT occurrence_count FROM word_sources WHERE id = ?1),
+			context_sentence_id = COALESCE(context_sentence_id, (SELECT context_sentence_id FROM word_sources WHERE id = ?1)),
+			example_sentence_id = COALESCE(example_sentence_id, (SELECT example_sentence_id FROM word_sources WHERE id = ?1)),
+			first_seen_at = COALESCE(MIN(first_seen_at, (SELECT first_seen_at FROM word_sources WHERE id = ?1)), first_seen_at),
+			last_seen_at = COALESCE(MAX(last_seen_at, (SELECT last_seen_at FROM word_sources WHERE id = ?1)), last_seen_at)
+			WHERE id = ?2`, l.from, l.into.Int64); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO word_contexts (word_source_id, sentence_id, created_at)
+			SELECT ?, sentence_id, created_at FROM word_contexts WHERE word_source_id = ?`, l.into.Int64, l.from); err != nil {
+			return err
+		}
+		res, err := tx.Exec(`DELETE FROM word_contexts WHERE word_source_id = ?`, l.from)
+		if err != nil {
+			return err
+		}
+		n, err := rowsAffected(res)
+		if err != nil {
+			return err
+		}
+		report.ContextsRemoved += n
+		if _, err := tx.Exec(`DELETE FROM word_sources WHERE id = ?`, l.from); err != nil {
+			return err
+		}
+		report.LinksRemoved++
+	}
+	return nil
+}
+
+// IssueKind names the kind of anomaly reported by VerifyLinks.
+type IssueKind string
+
+const (
+	// IssueDanglingContext is a context_sentence_id with no matching sentences row.
+	IssueDanglingContext IssueKind = "dangling_context_sentence"
+	// IssueDanglingExample is an example_sentence_id with no matching sentences row.
+	IssueDanglingExample IssueKind = "dangling_example_sentence"
+	// IssueNegativeCount is an occurrence_count below zero.
+	IssueNegativeCount IssueKind = "negative_occurrence_count"
+)
+
+// Issue is one anomaly in a word_sources row.
+type Issue struct {
+	Kind         IssueKind
+	WordSourceID int64
+	WordID       int64
+	SourceID     int64
+	// Value is the offending sentence id or occurrence count.
+	Value int64
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("word_sources %d (word %d, source %d): %s %d", i.WordSourceID, i.WordID, i.SourceID, i.Kind, i.Value)
+}
+
+// VerifyLinks checks that every word_sources row's context and example sentence ids refer
+// to existing sentences and that its occurrence count is not negative. It only reads
+// word_sources and sentences, so it is cheap enough to run after every ingest. Issues are
+// ordered by word_sources id; a row can have several.
+func VerifyLinks(db DBExecutor) ([]Issue, error) {
+	rows, err := db.Query(`SELECT * FROM (
+		SELECT ws.id, ws.word_id, ws.source_id, ws.context_sentence_id, ws.example_sentence_id, ws.occurrence_count,
+			ws.context_sentence_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sentences s WHERE s.id = ws.context_sentence_id) AS ctx_dangling,
+			ws.example_sentence_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM sentences s WHERE s.id = ws.example_sentence_id) AS ex_dangling
+		FROM word_sources ws)
+		WHERE ctx_dangling OR ex_dangling OR occurrence_count < 0
+		ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var issues []Issue
+	for rows.Next() {
+		var base Issue
+		var ctxID, exID, count sql.NullInt64
+		var ctxDangling, exDangling bool
+		if err := rows.Scan(&base.WordSourceID, &base.WordID, &base.SourceID, &ctxID, &exID, &count, &ctxDangling, &exDangling); err != nil {
+			return nil, err
+		}
+		if ctxDangling {
+			issue := base
+			issue.Kind, issue.Value = IssueDanglingContext, ctxID.Int64
+			issues = append(issues, issue)
+		}
+		if exDangling {
+			issue := base
+			issue.Kind, issue.Value = IssueDanglingExample, exID.Int64
+			issues = append(issues, issue)
+		}
+		if count.Valid && count.Int64 < 0 {
+			issue := base
+			issue.Kind, issue.Value = IssueNegativeCount, count.Int64
+			issues = append(issues, issue)
+		}
+	}
+	return issues, rows.Err()
+}
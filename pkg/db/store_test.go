@@ -2,9 +2,15 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/japaniel/readerer/pkg/readerer"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -56,6 +62,44 @@ func TestCreateOrGetSource(t *testing.T) {
 	}
 }
 
+func TestCreateOrGetSourceNormalizesType(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	for i, c := range []struct{ in, want string }{
+		{"website_article", SourceTypeWebsiteArticle},
+		{" EPUB ", SourceTypeEPUB},
+		{"blog", SourceTypeOther},
+	} {
+		id, err := CreateOrGetSource(db, c.in, "", "", "", fmt.Sprintf("https://example.com/type/%d", i), "")
+		if err != nil {
+			t.Fatalf("%q: %v", c.in, err)
+		}
+		src, err := GetSource(db, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if src.SourceType != c.want {
+			t.Errorf("source type %q stored as %q, want %q", c.in, src.SourceType, c.want)
+		}
+	}
+}
+
+func TestCreateOrGetSourceExReportsCreated(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	id1, created, err := CreateOrGetSourceEx(db, "website_article", "T", "", "example.com", "https://example.com/new", "")
+	if err != nil || !created {
+		t.Fatalf("first call: created=%v err=%v", created, err)
+	}
+	id2, created, err := CreateOrGetSourceEx(db, "website_article", "T", "", "example.com", "https://example.com/new", "")
+	if err != nil || created {
+		t.Fatalf("second call: created=%v err=%v", created, err)
+	}
+	if id1 != id2 {
+		t.Fatalf("expected same source id, got %d and %d", id1, id2)
+	}
+}
+
 func TestLinkAndQuery(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -367,3 +411,1250 @@ func TestLinkWordToSource_ContextLimit(t *testing.T) {
 		t.Errorf("expected 5 stored contexts, got %d", ctxCount)
 	}
 }
+
+func TestLinkWordToSource_WhitespaceVariantContexts(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	wID, err := CreateOrGetWord(db, "猫", "猫", "ネコ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	sID, err := CreateOrGetSource(db, "website", "Title", "", "", "http://example.com/ws", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	for _, ctx := range []string{"猫が 好き です。", "  猫が \t好き  です。\n"} {
+		if err := LinkWordToSource(db, wID, sID, ctx, ctx, 1); err != nil {
+			t.Fatalf("link %q: %v", ctx, err)
+		}
+	}
+	// A real difference in wording still gets its own context.
+	if err := LinkWordToSource(db, wID, sID, "猫が 嫌い です。", "", 1); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	var texts []string
+	rows, err := db.Query(`SELECT s.text FROM word_contexts wc JOIN sentences s ON s.id = wc.sentence_id ORDER BY s.id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			t.Fatal(err)
+		}
+		texts = append(texts, text)
+	}
+	if len(texts) != 2 || texts[0] != "猫が 好き です。" || texts[1] != "猫が 嫌い です。" {
+		t.Fatalf("expected whitespace variants to share one context, got %q", texts)
+	}
+	// A full-width space inside the text is kept; only a repeat of it is collapsed.
+	for _, ctx := range []string{"猫が\u3000嫌い です。", "猫が\u3000\u3000嫌い です。"} {
+		if err := LinkWordToSource(db, wID, sID, ctx, "", 1); err != nil {
+			t.Fatalf("link %q: %v", ctx, err)
+		}
+	}
+	var kept int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sentences WHERE text = ?`, "猫が\u3000嫌い です。").Scan(&kept); err != nil || kept != 1 {
+		t.Fatalf("expected the full-width space to survive normalization, got %d rows (%v)", kept, err)
+	}
+	if got := normalizeSentence(" 猫が\u3000嫌い\r\n です。 "); got != "猫が\u3000嫌い\rです。" {
+		t.Errorf("normalizeSentence kept %q", got)
+	}
+}
+
+func TestGetWord(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	id, err := CreateOrGetWord(db, "犬", "犬", "いぬ", `[{"senses":["dog"]}]`, "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	w, err := GetWord(db, "犬", "犬", "ja")
+	if err != nil {
+		t.Fatalf("get word: %v", err)
+	}
+	if w.ID != id || w.Pronunciation != "いぬ" || w.Definitions != `[{"senses":["dog"]}]` {
+		t.Fatalf("unexpected word: %+v", w)
+	}
+	if _, err := GetWord(db, "猫", "猫", "ja"); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for missing word, got %v", err)
+	}
+}
+
+func TestSetPrimarySource(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	wID, err := CreateOrGetWord(db, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	s1, err := CreateOrGetSource(db, "website_article", "One", "", "example.com", "https://example.com/1", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "Two", "", "example.com", "https://example.com/2", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	for _, sID := range []int64{s1, s2} {
+		if err := LinkWordToSource(db, wID, sID, "犬がいる。", "犬がいる。", 1); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+	}
+
+	primaryOf := func() map[int64]bool {
+		t.Helper()
+		wss, err := GetWordSources(db, wID)
+		if err != nil {
+			t.Fatalf("get word sources: %v", err)
+		}
+		if len(wss) != 2 {
+			t.Fatalf("expected 2 word sources, got %d", len(wss))
+		}
+		out := make(map[int64]bool)
+		for _, ws := range wss {
+			out[ws.SourceID] = ws.IsPrimary
+			if ws.ExampleSentence != "犬がいる。" {
+				t.Errorf("expected example sentence text, got %q", ws.ExampleSentence)
+			}
+		}
+		return out
+	}
+
+	if err := SetPrimarySource(db, wID, s1); err != nil {
+		t.Fatalf("set primary: %v", err)
+	}
+	if p := primaryOf(); !p[s1] || p[s2] {
+		t.Fatalf("expected only source %d primary, got %v", s1, p)
+	}
+
+	if err := SetPrimarySource(db, wID, s2); err != nil {
+		t.Fatalf("set primary: %v", err)
+	}
+	if p := primaryOf(); p[s1] || !p[s2] {
+		t.Fatalf("expected only source %d primary, got %v", s2, p)
+	}
+
+	if err := SetPrimarySource(db, wID, 9999); err == nil {
+		t.Fatal("expected error for unlinked source")
+	}
+	if p := primaryOf(); !p[s2] {
+		t.Fatalf("failed SetPrimarySource must not clear existing primary, got %v", p)
+	}
+}
+
+func TestSourceMeta(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	meta := `{"series":"NHK Easy","difficulty":2}`
+	sID, err := CreateOrGetSource(db, "website_article", "Title", "", "example.com", "https://example.com/meta", meta)
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	got, err := GetSourceMeta(db, sID)
+	if err != nil {
+		t.Fatalf("get meta: %v", err)
+	}
+	if got != meta {
+		t.Fatalf("meta = %q, want %q", got, meta)
+	}
+
+	updated := `{"series":"NHK Easy","difficulty":3}`
+	if err := SetSourceMeta(db, sID, updated); err != nil {
+		t.Fatalf("set meta: %v", err)
+	}
+	if got, _ := GetSourceMeta(db, sID); got != updated {
+		t.Fatalf("meta after update = %q, want %q", got, updated)
+	}
+
+	if err := SetSourceMeta(db, 9999, updated); err == nil {
+		t.Fatal("expected error for missing source")
+	}
+	if _, err := GetSourceMeta(db, 9999); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for missing source, got %v", err)
+	}
+}
+
+func TestLinkWordToSourceTracksLastSeen(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	wID, err := CreateOrGetWord(db, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	sID, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/seen", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	get := func() WordSource {
+		t.Helper()
+		wss, err := GetWordSources(db, wID)
+		if err != nil || len(wss) != 1 {
+			t.Fatalf("get word sources: %v (%d rows)", err, len(wss))
+		}
+		return wss[0]
+	}
+
+	if err := LinkWordToSource(db, wID, sID, "犬がいる。", "", 1); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	first := get()
+	if first.FirstSeenAt.IsZero() || !first.LastSeenAt.Equal(first.FirstSeenAt) {
+		t.Fatalf("expected first and last seen to match on insert, got %v / %v", first.FirstSeenAt, first.LastSeenAt)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if err := LinkWordToSource(db, wID, sID, "犬が走る。", "", 1); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	second := get()
+	if !second.FirstSeenAt.Equal(first.FirstSeenAt) {
+		t.Errorf("first_seen_at changed: %v -> %v", first.FirstSeenAt, second.FirstSeenAt)
+	}
+	if !second.LastSeenAt.After(first.LastSeenAt) {
+		t.Errorf("expected last_seen_at to advance: %v -> %v", first.LastSeenAt, second.LastSeenAt)
+	}
+}
+
+func TestGetWordFrequencies(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s1, err := CreateOrGetSource(db, "website_article", "One", "", "example.com", "https://example.com/f1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "Two", "", "example.com", "https://example.com/f2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := map[string]int64{}
+	for _, w := range []string{"犬", "猫", "鳥"} {
+		id, err := CreateOrGetWord(db, w, w, "", "", "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[w] = id
+	}
+	links := []struct {
+		word   string
+		source int64
+		count  int
+	}{
+		{"犬", s1, 1}, {"猫", s1, 4}, {"鳥", s1, 2},
+		{"犬", s2, 5},
+	}
+	for _, l := range links {
+		if err := LinkWordToSource(db, ids[l.word], l.source, l.word+"がいる。", "", l.count); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GetWordFrequencies(db, s1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, wf := range got {
+		order = append(order, fmt.Sprintf("%s:%d", wf.Word.Word, wf.Count))
+	}
+	if want := "猫:4 鳥:2 犬:1"; strings.Join(order, " ") != want {
+		t.Errorf("source frequencies = %v, want %s", order, want)
+	}
+
+	all, err := GetWordFrequencies(db, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Word.Word != "犬" || all[0].Count != 6 {
+		t.Errorf("expected top word across sources to be 犬:6, got %+v", all)
+	}
+}
+
+func TestGetWordFrequenciesByRecency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	src, err := CreateOrGetSource(db, "website_article", "One", "", "example.com", "https://example.com/r", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	seen := map[string]struct {
+		count int
+		at    time.Time
+	}{
+		"犬": {8, now.Add(-28 * 24 * time.Hour)}, // 4 half-lives ago: weighs 0.5
+		"猫": {2, now.Add(-time.Hour)},
+	}
+	for w, s := range seen {
+		id, err := CreateOrGetWord(db, w, w, "", "", "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := LinkWordToSource(db, id, src, w+"がいる。", "", s.count); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(`UPDATE word_sources SET last_seen_at = ? WHERE word_id = ?`, s.at, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GetWordFrequenciesByRecency(db, src, 0, 7*24*time.Hour, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Word.Word != "猫" || got[1].Word.Word != "犬" {
+		t.Fatalf("expected the recent 猫 before the older, more frequent 犬, got %+v", got)
+	}
+	if got[1].Count != 8 || math.Abs(got[1].Score-0.5) > 1e-9 {
+		t.Errorf("expected 犬 count 8 with score 0.5, got %d and %v", got[1].Count, got[1].Score)
+	}
+
+	// Without weighting the plain counts win.
+	plain, err := GetWordFrequencies(db, src, 0)
+	if err != nil || len(plain) != 2 || plain[0].Word.Word != "犬" {
+		t.Fatalf("expected 犬 first by count, got %+v (%v)", plain, err)
+	}
+	if _, err := GetWordFrequenciesByRecency(db, src, 0, 0, now); err == nil {
+		t.Error("expected an error for a zero half-life")
+	}
+}
+
+func TestPruneWordsBelowFrequency(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	sID, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/prune", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rareID, err := CreateOrGetWord(db, "稀", "稀", "", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	commonID, err := CreateOrGetWord(db, "犬", "犬", "", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkWordToSource(db, rareID, sID, "稀な言葉。", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkWordToSource(db, commonID, sID, "犬がいる。", "", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := PruneWordsBelowFrequency(db, 2, true)
+	if err != nil {
+		t.Fatalf("dry-run prune: %v", err)
+	}
+	if !preview.DryRun || len(preview.WordIDs) != 1 || preview.WordIDs[0] != rareID || preview.LinksRemoved != 1 || preview.ContextsRemoved != 1 {
+		t.Fatalf("unexpected dry-run report %+v", preview)
+	}
+	if _, err := GetWord(db, "稀", "稀", "ja"); err != nil {
+		t.Fatalf("dry run must not delete anything: %v", err)
+	}
+
+	report, err := PruneWordsBelowFrequency(db, 2, false)
+	if err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if len(report.WordIDs) != 1 {
+		t.Fatalf("expected 1 word removed, got %d", len(report.WordIDs))
+	}
+	preview.DryRun = false
+	if fmt.Sprint(report) != fmt.Sprint(preview) {
+		t.Errorf("dry run reported %+v, real run %+v", preview, report)
+	}
+	if _, err := GetWord(db, "稀", "稀", "ja"); err != sql.ErrNoRows {
+		t.Errorf("expected rare word to be deleted, got err=%v", err)
+	}
+	if _, err := GetWord(db, "犬", "犬", "ja"); err != nil {
+		t.Errorf("expected common word to remain: %v", err)
+	}
+
+	var links, contexts int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_sources WHERE word_id = ?`, rareID).Scan(&links); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_contexts`).Scan(&contexts); err != nil {
+		t.Fatal(err)
+	}
+	if links != 0 || contexts != 1 {
+		t.Errorf("expected rare word's links and contexts removed, got links=%d contexts=%d", links, contexts)
+	}
+}
+
+func TestCreateOrGetSourceNormalizesTitle(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	id1, err := CreateOrGetSource(db, "website_article", "猫の話　第１回", "山田　太郎", "example.com", "https://example.com/nfkc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := CreateOrGetSource(db, "website_article", " 猫の話 第1回 ", "山田 太郎", "example.com", "https://example.com/nfkc", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 {
+		t.Fatalf("expected titles differing only by width/spacing to dedupe, got %d and %d", id1, id2)
+	}
+	src, err := GetSource(db, id1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if src.Title != "猫の話 第1回" || src.Author != "山田 太郎" {
+		t.Errorf("expected normalized title/author, got %q / %q", src.Title, src.Author)
+	}
+}
+
+func TestSearchWordsByGloss(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if _, err := CreateOrGetWord(db, "犬", "犬", "いぬ", `[{"senses":["dog","hound"],"pos":["n"]}]`, "ja"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateOrGetWord(db, "猫", "猫", "ねこ", `[{"senses":["cat"],"pos":["n"]}]`, "ja"); err != nil {
+		t.Fatal(err)
+	}
+	birdID, err := CreateOrGetWord(db, "鳥", "鳥", "とり", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Definitions filled in later must also become searchable.
+	if err := UpdateWordDefinitions(db, birdID, `[{"senses":["bird (e.g. a 100% chicken)"],"pos":["n"]}]`); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := SearchWordsByGloss(db, "Dog")
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	if len(got) != 1 || got[0].Word != "犬" {
+		t.Fatalf("expected [犬] for dog, got %+v", got)
+	}
+
+	var gloss string
+	if err := db.QueryRow(`SELECT gloss_text FROM words WHERE word = ?`, "犬").Scan(&gloss); err != nil {
+		t.Fatal(err)
+	}
+	if gloss != "dog, hound" {
+		t.Errorf("gloss_text = %q, want %q", gloss, "dog, hound")
+	}
+
+	if got, err := SearchWordsByGloss(db, "100%"); err != nil || len(got) != 1 || got[0].Word != "鳥" {
+		t.Errorf("expected literal %% match on 鳥, got %+v (err=%v)", got, err)
+	}
+	if got, err := SearchWordsByGloss(db, "%"); err != nil || len(got) != 1 {
+		t.Errorf("expected %% to be matched literally, got %+v (err=%v)", got, err)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "readerer.db")
+
+	release, err := AcquireLock(dbPath)
+	if err != nil {
+		t.Fatalf("first lock: %v", err)
+	}
+	if _, err := AcquireLock(dbPath); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("expected ErrDatabaseInUse for second lock, got %v", err)
+	}
+	if err := release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+
+	release, err = AcquireLock(dbPath)
+	if err != nil {
+		t.Fatalf("lock after release: %v", err)
+	}
+	release()
+
+	if _, err := AcquireLock(":memory:"); err != nil {
+		t.Fatalf("in-memory databases should not be locked: %v", err)
+	}
+}
+
+func TestGetSourcesByAuthor(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	for i, author := range []string{"夏目　漱石", "芥川 龍之介", "夏目 漱石"} {
+		url := fmt.Sprintf("https://example.com/author/%d", i)
+		if _, err := CreateOrGetSource(db, "website_article", fmt.Sprintf("Title %d", i), author, "example.com", url, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Query with a full-width space; it must match both normalized rows.
+	got, err := GetSourcesByAuthor(db, " 夏目　漱石 ")
+	if err != nil {
+		t.Fatalf("GetSourcesByAuthor: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 sources for 夏目 漱石, got %+v", got)
+	}
+	for _, src := range got {
+		if src.Author != "夏目 漱石" {
+			t.Errorf("unexpected author %q", src.Author)
+		}
+	}
+	if got, err := GetSourcesByAuthor(db, "太宰 治"); err != nil || len(got) != 0 {
+		t.Errorf("expected no sources for unknown author, got %+v (err=%v)", got, err)
+	}
+}
+
+func TestSourceCoverage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	sID, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/coverage", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{"犬": 6, "猫": 3, "鳥": 1}
+	ids := map[string]int64{}
+	for w, c := range counts {
+		id, err := CreateOrGetWord(db, w, w, "", "", "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[w] = id
+		if err := LinkWordToSource(db, id, sID, w+"がいる。", "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if known, total, err := SourceCoverage(db, sID); err != nil || known != 0 || total != 10 {
+		t.Fatalf("before marking: known=%d total=%d err=%v", known, total, err)
+	}
+
+	if err := SetWordStatus(db, ids["犬"], WordStatusKnown); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetWordStatus(db, ids["鳥"], WordStatusKnown); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetWordStatus(db, ids["猫"], WordStatusLearning); err != nil {
+		t.Fatal(err)
+	}
+	known, total, err := SourceCoverage(db, sID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if known != 7 || total != 10 {
+		t.Errorf("coverage = %d/%d, want 7/10", known, total)
+	}
+
+	if err := SetWordStatus(db, ids["犬"], "mastered"); err == nil {
+		t.Error("expected error for unknown status")
+	}
+	if known, total, err := SourceCoverage(db, 9999); err != nil || known != 0 || total != 0 {
+		t.Errorf("empty source: known=%d total=%d err=%v", known, total, err)
+	}
+}
+
+func TestGetAllReadings(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	words := []struct{ word, lemma, reading string }{
+		{"行っ", "行く", "いっ"},
+		{"行っ", "行う", "おこなっ"},
+		{"猫", "猫", "ねこ"},
+		{"猫", "ネコ", "ねこ"}, // same pair under another lemma
+		{"は", "は", ""},    // no reading
+	}
+	for _, w := range words {
+		if _, err := CreateOrGetWord(db, w.word, w.lemma, w.reading, "", "ja"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GetAllReadings(db)
+	if err != nil {
+		t.Fatalf("GetAllReadings: %v", err)
+	}
+	want := []WordReading{{"猫", "ねこ"}, {"行っ", "いっ"}, {"行っ", "おこなっ"}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reading %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGetDBStats(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	if st, err := GetDBStats(db); err != nil || st != (DBStats{}) {
+		t.Fatalf("empty db: %+v (err=%v)", st, err)
+	}
+
+	s1, err := CreateOrGetSource(db, "website_article", "A", "", "", "https://example.com/a", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "B", "", "", "https://example.com/b", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dog, _ := CreateOrGetWord(db, "犬", "犬", "いぬ", "", "ja")
+	cat, _ := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if _, err := CreateOrGetWord(db, "鳥", "鳥", "とり", "", "ja"); err != nil { // never linked
+		t.Fatal(err)
+	}
+	links := []struct {
+		word, source int64
+		sentence     string
+		count        int
+	}{
+		{dog, s1, "犬がいる。", 2},
+		{cat, s1, "猫がいる。", 1},
+		{dog, s2, "犬がいる。", 4},
+	}
+	for _, l := range links {
+		if err := LinkWordToSource(db, l.word, l.source, l.sentence, "", l.count); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	st, err := GetDBStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DBStats{Sources: 2, Words: 3, Links: 3, Sentences: 2, Occurrences: 7}
+	if st != want {
+		t.Errorf("GetDBStats = %+v, want %+v", st, want)
+	}
+}
+
+func TestGetWordsFirstSeenBetween(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s1, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/a", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/b", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	link := func(word string, sourceID int64, seen time.Time) int64 {
+		t.Helper()
+		wID, err := CreateOrGetWord(db, word, word, "", "", "ja")
+		if err != nil {
+			t.Fatalf("create word: %v", err)
+		}
+		if err := LinkWordToSource(db, wID, sourceID, word+"。", "", 1); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+		if _, err := db.Exec(`UPDATE word_sources SET first_seen_at = ? WHERE word_id = ? AND source_id = ?`, seen, wID, sourceID); err != nil {
+			t.Fatalf("set first_seen_at: %v", err)
+		}
+		return wID
+	}
+
+	link("古い", s1, base.Add(-48*time.Hour))
+	link("今日", s1, base)
+	link("明日", s1, base.Add(24*time.Hour))
+	// 再 is linked inside the window by s2 but was first seen before it via s1.
+	link("再", s1, base.Add(-72*time.Hour))
+	link("再", s2, base.Add(time.Hour))
+	// A non-UTC bound covering the same instant must behave identically.
+	link("境界", s2, base.Add(2*time.Hour))
+
+	words, err := GetWordsFirstSeenBetween(db, base, base.Add(2*time.Hour).In(time.FixedZone("JST", 9*3600)))
+	if err != nil {
+		t.Fatalf("GetWordsFirstSeenBetween: %v", err)
+	}
+	if len(words) != 1 || words[0].Word != "今日" {
+		t.Fatalf("expected only 今日 in window, got %+v", words)
+	}
+
+	words, err = GetWordsFirstSeenBetween(db, base.Add(-100*time.Hour), base.Add(100*time.Hour))
+	if err != nil {
+		t.Fatalf("GetWordsFirstSeenBetween: %v", err)
+	}
+	var got []string
+	for _, w := range words {
+		got = append(got, w.Word)
+	}
+	want := []string{"再", "古い", "今日", "境界", "明日"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSourceImage(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	sID, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/img", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if img, err := GetSourceImage(db, sID); err != nil || img != "" {
+		t.Fatalf("expected no image on a new source, got %q (%v)", img, err)
+	}
+	if err := SetSourceImage(db, sID, "https://example.com/lead.jpg"); err != nil {
+		t.Fatalf("SetSourceImage: %v", err)
+	}
+	if img, err := GetSourceImage(db, sID); err != nil || img != "https://example.com/lead.jpg" {
+		t.Fatalf("GetSourceImage = %q (%v)", img, err)
+	}
+	if src, err := GetSource(db, sID); err != nil || src.ImageURL != "https://example.com/lead.jpg" {
+		t.Fatalf("GetSource image = %q (%v)", src.ImageURL, err)
+	}
+	if err := SetSourceImage(db, 999, "x"); err == nil {
+		t.Fatal("expected an error for a missing source")
+	}
+}
+
+func TestMergeWords(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s1, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/m1", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/m2", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	keep, err := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	kana, err := CreateOrGetWord(db, "ねこ", "ねこ", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	link := func(wordID, sourceID int64, context string, n int) {
+		t.Helper()
+		if err := LinkWordToSource(db, wordID, sourceID, context, "", n); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+	}
+	link(keep, s1, "猫がいる。", 2)
+	link(kana, s1, "ねこがいる。", 3)
+	link(kana, s2, "ねこが寝る。", 1)
+
+	var before int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_sources`).Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	preview, err := MergeWords(db, keep, []int64{kana}, true)
+	if err != nil {
+		t.Fatalf("dry-run MergeWords: %v", err)
+	}
+	if !preview.DryRun || len(preview.WordIDs) != 1 || preview.LinksMoved != 1 || preview.LinksRemoved != 1 || preview.ContextsRemoved != 1 {
+		t.Fatalf("unexpected dry-run report %+v", preview)
+	}
+	var after int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_sources`).Scan(&after); err != nil || after != before {
+		t.Fatalf("dry run changed word_sources: %d -> %d (%v)", before, after, err)
+	}
+	if err := requireWord(db, kana); err != nil {
+		t.Fatalf("dry run deleted the merged word: %v", err)
+	}
+
+	report, err := MergeWords(db, keep, []int64{kana}, false)
+	if err != nil {
+		t.Fatalf("MergeWords: %v", err)
+	}
+	preview.DryRun = false
+	if fmt.Sprint(report) != fmt.Sprint(preview) {
+		t.Errorf("dry run reported %+v, real run %+v", preview, report)
+	}
+
+	wss, err := GetWordSources(db, keep)
+	if err != nil {
+		t.Fatalf("get word sources: %v", err)
+	}
+	counts := map[int64]int{}
+	for _, ws := range wss {
+		counts[ws.SourceID] = ws.OccurrenceCount
+	}
+	if len(wss) != 2 || counts[s1] != 5 || counts[s2] != 1 {
+		t.Fatalf("expected combined counts {s1:5, s2:1}, got %v", counts)
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM words WHERE id = ?`, kana).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected merged word to be deleted, count %d (%v)", n, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_sources WHERE word_id NOT IN (SELECT id FROM words)`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected no orphaned word_sources, got %d (%v)", n, err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_contexts WHERE word_source_id NOT IN (SELECT id FROM word_sources)`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("expected no orphaned word_contexts, got %d (%v)", n, err)
+	}
+	// Both s1 contexts now belong to the kept word's s1 link.
+	if err := db.QueryRow(`SELECT COUNT(*) FROM word_contexts wc JOIN word_sources ws ON ws.id = wc.word_source_id
+		WHERE ws.word_id = ? AND ws.source_id = ?`, keep, s1).Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected 2 contexts on the kept s1 link, got %d (%v)", n, err)
+	}
+
+	if _, err := MergeWords(db, keep, []int64{keep}, false); err == nil {
+		t.Error("expected an error merging a word into itself")
+	}
+	if _, err := MergeWords(db, keep, []int64{9999}, false); err == nil {
+		t.Error("expected an error for a missing word")
+	}
+}
+
+func TestGetSourceProgressPercent(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	sID, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/pct", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if pct, err := GetSourceProgressPercent(db, sID); err != nil || pct != -1 {
+		t.Fatalf("expected -1 for an unknown total, got %v (%v)", pct, err)
+	}
+
+	if err := SetSourceTotalSentences(db, sID, 8); err != nil {
+		t.Fatalf("SetSourceTotalSentences: %v", err)
+	}
+	if pct, err := GetSourceProgressPercent(db, sID); err != nil || pct != 0 {
+		t.Fatalf("expected 0%% before any progress, got %v (%v)", pct, err)
+	}
+	// Sentences 0-5 done: 6 of 8.
+	if err := UpdateSourceProgress(db, sID, 5); err != nil {
+		t.Fatal(err)
+	}
+	if pct, err := GetSourceProgressPercent(db, sID); err != nil || pct != 75 {
+		t.Fatalf("expected 75%% after partial ingest, got %v (%v)", pct, err)
+	}
+	if _, err := GetSourceProgressPercent(db, 999); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a missing source, got %v", err)
+	}
+}
+
+func TestWordNotes(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	wID, err := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	if err := AddWordNote(db, wID, "Seen in the NHK article about cafes."); err != nil {
+		t.Fatalf("AddWordNote: %v", err)
+	}
+	if err := AddWordNote(db, wID, "Often written in katakana in manga."); err != nil {
+		t.Fatalf("AddWordNote: %v", err)
+	}
+
+	notes, err := GetWordNotes(db, wID)
+	if err != nil {
+		t.Fatalf("GetWordNotes: %v", err)
+	}
+	if len(notes) != 2 || notes[0].Note != "Seen in the NHK article about cafes." || notes[1].Note != "Often written in katakana in manga." {
+		t.Fatalf("expected both notes in insertion order, got %+v", notes)
+	}
+	if notes[0].WordID != wID || notes[0].CreatedAt.IsZero() || notes[1].CreatedAt.Before(notes[0].CreatedAt) {
+		t.Errorf("unexpected note metadata: %+v", notes)
+	}
+
+	if err := AddWordNote(db, wID, "  "); err == nil {
+		t.Error("expected an error for an empty note")
+	}
+	if err := AddWordNote(db, 9999, "orphan"); err == nil {
+		t.Error("expected an error for a missing word")
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	const url = "https://example.com/broken"
+	if _, err := GetSourceError(db, url); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for an unseen URL, got %v", err)
+	}
+	// A success for a URL that never failed is not tracked.
+	if err := RecordSourceSuccess(db, "https://example.com/fine"); err != nil {
+		t.Fatalf("RecordSourceSuccess: %v", err)
+	}
+	if _, err := GetSourceError(db, "https://example.com/fine"); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected successes alone not to be tracked, got %v", err)
+	}
+
+	for _, msg := range []string{"timeout", "status 500"} {
+		if err := RecordSourceFailure(db, url, msg); err != nil {
+			t.Fatalf("RecordSourceFailure: %v", err)
+		}
+	}
+	se, err := GetSourceError(db, url)
+	if err != nil {
+		t.Fatalf("GetSourceError: %v", err)
+	}
+	if se.Status != SourceStatusFailed || se.Attempts != 2 || se.Error != "status 500" || se.LastAttemptAt.IsZero() {
+		t.Fatalf("unexpected record: %+v", se)
+	}
+
+	if err := RecordSourceSuccess(db, url); err != nil {
+		t.Fatalf("RecordSourceSuccess: %v", err)
+	}
+	se, err = GetSourceError(db, url)
+	if err != nil {
+		t.Fatalf("GetSourceError: %v", err)
+	}
+	if se.Status != SourceStatusSucceeded || se.Attempts != 3 {
+		t.Fatalf("expected succeeded after 3 attempts, got %+v", se)
+	}
+	urls, err := GetFailedSourceURLs(db)
+	if err != nil || len(urls) != 0 {
+		t.Fatalf("expected no failed sources, got %v (err %v)", urls, err)
+	}
+}
+
+func TestGetBestExamplePrefersPrimarySource(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	shortID, err := CreateOrGetSource(db, "test", "Short", "", "", "http://short", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	longID, err := CreateOrGetSource(db, "test", "Long", "", "", "http://long", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wordID, err := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const short, long = "猫だ。", "庭で昼寝をしている猫はとても気持ちよさそうだ。"
+	if err := LinkWordToSource(db, wordID, shortID, short, short, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := LinkWordToSource(db, wordID, longID, long, long, 1); err != nil {
+		t.Fatal(err)
+	}
+	score := func(sentence string) int { return readerer.ScoreSentence(sentence, "猫") }
+
+	// Without a primary source, the better-scoring (longer) example wins.
+	got, err := GetBestExample(db, wordID, score)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != long {
+		t.Fatalf("expected the higher-scoring example %q, got %q", long, got)
+	}
+
+	if err := SetPrimarySource(db, wordID, shortID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = GetBestExample(db, wordID, score); err != nil {
+		t.Fatal(err)
+	}
+	if got != short {
+		t.Fatalf("expected the primary source's example %q, got %q", short, got)
+	}
+
+	// Equal scores go to the source with more occurrences.
+	links := []WordSource{
+		{SourceID: 1, ExampleSentence: "a", OccurrenceCount: 1},
+		{SourceID: 2, ExampleSentence: "b", OccurrenceCount: 5},
+	}
+	if best, ok := BestExample(links, func(string) int { return 0 }); !ok || best.SourceID != 2 {
+		t.Fatalf("expected the most frequent source on a tie, got %+v (ok %v)", best, ok)
+	}
+	if _, ok := BestExample([]WordSource{{SourceID: 1, IsPrimary: true}}, score); ok {
+		t.Fatal("expected no example when no link has one")
+	}
+}
+
+func TestVerifyLinks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	wID, err := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	sID, err := CreateOrGetSource(db, "website", "Title", "", "", "http://example.com/verify", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if err := LinkWordToSource(db, wID, sID, "猫がいる。", "猫がいる。", 1); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	if issues, err := VerifyLinks(db); err != nil || len(issues) != 0 {
+		t.Fatalf("expected a clean database, got %v (%v)", issues, err)
+	}
+
+	// Foreign keys would refuse the dangling id, so switch them off to corrupt the row.
+	if _, err := db.Exec(`PRAGMA foreign_keys = OFF`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`UPDATE word_sources SET context_sentence_id = 999, occurrence_count = -2`); err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := VerifyLinks(db)
+	if err != nil {
+		t.Fatalf("VerifyLinks: %v", err)
+	}
+	if len(issues) != 2 {
+		t.Fatalf("expected 2 issues, got %v", issues)
+	}
+	if issues[0].Kind != IssueDanglingContext || issues[0].Value != 999 || issues[0].WordID != wID || issues[0].SourceID != sID {
+		t.Errorf("expected the dangling context id to be flagged, got %+v", issues[0])
+	}
+	if issues[1].Kind != IssueNegativeCount || issues[1].Value != -2 {
+		t.Errorf("expected the negative count to be flagged, got %+v", issues[1])
+	}
+}
+
+func TestUpsertWithoutReturning(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	returningOverride = func() bool { return false }
+	defer func() { returningOverride = nil }()
+
+	id1, err := CreateOrGetWord(db, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	id2, err := CreateOrGetWord(db, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatalf("create word: %v", err)
+	}
+	// The conflict branch must return the existing id, not the last inserted one.
+	again, err := CreateOrGetWord(db, "猫", "猫", "", `[{"senses":["cat"]}]`, "ja")
+	if err != nil {
+		t.Fatalf("upsert word: %v", err)
+	}
+	if id1 == id2 || again != id1 {
+		t.Fatalf("expected distinct ids and the existing id on conflict, got %d, %d, %d", id1, id2, again)
+	}
+
+	sID, err := CreateOrGetSource(db, "website", "Title", "", "", "http://example.com/noreturning", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	for _, ctx := range []string{"猫がいる。", "猫が寝る。"} {
+		if err := LinkWordToSource(db, id1, sID, ctx, ctx, 1); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+	}
+	if err := LinkWordToSource(db, id2, sID, "犬がいる。", "", 1); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+	for wordID, want := range map[int64]int{id1: 2, id2: 1} {
+		var count, contexts int
+		if err := db.QueryRow(`SELECT ws.occurrence_count, (SELECT COUNT(*) FROM word_contexts wc WHERE wc.word_source_id = ws.id)
+			FROM word_sources ws WHERE ws.word_id = ? AND ws.source_id = ?`, wordID, sID).Scan(&count, &contexts); err != nil {
+			t.Fatalf("query link of word %d: %v", wordID, err)
+		}
+		if count != want || contexts != want {
+			t.Errorf("word %d: expected %d occurrences and contexts, got %d and %d", wordID, want, count, contexts)
+		}
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	for version, want := range map[string]bool{
+		"3.35.0": true, "3.45.1": true, "4.0.0": true, "3.34.1": false, "2.99.0": false, "": false, "bogus": false,
+	} {
+		if got := versionAtLeast(version, 3, 35); got != want {
+			t.Errorf("versionAtLeast(%q, 3, 35) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestGetWordsBySourceCount(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	s1, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/a", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	s2, err := CreateOrGetSource(db, "website_article", "", "", "example.com", "https://example.com/b", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	link := func(word string, sourceID int64, count int) {
+		t.Helper()
+		wID, err := CreateOrGetWord(db, word, word, "", "", "ja")
+		if err != nil {
+			t.Fatalf("create word: %v", err)
+		}
+		if err := LinkWordToSource(db, wID, sourceID, word+"。", "", count); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+	}
+	link("猫", s1, 1)
+	link("猫", s2, 1)
+	// More occurrences, but all in one source.
+	link("犬", s1, 10)
+
+	words, err := GetWordsBySourceCount(db, 2)
+	if err != nil {
+		t.Fatalf("GetWordsBySourceCount: %v", err)
+	}
+	if len(words) != 1 || words[0].Word != "猫" {
+		t.Fatalf("expected only 猫 to be in 2 sources, got %+v", words)
+	}
+
+	if words, err = GetWordsBySourceCount(db, 1); err != nil || len(words) != 2 || words[0].Word != "猫" {
+		t.Fatalf("expected 猫 then 犬 for minSources=1, got %+v (%v)", words, err)
+	}
+}
+
+func TestGetRecentSourcesWithTopWords(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	older, err := CreateOrGetSource(db, "website_article", "Older", "", "example.com", "https://example.com/a", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	newer, err := CreateOrGetSource(db, "website_article", "Newer", "", "example.com", "https://example.com/b", "")
+	if err != nil {
+		t.Fatalf("create source: %v", err)
+	}
+	if _, err := db.Exec(`UPDATE sources SET added_at = ? WHERE id = ?`, "2020-01-01 00:00:00", older); err != nil {
+		t.Fatalf("backdate source: %v", err)
+	}
+	link := func(word string, sourceID int64, count int) {
+		t.Helper()
+		wID, err := CreateOrGetWord(db, word, word, "", "", "ja")
+		if err != nil {
+			t.Fatalf("create word: %v", err)
+		}
+		if err := LinkWordToSource(db, wID, sourceID, word+"。", "", count); err != nil {
+			t.Fatalf("link: %v", err)
+		}
+	}
+	link("猫", older, 5)
+	link("犬", older, 3)
+	link("鳥", older, 1)
+	link("魚", newer, 7)
+	link("猫", newer, 2)
+
+	got, err := GetRecentSourcesWithTopWords(db, 10, 2)
+	if err != nil {
+		t.Fatalf("GetRecentSourcesWithTopWords: %v", err)
+	}
+	if len(got) != 2 || got[0].Source.ID != newer || got[1].Source.ID != older {
+		t.Fatalf("expected newer then older source, got %+v", got)
+	}
+	words := func(sw SourceWithWords) string {
+		var out []string
+		for _, wf := range sw.Words {
+			out = append(out, fmt.Sprintf("%s:%d", wf.Word.Word, wf.Count))
+		}
+		return strings.Join(out, " ")
+	}
+	if w := words(got[0]); w != "魚:7 猫:2" {
+		t.Errorf("newer source words = %v", w)
+	}
+	// 鳥 is cut by wordsPerSource; counts are per source, not totals.
+	if w := words(got[1]); w != "猫:5 犬:3" {
+		t.Errorf("older source words = %v", w)
+	}
+
+	if got, err = GetRecentSourcesWithTopWords(db, 1, 5); err != nil || len(got) != 1 || got[0].Source.Title != "Newer" {
+		t.Fatalf("expected only the newest source for sourceLimit=1, got %+v (%v)", got, err)
+	}
+	if _, err := GetRecentSourcesWithTopWords(db, 0, 5); err == nil {
+		t.Error("expected an error for sourceLimit=0")
+	}
+}
+
+// racingExecutor makes the first failures source inserts fail as if a concurrent writer
+// had inserted the same source first.
+type racingExecutor struct {
+	DBExecutor
+	failures int
+}
+
+func (r *racingExecutor) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if r.failures > 0 && strings.HasPrefix(query, "INSERT INTO sources") {
+		r.failures--
+		return nil, errors.New("UNIQUE constraint failed: sources.url")
+	}
+	return r.DBExecutor.Exec(query, args...)
+}
+
+func TestCreateOrGetSourceRetryBudget(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(retries int, backoff time.Duration) {
+		SourceRetries, SourceRetryBackoff = retries, backoff
+	}(SourceRetries, SourceRetryBackoff)
+	SourceRetryBackoff = time.Microsecond
+
+	if _, err := CreateOrGetSource(&racingExecutor{DBExecutor: db, failures: 4}, "website", "", "", "", "https://example.com/race", ""); err == nil {
+		t.Fatal("expected the default budget of 3 attempts to run out")
+	}
+
+	SourceRetries = 6
+	id, err := CreateOrGetSource(&racingExecutor{DBExecutor: db, failures: 4}, "website", "", "", "", "https://example.com/race", "")
+	if err != nil {
+		t.Fatalf("expected success within 6 attempts: %v", err)
+	}
+	if id <= 0 {
+		t.Fatalf("expected a source id, got %d", id)
+	}
+}
+
+// racingTx is racingExecutor for a transaction.
+type racingTx struct {
+	*sql.Tx
+	failures int
+}
+
+func (r *racingTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	if r.failures > 0 && strings.HasPrefix(query, "INSERT INTO sources") {
+		r.failures--
+		return nil, errors.New("UNIQUE constraint failed: sources.url")
+	}
+	return r.Tx.Exec(query, args...)
+}
+
+func TestCreateOrGetSourceRetriesInTxWithoutBackoff(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	defer func(backoff time.Duration) { SourceRetryBackoff = backoff }(SourceRetryBackoff)
+	SourceRetryBackoff = time.Minute
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	start := time.Now()
+	if _, err := CreateOrGetSource(&racingTx{Tx: tx, failures: 2}, "website", "", "", "", "https://example.com/race", ""); err != nil {
+		t.Fatalf("expected success within the default budget: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("expected no backoff inside a transaction, took %v", elapsed)
+	}
+}
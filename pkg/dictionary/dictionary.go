@@ -1,11 +1,17 @@
 package dictionary
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 )
 
+// ErrDictionaryEmpty is returned by LoadJMdictSimplified when the file parses but holds no
+// entries (e.g. `{}` or `[]`), as opposed to a parse error.
+var ErrDictionaryEmpty = errors.New("dictionary contains no entries")
+
 // JMdictEntry matches the structure of jmdict-simplified entries.
 type JMdictEntry struct {
 	Id    string          `json:"id"`
@@ -23,6 +29,8 @@ type JMdictElement struct {
 type JMdictSense struct {
 	PartOfSpeech []string      `json:"partOfSpeech"`
 	Gloss        []JMdictGloss `json:"gloss"`
+	Misc         []string      `json:"misc"`  // usage tags, e.g. "col" (colloquial), "arch" (archaic)
+	Field        []string      `json:"field"` // domain tags, e.g. "comp" (computing), "med" (medicine)
 }
 
 type JMdictGloss struct {
@@ -34,11 +42,13 @@ type JMdictGloss struct {
 type DefinitionEntry struct {
 	Senses []string `json:"senses"`
 	POS    []string `json:"pos"`
+	Misc   []string `json:"misc,omitempty"`
+	Field  []string `json:"field,omitempty"`
 }
 
 // LoadJMdictSimplified reads a JSON file (array of entries) and returns them.
-// Note: Real files are large, so in production we might want to stream this.
-// For now, we'll load specific chunks or a full file if memory allows.
+// Note: Real files are large; StreamJMdictSimplified reads them one entry at a time
+// when the whole dictionary doesn't need to be in memory.
 func LoadJMdictSimplified(path string) ([]JMdictEntry, error) {
 	f, err := os.Open(path)
 	if err != nil {
@@ -51,7 +61,8 @@ func LoadJMdictSimplified(path string) ([]JMdictEntry, error) {
 	}
 	// Try parsing as full object wrapper first { "words": [...] }
 	dec := json.NewDecoder(f)
-	if err := dec.Decode(&getEntries); err == nil && len(getEntries.Words) > 0 {
+	objErr := dec.Decode(&getEntries)
+	if objErr == nil && len(getEntries.Words) > 0 {
 		return getEntries.Words, nil
 	}
 
@@ -62,7 +73,94 @@ func LoadJMdictSimplified(path string) ([]JMdictEntry, error) {
 	var entries []JMdictEntry
 	dec = json.NewDecoder(f)
 	if err := dec.Decode(&entries); err != nil {
+		if objErr == nil {
+			// A valid object without any words.
+			return nil, fmt.Errorf("%s: %w", path, ErrDictionaryEmpty)
+		}
 		return nil, fmt.Errorf("failed to parse dictionary as object or array: %w", err)
 	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, ErrDictionaryEmpty)
+	}
 	return entries, nil
 }
+
+// StreamJMdictSimplified reads the same files as LoadJMdictSimplified (a bare array of
+// entries or an object with a "words" array), calling fn for each entry in file order
+// without keeping them. An error from fn stops the read and is returned as is. A file
+// without any entries yields ErrDictionaryEmpty.
+func StreamJMdictSimplified(path string, fn func(JMdictEntry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+	n := 0
+	// readEntries decodes the elements of an array whose '[' was just consumed.
+	readEntries := func() error {
+		for dec.More() {
+			var e JMdictEntry
+			if err := dec.Decode(&e); err != nil {
+				return fmt.Errorf("failed to parse dictionary entry %d: %w", n, err)
+			}
+			n++
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to parse dictionary: %w", err)
+		}
+		return nil
+	}
+
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("failed to parse dictionary: %w", err)
+	}
+	switch tok {
+	case json.Delim('['):
+		if err := readEntries(); err != nil {
+			return err
+		}
+	case json.Delim('{'):
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("failed to parse dictionary: %w", err)
+			}
+			if key != "words" {
+				// Metadata such as "version" or "tags"; skip it.
+				var skip json.RawMessage
+				if err := dec.Decode(&skip); err != nil {
+					return fmt.Errorf("failed to parse dictionary: %w", err)
+				}
+				continue
+			}
+			tok, err := dec.Token()
+			if err != nil {
+				return fmt.Errorf("failed to parse dictionary: %w", err)
+			}
+			if tok == nil {
+				continue // "words": null
+			}
+			if tok != json.Delim('[') {
+				return fmt.Errorf("failed to parse dictionary: \"words\" is not an array")
+			}
+			if err := readEntries(); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to parse dictionary: %w", err)
+		}
+	default:
+		return fmt.Errorf("failed to parse dictionary as object or array: unexpected %v", tok)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", path, ErrDictionaryEmpty)
+	}
+	return nil
+}
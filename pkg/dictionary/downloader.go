@@ -9,19 +9,53 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 )
 
 const (
-	defaultDictFileName = "jmdict-eng-common.json"
-	repoOwner           = "scriptin"
-	repoName            = "jmdict-simplified"
+	// DefaultGlossLang is the JMdict gloss language used when none is configured.
+	DefaultGlossLang = "eng"
+	repoOwner        = "scriptin"
+	repoName         = "jmdict-simplified"
 )
 
+// releasesAPIURL is the GitHub endpoint describing the latest dictionary release.
+// It is a variable so tests can point it at a local server.
+var releasesAPIURL = fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", repoOwner, repoName)
+
+// DefaultDictDir returns the directory used to cache the dictionary when none is
+// configured: the OS user cache directory (e.g. ~/.cache/readerer). If the cache
+// directory cannot be determined it falls back to the current directory.
+func DefaultDictDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, "readerer")
+}
+
+// DictPath returns the path of the cached English dictionary file inside dir.
+func DictPath(dir string) string {
+	return DictPathForLang(dir, DefaultGlossLang)
+}
+
+// DictPathForLang returns the path of the cached dictionary with glosses in lang
+// (a JMdict language code such as "eng" or "ger") inside dir.
+func DictPathForLang(dir, lang string) string {
+	return filepath.Join(dir, "jmdict-"+lang+"-common.json")
+}
+
 // EnsureDictionary checks if the dictionary exists at path.
 // If not, it discovers the latest release from GitHub, downloads it, and decompresses it.
+// The parent directory of path is created if missing.
 func EnsureDictionary(ctx context.Context, path string) error {
+	return EnsureDictionaryLang(ctx, path, DefaultGlossLang)
+}
+
+// EnsureDictionaryLang is EnsureDictionary for the jmdict-<lang>-common release asset.
+func EnsureDictionaryLang(ctx context.Context, path, lang string) error {
 	if _, err := os.Stat(path); err == nil {
 		// File exists
 		return nil
@@ -30,8 +64,17 @@ func EnsureDictionary(ctx context.Context, path string) error {
 	}
 
 	fmt.Printf("Dictionary not found at %s. Attempting auto-download...\n", path)
+	return fetchDictionary(ctx, path, lang)
+}
 
-	downloadURL, err := getLatestReleaseAssetURL(ctx)
+// fetchDictionary downloads the latest jmdict-<lang>-common release to path, replacing
+// any file there only once the download is complete and parses.
+func fetchDictionary(ctx context.Context, path, lang string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create dictionary directory: %w", err)
+	}
+
+	downloadURL, err := getLatestReleaseAssetURL(ctx, releaseCachePath(path), lang)
 	if err != nil {
 		return fmt.Errorf("failed to find latest dictionary release: %w", err)
 	}
@@ -40,50 +83,190 @@ func EnsureDictionary(ctx context.Context, path string) error {
 	return downloadAndExtract(ctx, downloadURL, path)
 }
 
-func getLatestReleaseAssetURL(ctx context.Context) (string, error) {
-	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s/releases/latest", repoOwner, repoName)
+// RefreshDictionary downloads a fresh copy of the dictionary over any cached one at path.
+// Use it to recover from a truncated or otherwise corrupt cache file. The cached file is
+// only replaced once the new download is complete and parses, so a failed refresh leaves
+// it in place.
+func RefreshDictionary(ctx context.Context, path string) error {
+	return RefreshDictionaryLang(ctx, path, DefaultGlossLang)
+}
+
+// RefreshDictionaryLang is RefreshDictionary for the jmdict-<lang>-common release asset.
+func RefreshDictionaryLang(ctx context.Context, path, lang string) error {
+	return fetchDictionary(ctx, path, lang)
+}
+
+// releaseCache is the conditional-request metadata persisted next to the dictionary file
+// so repeat lookups of the latest release can be answered with 304 Not Modified.
+type releaseCache struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	AssetURL     string `json:"asset_url"`
+}
+
+// releaseCachePath returns where release metadata for the dictionary at dictPath is cached.
+func releaseCachePath(dictPath string) string {
+	return dictPath + ".release.json"
+}
+
+func loadReleaseCache(path string) (releaseCache, bool) {
+	var c releaseCache
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, false
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.AssetURL == "" {
+		return releaseCache{}, false
+	}
+	return c, true
+}
+
+func saveReleaseCache(path string, c releaseCache) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// releaseAsset is one downloadable file of a GitHub release.
+type releaseAsset struct {
+	Name               string `json:"name"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// findDictAsset returns the common-words dictionary for lang among assets,
+// e.g. jmdict-eng-common-3.6.2.json.tgz for "eng".
+func findDictAsset(assets []releaseAsset, lang string) (releaseAsset, bool) {
+	prefix := "jmdict-" + lang + "-common-"
+	for _, asset := range assets {
+		// .json.tgz is the current format; .json.gz is accepted if published.
+		if strings.HasPrefix(asset.Name, prefix) && (strings.HasSuffix(asset.Name, ".json.tgz") || strings.HasSuffix(asset.Name, ".json.gz")) {
+			return asset, true
+		}
+	}
+	return releaseAsset{}, false
+}
+
+// getLatestReleaseAssetURL returns the download URL of the dictionary asset for lang in the
+// latest release. It sends If-None-Match/If-Modified-Since from the metadata cached at cachePath
+// and reuses the cached URL on 304, sparing the GitHub rate limit.
+func getLatestReleaseAssetURL(ctx context.Context, cachePath, lang string) (string, error) {
+	cached, haveCache := loadReleaseCache(cachePath)
+
 	client := &http.Client{Timeout: 10 * time.Second}
-	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", releasesAPIURL, nil)
 	if err != nil {
 		return "", err
 	}
 	// Add User-Agent as required by GitHub API
 	req.Header.Set("User-Agent", "readerer-cli")
+	if haveCache {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	resp, err := client.Do(req)
+	resp, err := doWithRetry(ctx, client, req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && haveCache {
+		return cached.AssetURL, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return "", fmt.Errorf("github api returned status: %s", resp.Status)
 	}
 
 	var release struct {
-		Assets []struct {
-			Name               string `json:"name"`
-			BrowserDownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
+		Assets []releaseAsset `json:"assets"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
 		return "", err
 	}
 
-	// Find the English common dictionary
-	// Pattern: jmdict-eng-common-*.json.tgz (or .json.gz if available, but .tgz is current)
-	for _, asset := range release.Assets {
-		if strings.Contains(asset.Name, "jmdict-eng-common") && (strings.HasSuffix(asset.Name, ".json.tgz") || strings.HasSuffix(asset.Name, ".json.gz")) {
-			return asset.BrowserDownloadURL, nil
+	asset, ok := findDictAsset(release.Assets, lang)
+	if !ok {
+		return "", fmt.Errorf("no jmdict-%s-common dictionary asset found in latest release", lang)
+	}
+	c := releaseCache{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		AssetURL:     asset.BrowserDownloadURL,
+	}
+	if c.ETag != "" || c.LastModified != "" {
+		// Caching is an optimization; a failed write only costs a full request next time.
+		_ = saveReleaseCache(cachePath, c)
+	}
+	return asset.BrowserDownloadURL, nil
+}
+
+// releaseAPIAttempts is how many times the releases API is tried before giving up.
+const releaseAPIAttempts = 3
+
+// releaseRetryDelay is the wait before the first retry; it doubles after each attempt.
+// It is a variable so tests can shorten it.
+var releaseRetryDelay = time.Second
+
+// doWithRetry sends req, retrying with exponential backoff on network errors and on
+// 5xx or 429 responses. Other statuses (including 404) are returned at once. After the
+// last attempt the final response or error is returned as is; ctx cancellation stops
+// the wait between attempts.
+func doWithRetry(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	delay := releaseRetryDelay
+	for attempt := 1; ; attempt++ {
+		resp, err := client.Do(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if attempt == releaseAPIAttempts || ctx.Err() != nil {
+			return resp, err
+		}
+		if err == nil {
+			resp.Body.Close()
 		}
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
 	}
+}
 
-	return "", fmt.Errorf("no suitable dictionary asset found in latest release")
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusTooManyRequests
 }
 
+// downloadAndExtract writes the dictionary to a temporary file next to destPath and
+// renames it into place only once extraction succeeds and the file parses as a
+// dictionary, so an interrupted or bad download never replaces destPath.
 func downloadAndExtract(ctx context.Context, url, destPath string) error {
-	// Create temp file for download
+	tmpPath := destPath + ".part"
+	if err := extractTo(ctx, url, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Check the whole file parses before it replaces a working cached copy.
+	if err := StreamJMdictSimplified(tmpPath, func(JMdictEntry) error { return nil }); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("downloaded dictionary is invalid: %w", err)
+	}
+	if err := os.Rename(tmpPath, destPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move dictionary into place: %w", err)
+	}
+	return nil
+}
+
+func extractTo(ctx context.Context, url, destPath string) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
@@ -114,16 +297,7 @@ func downloadAndExtract(ctx context.Context, url, destPath string) error {
 
 	if strings.HasSuffix(url, ".gz") && !strings.HasSuffix(url, ".tar.gz") && !strings.HasSuffix(url, ".tgz") {
 		// Plain gzip file (e.g. .json.gz), not an archive
-		outFile, err := os.Create(destPath)
-		if err != nil {
-			return fmt.Errorf("failed to create output file: %w", err)
-		}
-		defer outFile.Close()
-
-		if _, err := io.Copy(outFile, gzReader); err != nil {
-			return fmt.Errorf("failed to write to file: %w", err)
-		}
-		return nil
+		return writeFile(destPath, gzReader)
 	}
 
 	// Try treating it as a tar stream
@@ -143,14 +317,8 @@ func downloadAndExtract(ctx context.Context, url, destPath string) error {
 
 		if header.Typeflag == tar.TypeReg && strings.HasSuffix(header.Name, ".json") {
 			// Found the JSON file
-			outFile, err := os.Create(destPath)
-			if err != nil {
-				return fmt.Errorf("failed to create output file: %w", err)
-			}
-			defer outFile.Close()
-
-			if _, err := io.Copy(outFile, tarReader); err != nil {
-				return fmt.Errorf("failed to write to file: %w", err)
+			if err := writeFile(destPath, tarReader); err != nil {
+				return err
 			}
 			found = true
 			break
@@ -163,3 +331,20 @@ func downloadAndExtract(ctx context.Context, url, destPath string) error {
 
 	return nil
 }
+
+// writeFile copies r into a newly created file at path, reporting close errors so
+// a short write is never mistaken for success.
+func writeFile(path string, r io.Reader) error {
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if _, err := io.Copy(outFile, r); err != nil {
+		outFile.Close()
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write to file: %w", err)
+	}
+	return nil
+}
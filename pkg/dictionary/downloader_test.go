@@ -1,10 +1,18 @@
 package dictionary
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestEnsureDictionary_LocalCache(t *testing.T) {
@@ -30,3 +38,214 @@ func TestEnsureDictionary_LocalCache(t *testing.T) {
 		t.Fatalf("EnsureDictionary failed with local file: %v", err)
 	}
 }
+
+// newReleaseServer serves a fake GitHub "latest release" document whose single
+// asset is a .tgz archive containing dictJSON. It points releasesAPIURL at the
+// server for the duration of the test.
+func newReleaseServer(t *testing.T, dictJSON string) *httptest.Server {
+	t.Helper()
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Name: "jmdict-eng-common.json", Mode: 0644, Size: int64(len(dictJSON)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("tar header: %v", err)
+	}
+	if _, err := tw.Write([]byte(dictJSON)); err != nil {
+		t.Fatalf("tar write: %v", err)
+	}
+	tw.Close()
+	gz.Close()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	mux.HandleFunc("/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"assets":[{"name":"jmdict-eng-common-3.6.2.json.tgz","browser_download_url":%q}]}`, srv.URL+"/download/jmdict-eng-common-3.6.2.json.tgz")
+	})
+	mux.HandleFunc("/download/jmdict-eng-common-3.6.2.json.tgz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	})
+	t.Cleanup(srv.Close)
+
+	orig := releasesAPIURL
+	releasesAPIURL = srv.URL + "/releases/latest"
+	t.Cleanup(func() { releasesAPIURL = orig })
+	return srv
+}
+
+func TestEnsureDictionary_DownloadsIntoConfiguredDir(t *testing.T) {
+	newReleaseServer(t, `{"words":[{"id":"1","kanji":[{"text":"犬","common":true}],"kana":[{"text":"いぬ","common":true}],"sense":[{"gloss":[{"text":"dog"}],"partOfSpeech":["n"]}]}]}`)
+
+	// The directory does not exist yet; EnsureDictionary must create it.
+	dir := filepath.Join(t.TempDir(), "cache", "readerer")
+	path := DictPath(dir)
+
+	if err := EnsureDictionary(context.Background(), path); err != nil {
+		t.Fatalf("EnsureDictionary failed: %v", err)
+	}
+
+	if filepath.Dir(path) != dir {
+		t.Fatalf("expected dictionary inside %s, got %s", dir, path)
+	}
+	entries, err := LoadJMdictSimplified(path)
+	if err != nil {
+		t.Fatalf("load downloaded dictionary: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Kanji[0].Text != "犬" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestRefreshDictionary_ReplacesCorruptFile(t *testing.T) {
+	newReleaseServer(t, `{"words":[{"id":"1","kanji":[{"text":"猫","common":true}],"kana":[{"text":"ねこ","common":true}],"sense":[{"gloss":[{"text":"cat"}],"partOfSpeech":["n"]}]}]}`)
+
+	path := DictPath(t.TempDir())
+	// Simulate an interrupted download that left truncated JSON behind.
+	if err := os.WriteFile(path, []byte(`{"words":[{"id":"1","kan`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadJMdictSimplified(path); err == nil {
+		t.Fatal("expected corrupt dictionary to fail loading")
+	}
+
+	// EnsureDictionary alone keeps the corrupt cache.
+	if err := EnsureDictionary(context.Background(), path); err != nil {
+		t.Fatalf("EnsureDictionary failed: %v", err)
+	}
+	if _, err := LoadJMdictSimplified(path); err == nil {
+		t.Fatal("expected EnsureDictionary to leave existing file untouched")
+	}
+
+	if err := RefreshDictionary(context.Background(), path); err != nil {
+		t.Fatalf("RefreshDictionary failed: %v", err)
+	}
+	entries, err := LoadJMdictSimplified(path)
+	if err != nil {
+		t.Fatalf("load refreshed dictionary: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Kanji[0].Text != "猫" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary download file to be cleaned up, stat err: %v", err)
+	}
+}
+
+func TestRefreshDictionary_KeepsCacheOnFailedDownload(t *testing.T) {
+	newReleaseServer(t, `<html>rate limited</html>`)
+
+	path := DictPath(t.TempDir())
+	cached := `{"words":[{"id":"1","kanji":[{"text":"犬"}],"kana":[{"text":"いぬ"}],"sense":[{"gloss":[{"text":"dog"}]}]}]}`
+	if err := os.WriteFile(path, []byte(cached), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RefreshDictionary(context.Background(), path); err == nil {
+		t.Fatal("expected an invalid download to fail the refresh")
+	}
+	got, err := os.ReadFile(path)
+	if err != nil || string(got) != cached {
+		t.Fatalf("expected the cached dictionary to be kept, got %q (%v)", got, err)
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary download file to be cleaned up, stat err: %v", err)
+	}
+}
+
+func TestGetLatestReleaseAssetURL_UsesETagCache(t *testing.T) {
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, `{"assets":[{"name":"jmdict-eng-common-3.6.2.json.tgz","browser_download_url":"http://example.invalid/dict.tgz"}]}`)
+	}))
+	defer srv.Close()
+	orig := releasesAPIURL
+	releasesAPIURL = srv.URL
+	defer func() { releasesAPIURL = orig }()
+
+	cachePath := releaseCachePath(DictPath(t.TempDir()))
+	for i := 0; i < 2; i++ {
+		url, err := getLatestReleaseAssetURL(context.Background(), cachePath, "eng")
+		if err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+		if url != "http://example.invalid/dict.tgz" {
+			t.Fatalf("call %d: unexpected asset url %q", i, url)
+		}
+	}
+	if full != 1 || notModified != 1 {
+		t.Fatalf("expected 1 full response and 1 304, got %d and %d", full, notModified)
+	}
+}
+
+func TestFindDictAssetPicksLanguage(t *testing.T) {
+	assets := []releaseAsset{
+		{Name: "jmdict-all-3.6.2.json.tgz", BrowserDownloadURL: "all"},
+		{Name: "jmdict-eng-3.6.2.json.tgz", BrowserDownloadURL: "eng-full"},
+		{Name: "jmdict-eng-common-3.6.2.json.tgz", BrowserDownloadURL: "eng"},
+		{Name: "jmdict-ger-common-3.6.2.json.zip", BrowserDownloadURL: "ger-zip"},
+		{Name: "jmdict-ger-common-3.6.2.json.tgz", BrowserDownloadURL: "ger"},
+		{Name: "jmnedict-all-3.6.2.json.tgz", BrowserDownloadURL: "names"},
+	}
+	for lang, want := range map[string]string{"eng": "eng", "ger": "ger"} {
+		got, ok := findDictAsset(assets, lang)
+		if !ok || got.BrowserDownloadURL != want {
+			t.Errorf("findDictAsset(%q) = %+v, %v; want %s", lang, got, ok, want)
+		}
+	}
+	if got, ok := findDictAsset(assets, "fre"); ok {
+		t.Errorf("expected no asset for fre, got %+v", got)
+	}
+	if got := DictPathForLang("cache", "ger"); got != filepath.Join("cache", "jmdict-ger-common.json") {
+		t.Errorf("DictPathForLang = %q", got)
+	}
+}
+
+func TestGetLatestReleaseAssetURL_RetriesTransientErrors(t *testing.T) {
+	origDelay := releaseRetryDelay
+	releaseRetryDelay = time.Millisecond
+	defer func() { releaseRetryDelay = origDelay }()
+
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"assets":[{"name":"jmdict-eng-common-3.6.2.json.tgz","browser_download_url":"http://example.invalid/dict.tgz"}]}`)
+	}))
+	defer srv.Close()
+	orig := releasesAPIURL
+	releasesAPIURL = srv.URL
+	defer func() { releasesAPIURL = orig }()
+
+	url, err := getLatestReleaseAssetURL(context.Background(), releaseCachePath(DictPath(t.TempDir())), "eng")
+	if err != nil {
+		t.Fatalf("expected success after retries, got %v", err)
+	}
+	if url != "http://example.invalid/dict.tgz" || calls != 3 {
+		t.Fatalf("got %q after %d calls; want the asset after 3", url, calls)
+	}
+
+	// 404 is not transient and must fail on the first attempt.
+	calls = 0
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.NotFound(w, r)
+	}))
+	defer notFound.Close()
+	releasesAPIURL = notFound.URL
+	if _, err := getLatestReleaseAssetURL(context.Background(), releaseCachePath(DictPath(t.TempDir())), "eng"); err == nil {
+		t.Fatal("expected an error for 404")
+	}
+	if calls != 1 {
+		t.Fatalf("expected 404 not to be retried, got %d calls", calls)
+	}
+}
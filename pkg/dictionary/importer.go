@@ -1,13 +1,16 @@
 package dictionary
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"sort"
-	"sync"
+	"strings"
 
 	"github.com/japaniel/readerer/pkg/db"
+	"golang.org/x/text/unicode/norm"
 )
 
 // Importer handles dictionary matching and updating.
@@ -15,22 +18,73 @@ type Importer struct {
 	conn *sql.DB
 	// Maps to speed up lookups.
 	// Key: string (Kanji or Kana), Value: List of matching JMdictEntry
-	// Note: `index` is read concurrently by multiple goroutines; guard reads with `mu` to
-	// protect against future code that might mutate the map. If the index is never
-	// mutated after creation this is a no-op, but the mutex provides safety for later changes.
-	mu    sync.RWMutex
+	// index is built by NewImporterWithOptions and never modified afterwards, so it is read
+	// concurrently by many goroutines without locking. Code that changes it must add a lock.
 	index map[string][]JMdictEntry
+
+	// GlossLang keeps only glosses in this JMdict language (e.g. "eng", "ger") in lookup
+	// results; glosses without a language count as "eng". Empty keeps every gloss.
+	GlossLang string
+
+	// MinOccurrencesForDefinition makes ProcessUpdates skip words seen fewer than this many
+	// times across all sources. 0 looks up every word. It only affects these backfills: the
+	// ingest.Ingester still looks up every word inline, since a word's count is not known
+	// until its source has been ingested.
+	MinOccurrencesForDefinition int
+
+	// Formatter turns matched entries into the stored definitions string. nil means
+	// JSONFormatter.
+	Formatter DefinitionFormatter
+
+	// CheckpointScope identifies the dictionary and the kind of run (e.g. "import-dict:"
+	// plus the file path) in ProcessUpdatesCtx's checkpoint. Together with GlossLang and
+	// MinOccurrencesForDefinition it selects the checkpoint, so a run only resumes after
+	// words examined by an interrupted run with the same dictionary and options.
+	CheckpointScope string
 }
 
+// indexCancelCheckInterval is how many entries NewImporterCtx indexes between context checks.
+const indexCancelCheckInterval = 1024
+
 // NewImporter creates an importer and builds an in-memory index of the provided dictionary.
 func NewImporter(conn *sql.DB, entries []JMdictEntry) *Importer {
+	im, _ := NewImporterCtx(context.Background(), conn, entries)
+	return im
+}
+
+// NewImporterCtx is like NewImporter but stops building the index when ctx is canceled,
+// returning ctx's error and no importer.
+func NewImporterCtx(ctx context.Context, conn *sql.DB, entries []JMdictEntry) (*Importer, error) {
+	return NewImporterWithOptions(ctx, conn, entries, ImporterOptions{})
+}
+
+// ImporterOptions tunes the in-memory index built by NewImporterWithOptions.
+type ImporterOptions struct {
+	// LeanIndex indexes entries that have kanji forms under those forms only, adding their
+	// kana forms just when a sense is tagged "uk" (usually written in kana). Kana-only
+	// entries are indexed as usual. This saves memory at the cost of recall: a kanji word
+	// written in kana in the text (ねこ for 猫) no longer matches unless it is a "uk" word,
+	// so CanonicalizeKana also finds fewer headwords.
+	LeanIndex bool
+}
+
+// NewImporterWithOptions is NewImporterCtx with index options.
+func NewImporterWithOptions(ctx context.Context, conn *sql.DB, entries []JMdictEntry, opts ImporterOptions) (*Importer, error) {
 	idx := make(map[string][]JMdictEntry)
-	for _, e := range entries {
+	for i, e := range entries {
+		if i%indexCancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
 		// Index by Kanji
 		for _, k := range e.Kanji {
 			idx[k.Text] = append(idx[k.Text], e)
 		}
 		// Index by Kana
+		if opts.LeanIndex && len(e.Kanji) > 0 && !usuallyKana(e) {
+			continue
+		}
 		for _, k := range e.Kana {
 			idx[k.Text] = append(idx[k.Text], e)
 		}
@@ -38,19 +92,87 @@ func NewImporter(conn *sql.DB, entries []JMdictEntry) *Importer {
 	return &Importer{
 		conn:  conn,
 		index: idx,
+	}, nil
+}
+
+// usuallyKana reports whether any sense of e is tagged "uk" (usually written using kana alone).
+func usuallyKana(e JMdictEntry) bool {
+	for _, s := range e.Sense {
+		for _, m := range s.Misc {
+			if m == "uk" {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// importCheckpoint prefixes the db checkpoints holding the last word id ProcessUpdatesCtx
+// finished; see checkpointName.
+const importCheckpoint = "dictionary_import"
+
+// checkpointName is the checkpoint used by runs with im's dictionary and options. Runs that
+// differ in any of them may define different words, so they must not share a position.
+func (im *Importer) checkpointName() string {
+	return fmt.Sprintf("%s|%s|gloss=%s|min=%d", importCheckpoint, im.CheckpointScope, im.GlossLang, im.MinOccurrencesForDefinition)
 }
 
+// updateBatchSize is how many words ProcessUpdatesCtx handles per transaction and checkpoint.
+// It is a variable so tests can force several batches.
+var updateBatchSize = 500
+
 // ProcessUpdates finds definitions for words in the DB and updates them.
 func (im *Importer) ProcessUpdates() (int, error) {
-	// 1. Fetch all words
-	rows, err := im.conn.Query(`SELECT id, word, lemma, pronunciation, definitions FROM words`)
+	return im.ProcessUpdatesCtx(context.Background())
+}
+
+// ProcessUpdatesCtx is ProcessUpdates in batches ordered by word id, checkpointing the last
+// finished id in the database after each batch (per dictionary and options; see
+// CheckpointScope). If ctx is canceled it returns the number of
+// words updated so far with ctx's error, and the next call resumes after the checkpoint
+// instead of revisiting finished words. A run that completes clears the checkpoint.
+func (im *Importer) ProcessUpdatesCtx(ctx context.Context) (int, error) {
+	lastID, err := db.GetCheckpoint(im.conn, im.checkpointName())
 	if err != nil {
 		return 0, err
 	}
-	defer rows.Close()
 
 	updatedCount := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return updatedCount, err
+		}
+		n, nextID, err := im.processUpdateBatch(lastID)
+		updatedCount += n
+		if err != nil {
+			return updatedCount, err
+		}
+		if nextID == lastID {
+			// No words left.
+			return updatedCount, db.ClearCheckpoint(im.conn, im.checkpointName())
+		}
+		lastID = nextID
+	}
+}
+
+// processUpdateBatch updates definitions for up to updateBatchSize words with id > afterID
+// and saves the checkpoint in the same transaction. It returns the number of updated words
+// and the highest id examined (afterID if there were none).
+func (im *Importer) processUpdateBatch(afterID int64) (int, int64, error) {
+	// 1. Fetch the next batch of words (or only the frequent ones)
+	query := `SELECT id, word, lemma, pronunciation, definitions FROM words WHERE id > ?`
+	args := []interface{}{afterID}
+	if im.MinOccurrencesForDefinition > 0 {
+		query += ` AND (SELECT COALESCE(SUM(occurrence_count), 0) FROM word_sources WHERE word_id = words.id) >= ?`
+		args = append(args, im.MinOccurrencesForDefinition)
+	}
+	query += ` ORDER BY id LIMIT ?`
+	args = append(args, updateBatchSize)
+	rows, err := im.conn.Query(query, args...)
+	if err != nil {
+		return 0, afterID, err
+	}
+	defer rows.Close()
 
 	// We'll collect updates and apply them to avoid locking issues if possible,
 	// though SQLite handles single logic connection fine.
@@ -59,6 +181,7 @@ func (im *Importer) ProcessUpdates() (int, error) {
 		def string
 	}
 	var updates []update
+	lastID := afterID
 
 	for rows.Next() {
 		var id int64
@@ -66,8 +189,9 @@ func (im *Importer) ProcessUpdates() (int, error) {
 		var lemma, pronunciation, definitions sql.NullString
 
 		if err := rows.Scan(&id, &word, &lemma, &pronunciation, &definitions); err != nil {
-			return updatedCount, err
+			return 0, afterID, err
 		}
+		lastID = id
 
 		// Skip if already has definitions (optional: force update flag?)
 		if definitions.Valid && definitions.String != "" {
@@ -81,7 +205,7 @@ func (im *Importer) ProcessUpdates() (int, error) {
 		}
 
 		// Convert to stored JSON format
-		defJSON, err := FormatDefinitions(matchedEntries)
+		defJSON, err := im.Format(matchedEntries)
 		if err != nil {
 			log.Printf("Error formatting definition for word %s: %v", word, err)
 			continue
@@ -89,19 +213,192 @@ func (im *Importer) ProcessUpdates() (int, error) {
 
 		updates = append(updates, update{id, defJSON})
 	}
+	if err := rows.Err(); err != nil {
+		return 0, afterID, err
+	}
+	rows.Close()
+	if lastID == afterID {
+		return 0, afterID, nil
+	}
 
-	// Apply updates
+	// Apply updates together with the checkpoint so a crash never skips unsaved words.
+	tx, err := im.conn.Begin()
+	if err != nil {
+		return 0, afterID, err
+	}
+	defer tx.Rollback()
+	updatedCount := 0
 	for _, u := range updates {
-		if err := db.UpdateWordDefinitions(im.conn, u.id, u.def); err != nil {
+		if err := db.UpdateWordDefinitions(tx, u.id, u.def); err != nil {
 			log.Printf("Failed to update word %d: %v", u.id, err)
 		} else {
 			updatedCount++
 		}
 	}
+	if err := db.SetCheckpoint(tx, im.checkpointName(), lastID); err != nil {
+		return 0, afterID, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, afterID, err
+	}
+	return updatedCount, lastID, nil
+}
+
+// ProcessUpdatesStream is ProcessUpdates reading the dictionary at path in a single pass
+// with StreamJMdictSimplified instead of looking words up in im's index, which may be
+// empty (NewImporter(conn, nil)). It loads the words still missing definitions (honoring
+// MinOccurrencesForDefinition), collects each one's matching entries as the file streams
+// past, and writes the definitions in one transaction at the end, so memory grows with
+// the words to fill rather than the dictionary. Results match ProcessUpdates with a full
+// (not lean) index. GlossLang and Formatter apply as usual. If ctx is canceled nothing
+// is written.
+func (im *Importer) ProcessUpdatesStream(ctx context.Context, path string) (int, error) {
+	query := `SELECT id, word, lemma, pronunciation FROM words WHERE (definitions IS NULL OR definitions = '')`
+	var args []interface{}
+	if im.MinOccurrencesForDefinition > 0 {
+		query += ` AND (SELECT COALESCE(SUM(occurrence_count), 0) FROM word_sources WHERE word_id = words.id) >= ?`
+		args = append(args, im.MinOccurrencesForDefinition)
+	}
+	query += ` ORDER BY id`
+	rows, err := im.conn.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	type pendingWord struct {
+		id                         int64
+		word, lemma, pronunciation string
+		matches                    map[string]JMdictEntry // by entry id, as in findMatches
+	}
+	var pending []*pendingWord
+	byText := make(map[string][]*pendingWord)
+	for rows.Next() {
+		var w pendingWord
+		var lemma, pronunciation sql.NullString
+		if err := rows.Scan(&w.id, &w.word, &lemma, &pronunciation); err != nil {
+			return 0, err
+		}
+		w.lemma, w.pronunciation = lemma.String, pronunciation.String
+		pending = append(pending, &w)
+		byText[w.word] = append(byText[w.word], &w)
+		if w.lemma != "" && w.lemma != w.word {
+			byText[w.lemma] = append(byText[w.lemma], &w)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	rows.Close()
+	if len(pending) == 0 {
+		return 0, nil
+	}
 
+	seen := 0
+	err = StreamJMdictSimplified(path, func(e JMdictEntry) error {
+		if seen%indexCancelCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		seen++
+		for _, forms := range [][]JMdictElement{e.Kanji, e.Kana} {
+			for _, f := range forms {
+				for _, w := range byText[f.Text] {
+					if !isMatch(e, w.word, w.lemma, w.pronunciation) {
+						continue
+					}
+					if w.matches == nil {
+						w.matches = make(map[string]JMdictEntry)
+					}
+					w.matches[e.Id] = e
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := im.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	updatedCount := 0
+	for _, w := range pending {
+		if len(w.matches) == 0 {
+			continue
+		}
+		matched := make([]JMdictEntry, 0, len(w.matches))
+		for _, e := range w.matches {
+			if im.GlossLang != "" {
+				e = filterGlosses(e, im.GlossLang)
+			}
+			matched = append(matched, e)
+		}
+		sort.Slice(matched, func(i, j int) bool { return matched[i].Id < matched[j].Id })
+		def, err := im.Format(matched)
+		if err != nil {
+			log.Printf("Error formatting definition for word %s: %v", w.word, err)
+			continue
+		}
+		if err := db.UpdateWordDefinitions(tx, w.id, def); err != nil {
+			log.Printf("Failed to update word %d: %v", w.id, err)
+			continue
+		}
+		updatedCount++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
 	return updatedCount, nil
 }
 
+// DefinitionChange describes a stored word whose definitions differ between two
+// dictionary versions. Old and New are in the stored JSON format; either may be empty
+// when only one version has the word.
+type DefinitionChange struct {
+	WordID int64
+	Word   string
+	Old    string
+	New    string
+}
+
+// DiffDefinitions reports the words in the database whose formatted definitions from im
+// (the new dictionary) differ from those from old, ordered by word id. It writes nothing,
+// so it can be used to review a dictionary upgrade before running ProcessUpdates.
+func (im *Importer) DiffDefinitions(old *Importer) ([]DefinitionChange, error) {
+	rows, err := im.conn.Query(`SELECT id, word, lemma, pronunciation FROM words ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []DefinitionChange
+	for rows.Next() {
+		var id int64
+		var word string
+		var lemma, pronunciation sql.NullString
+		if err := rows.Scan(&id, &word, &lemma, &pronunciation); err != nil {
+			return nil, err
+		}
+		before, err := old.GetDefinitionsJSON(word, lemma.String, pronunciation.String)
+		if err != nil {
+			return nil, err
+		}
+		after, err := im.GetDefinitionsJSON(word, lemma.String, pronunciation.String)
+		if err != nil {
+			return nil, err
+		}
+		if before != after {
+			changes = append(changes, DefinitionChange{WordID: id, Word: word, Old: before, New: after})
+		}
+	}
+	return changes, rows.Err()
+}
+
 // Lookup finds matching entries for a given word, lemma, and pronunciation.
 func (im *Importer) Lookup(word, lemma, pronunciation string) ([]JMdictEntry, error) {
 	matches := im.findMatches(word, lemma, pronunciation)
@@ -111,13 +408,87 @@ func (im *Importer) Lookup(word, lemma, pronunciation string) ([]JMdictEntry, er
 	return matches, nil
 }
 
-// GetDefinitionsJSON returns the JSON string of definitions for the given word details.
+// GetDefinitionsJSON returns the definitions string for the given word details, as
+// produced by the importer's Formatter (JSON by default).
 func (im *Importer) GetDefinitionsJSON(word, lemma, pronunciation string) (string, error) {
 	matches := im.findMatches(word, lemma, pronunciation)
 	if len(matches) == 0 {
 		return "", nil
 	}
-	return FormatDefinitions(matches)
+	return im.Format(matches)
+}
+
+// Format formats entries with the importer's Formatter, or JSONFormatter if none is set.
+func (im *Importer) Format(entries []JMdictEntry) (string, error) {
+	if im.Formatter != nil {
+		return im.Formatter.Format(entries)
+	}
+	return JSONFormatter{}.Format(entries)
+}
+
+// Reading returns the katakana reading of surface from the dictionary: the first common
+// kana form of the entries written as surface (lowest entry id first), or failing that
+// the first kana form. It is used to fill in readings the tokenizer lacks, so it does not
+// touch the database.
+func (im *Importer) Reading(surface string) (string, bool) {
+	entries := append([]JMdictEntry(nil), im.index[surface]...)
+	if len(entries) == 0 {
+		return "", false
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Id < entries[j].Id })
+	fallback := ""
+	for _, e := range entries {
+		for _, k := range e.Kana {
+			if k.Common {
+				return ToKatakana(k.Text), true
+			}
+			if fallback == "" {
+				fallback = k.Text
+			}
+		}
+	}
+	if fallback == "" {
+		return "", false
+	}
+	return ToKatakana(fallback), true
+}
+
+// WordQuery describes one word to resolve with LookupBatch.
+type WordQuery struct {
+	Word          string
+	Lemma         string
+	Pronunciation string
+}
+
+// LookupBatch resolves many words in one call. The result is keyed by WordQuery.Word;
+// words without matches are omitted.
+func (im *Importer) LookupBatch(words []WordQuery) map[string][]JMdictEntry {
+	out := make(map[string][]JMdictEntry, len(words))
+	for _, q := range words {
+		if matches := im.findMatches(q.Word, q.Lemma, q.Pronunciation); len(matches) > 0 {
+			out[q.Word] = matches
+		}
+	}
+	return out
+}
+
+// Coverage reports how many of words the loaded dictionary has an entry for, without
+// touching the database. Each element of words is counted, so repeated words weigh by
+// frequency; missing lists each uncovered word once, in first-seen order.
+func (im *Importer) Coverage(words []string) (hit, miss int, missing []string) {
+	seen := make(map[string]bool)
+	for _, w := range words {
+		if len(im.index[w]) > 0 {
+			hit++
+			continue
+		}
+		miss++
+		if !seen[w] {
+			seen[w] = true
+			missing = append(missing, w)
+		}
+	}
+	return hit, miss, missing
 }
 
 func (im *Importer) findMatches(word, lemma, pronunciation string) []JMdictEntry {
@@ -133,13 +504,8 @@ func (im *Importer) findMatches(word, lemma, pronunciation string) []JMdictEntry
 		if term == "" {
 			return
 		}
-		im.mu.RLock()
-		entries, ok := im.index[term]
-		im.mu.RUnlock()
-		if ok {
-			for _, e := range entries {
-				candidates[e.Id] = e
-			}
+		for _, e := range im.index[term] {
+			candidates[e.Id] = e
 		}
 	}
 
@@ -160,9 +526,38 @@ func (im *Importer) findMatches(word, lemma, pronunciation string) []JMdictEntry
 		return results[i].Id < results[j].Id
 	})
 
+	if im.GlossLang != "" {
+		for i := range results {
+			results[i] = filterGlosses(results[i], im.GlossLang)
+		}
+	}
 	return results
 }
 
+// filterGlosses returns a copy of e keeping only glosses in lang and dropping senses
+// left without any gloss. The indexed entry itself is not modified.
+func filterGlosses(e JMdictEntry, lang string) JMdictEntry {
+	senses := make([]JMdictSense, 0, len(e.Sense))
+	for _, s := range e.Sense {
+		var glosses []JMdictGloss
+		for _, g := range s.Gloss {
+			gl := g.Lang
+			if gl == "" {
+				gl = DefaultGlossLang
+			}
+			if gl == lang {
+				glosses = append(glosses, g)
+			}
+		}
+		if len(glosses) > 0 {
+			s.Gloss = glosses
+			senses = append(senses, s)
+		}
+	}
+	e.Sense = senses
+	return e
+}
+
 func isMatch(entry JMdictEntry, word, lemma, pronunciation string) bool {
 	// A match is good if the entry contains the Kanji (word/lemma) AND the Kana (pronunciation).
 	// If pronunciation is empty in DB, lax match on text.
@@ -189,14 +584,14 @@ func isMatch(entry JMdictEntry, word, lemma, pronunciation string) bool {
 		return true
 	}
 
-	normalizedPron := ToHiragana(pronunciation)
+	normalizedPron := NormalizeForMatch(pronunciation)
 
 	// Verify reading
 	// If entry has restricted reading (kanji entry has specific reading), it's complex.
 	// Simple check: does any generic kana match the pronunciation?
 	hasReading := false
 	for _, k := range entry.Kana {
-		if ToHiragana(k.Text) == normalizedPron {
+		if NormalizeForMatch(k.Text) == normalizedPron {
 			hasReading = true
 			break
 		}
@@ -205,6 +600,82 @@ func isMatch(entry JMdictEntry, word, lemma, pronunciation string) bool {
 	return hasReading
 }
 
+// IsKana reports whether s is non-empty and written entirely in hiragana or katakana
+// letters (including the prolonged sound mark ー). Punctuation such as ・ and iteration
+// marks such as ゝ, ゞ and ヽ are not kana letters.
+func IsKana(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		hiragana := r >= 0x3041 && r <= 0x3096 // ぁ-ゖ
+		katakana := r >= 0x30A1 && r <= 0x30FA // ァ-ヺ
+		if !hiragana && !katakana && r != 'ー' {
+			return false
+		}
+	}
+	return true
+}
+
+// KanjiHeadword returns the primary kanji headword for a kana-only word, along with the
+// entry it came from. It is deliberately conservative: ok is true only when exactly one
+// entry in matches lists word as a common reading, that entry has a common kanji form,
+// and none of its senses are tagged "uk" (usually written in kana).
+func KanjiHeadword(word string, matches []JMdictEntry) (headword string, entry JMdictEntry, ok bool) {
+	if !IsKana(word) {
+		return "", JMdictEntry{}, false
+	}
+	hira := ToHiragana(word)
+	var common []JMdictEntry
+	for _, e := range matches {
+		for _, k := range e.Kana {
+			if k.Common && ToHiragana(k.Text) == hira {
+				common = append(common, e)
+				break
+			}
+		}
+	}
+	if len(common) != 1 {
+		return "", JMdictEntry{}, false
+	}
+	entry = common[0]
+	for _, s := range entry.Sense {
+		for _, m := range s.Misc {
+			if m == "uk" {
+				return "", JMdictEntry{}, false
+			}
+		}
+	}
+	for _, k := range entry.Kanji {
+		if k.Common {
+			return k.Text, entry, true
+		}
+	}
+	return "", JMdictEntry{}, false
+}
+
+// NormalizeForMatch folds a reading into a form for fuzzy comparison only; it must not be
+// stored or displayed. It NFKC-folds half-width katakana (so ﾝ and ｯ become ン and ッ),
+// drops the geminating っ and spells the rest in lower-case Hepburn romaji (ToRomaji), so
+// readings that differ only in script, gemination or how the moraic nasal is written
+// compare equal: ん before a vowel or y becomes "n'", which keeps きんえん ("kin'en")
+// apart from きねん ("kinen") and lets a romaji reading such as "kin'en" match its kana.
+func NormalizeForMatch(reading string) string {
+	hira := strings.ReplaceAll(ToHiragana(norm.NFKC.String(reading)), "っ", "")
+	return strings.ToLower(ToRomaji(hira))
+}
+
+// ToKatakana converts Hiragana to Katakana.
+func ToKatakana(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if r >= 0x3041 && r <= 0x3096 {
+			runes[i] = r + 0x60
+		}
+	}
+	return string(runes)
+}
+
 // ToHiragana converts Katakana to Hiragana.
 func ToHiragana(s string) string {
 	runes := []rune(s)
@@ -216,6 +687,49 @@ func ToHiragana(s string) string {
 	return string(runes)
 }
 
+// DefinitionFormatter turns the dictionary entries matched for a word into the string
+// stored in words.definitions.
+type DefinitionFormatter interface {
+	Format(entries []JMdictEntry) (string, error)
+}
+
+// JSONFormatter is the default DefinitionFormatter: it stores FormatDefinitions' JSON.
+type JSONFormatter struct{}
+
+// Format implements DefinitionFormatter.
+func (JSONFormatter) Format(entries []JMdictEntry) (string, error) {
+	return FormatDefinitions(entries)
+}
+
+// PlainTextFormatter is a DefinitionFormatter for people reading the database directly:
+// one numbered line per sense, its glosses joined with "; " and its parts of speech in
+// parentheses, e.g. "1. dog; hound (n)\n2. spy (n)". Senses of all matched entries are
+// numbered in one sequence; senses without glosses are left out. FlattenDefinitions joins
+// the lines back into one.
+type PlainTextFormatter struct{}
+
+// Format implements DefinitionFormatter.
+func (PlainTextFormatter) Format(entries []JMdictEntry) (string, error) {
+	var lines []string
+	for _, e := range entries {
+		for _, s := range e.Sense {
+			var glosses []string
+			for _, g := range s.Gloss {
+				glosses = append(glosses, g.Text)
+			}
+			if len(glosses) == 0 {
+				continue
+			}
+			line := fmt.Sprintf("%d. %s", len(lines)+1, strings.Join(glosses, "; "))
+			if len(s.PartOfSpeech) > 0 {
+				line += " (" + strings.Join(s.PartOfSpeech, ", ") + ")"
+			}
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
 // FormatDefinitions formats the entries into a JSON string.
 func FormatDefinitions(entries []JMdictEntry) (string, error) {
 	// Combine senses from multiple matching entries if necessary, or just take the first/best.
@@ -225,6 +739,8 @@ func FormatDefinitions(entries []JMdictEntry) (string, error) {
 	for _, e := range entries {
 		var senses []string
 		var poses []string
+		var misc []string
+		var fields []string
 
 		for _, s := range e.Sense {
 			// Extract glosses
@@ -235,13 +751,71 @@ func FormatDefinitions(entries []JMdictEntry) (string, error) {
 			for _, p := range s.PartOfSpeech {
 				poses = append(poses, p)
 			}
+			misc = append(misc, s.Misc...)
+			fields = append(fields, s.Field...)
 		}
 		defs = append(defs, DefinitionEntry{
 			Senses: senses,
 			POS:    poses,
+			Misc:   misc,
+			Field:  fields,
 		})
 	}
 
 	bytes, err := json.Marshal(defs)
 	return string(bytes), err
 }
+
+// FlattenOptions controls how FlattenDefinitionsWith joins definitions into one string.
+// A nil separator selects its default; point at "" to join without one.
+type FlattenOptions struct {
+	// EntrySeparator goes between definition entries (one per matched dictionary entry;
+	// stored definitions keep no sense boundaries within an entry) and between the lines
+	// of plain-text definitions. nil means "; ".
+	EntrySeparator *string
+	// GlossSeparator goes between the glosses of one entry. nil means ", ".
+	GlossSeparator *string
+}
+
+// FlattenDefinitions turns the stored definitions JSON into a single readable line:
+// glosses within an entry are joined with "; " and entries with " / ".
+// Values that are not definitions JSON (such as PlainTextFormatter output) are returned
+// trimmed, with their lines joined by " / ".
+func FlattenDefinitions(definitions string) string {
+	entrySep, glossSep := " / ", "; "
+	return FlattenDefinitionsWith(definitions, FlattenOptions{EntrySeparator: &entrySep, GlossSeparator: &glossSep})
+}
+
+// FlattenDefinitionsWith is FlattenDefinitions with configurable separators, e.g. for
+// simple flashcards that want "dog, hound; spy".
+func FlattenDefinitionsWith(definitions string, opts FlattenOptions) string {
+	entrySep, glossSep := "; ", ", "
+	if opts.EntrySeparator != nil {
+		entrySep = *opts.EntrySeparator
+	}
+	if opts.GlossSeparator != nil {
+		glossSep = *opts.GlossSeparator
+	}
+	trimmed := strings.TrimSpace(definitions)
+	if trimmed == "" {
+		return ""
+	}
+	var defs []DefinitionEntry
+	if err := json.Unmarshal([]byte(trimmed), &defs); err != nil {
+		// Plain text, e.g. from PlainTextFormatter: one line per sense.
+		var lines []string
+		for _, line := range strings.Split(trimmed, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return strings.Join(lines, entrySep)
+	}
+	var parts []string
+	for _, d := range defs {
+		if len(d.Senses) > 0 {
+			parts = append(parts, strings.Join(d.Senses, glossSep))
+		}
+	}
+	return strings.Join(parts, entrySep)
+}
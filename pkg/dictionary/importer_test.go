@@ -1,12 +1,21 @@
 package dictionary
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/readerer"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -128,6 +137,24 @@ func TestImporter(t *testing.T) {
 	t.Logf("Definitions for テスト: %s", definitions)
 }
 
+func TestToKatakana(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"あ", "ア"},
+		{"がっこう", "ガッコウ"},
+		{"ゔ", "ヴ"},
+		{"ー", "ー"},
+		{"カタカナ", "カタカナ"},
+		{"abc", "abc"},
+	}
+	for _, tt := range tests {
+		if got := ToKatakana(tt.in); got != tt.out {
+			t.Errorf("ToKatakana(%q) = %q; want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
 func TestToHiragana(t *testing.T) {
 	tests := []struct {
 		in, out string
@@ -148,3 +175,692 @@ func TestToHiragana(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatDefinitionsMiscAndField(t *testing.T) {
+	dictContent := `{"words":[{"id":"1","kanji":[{"text":"鯖","common":false}],"kana":[{"text":"さば","common":false}],
+		"sense":[{"gloss":[{"text":"mackerel"}],"partOfSpeech":["n"],"field":["food"]},
+		         {"gloss":[{"text":"server"}],"partOfSpeech":["n"],"misc":["col","abbr"],"field":["comp"]}]}]}`
+	tmpFile, err := ioutil.TempFile("", "jmdict-misc-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(dictContent); err != nil {
+		t.Fatal(err)
+	}
+	tmpFile.Close()
+
+	entries, err := LoadJMdictSimplified(tmpFile.Name())
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := entries[0].Sense[1].Misc; len(got) != 2 || got[0] != "col" {
+		t.Fatalf("expected misc tags to be parsed, got %v", got)
+	}
+
+	out, err := FormatDefinitions(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var defs []DefinitionEntry
+	if err := json.Unmarshal([]byte(out), &defs); err != nil {
+		t.Fatalf("unmarshal %s: %v", out, err)
+	}
+	if len(defs) != 1 {
+		t.Fatalf("expected 1 definition entry, got %d", len(defs))
+	}
+	if want := []string{"col", "abbr"}; strings.Join(defs[0].Misc, ",") != strings.Join(want, ",") {
+		t.Errorf("misc = %v, want %v", defs[0].Misc, want)
+	}
+	if want := []string{"food", "comp"}; strings.Join(defs[0].Field, ",") != strings.Join(want, ",") {
+		t.Errorf("field = %v, want %v", defs[0].Field, want)
+	}
+
+	// Entries without tags keep the previous JSON shape.
+	plain, err := FormatDefinitions([]JMdictEntry{{Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "dog"}}, PartOfSpeech: []string{"n"}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain, "misc") || strings.Contains(plain, "field") {
+		t.Errorf("expected misc/field to be omitted when empty, got %s", plain)
+	}
+}
+
+func TestNewImporterCtxCanceled(t *testing.T) {
+	entries := make([]JMdictEntry, 200000)
+	for i := range entries {
+		text := fmt.Sprintf("語%d", i)
+		entries[i] = JMdictEntry{Kanji: []JMdictElement{{Text: text}}, Kana: []JMdictElement{{Text: text}}}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	im, err := NewImporterCtx(ctx, nil, entries)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if im != nil {
+		t.Fatal("expected no importer on cancellation")
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("expected prompt return, took %v", elapsed)
+	}
+
+	im, err = NewImporterCtx(context.Background(), nil, entries[:10])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if matches, _ := im.Lookup("語3", "語3", ""); len(matches) != 1 {
+		t.Fatalf("expected lookup to find entry, got %v", matches)
+	}
+}
+
+func TestFlattenDefinitions(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`[{"senses":["dog","hound"],"pos":["n"]},{"senses":["spy"],"pos":["n"]}]`, "dog; hound / spy"},
+		{`[]`, ""},
+		{"", ""},
+		{"  plain text meaning ", "plain text meaning"},
+		{"1. dog; hound (n)\n2. spy (n)\n", "1. dog; hound (n) / 2. spy (n)"},
+	}
+	for _, tt := range tests {
+		if got := FlattenDefinitions(tt.in); got != tt.want {
+			t.Errorf("FlattenDefinitions(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFlattenDefinitionsWith(t *testing.T) {
+	defs := `[{"senses":["dog","hound"],"pos":["n"]},{"senses":["spy"],"pos":["n"]}]`
+	if got := FlattenDefinitionsWith(defs, FlattenOptions{}); got != "dog, hound; spy" {
+		t.Errorf("defaults: got %q", got)
+	}
+	bar, slash, none := " | ", "/", ""
+	if got := FlattenDefinitionsWith(defs, FlattenOptions{EntrySeparator: &bar, GlossSeparator: &slash}); got != "dog/hound | spy" {
+		t.Errorf("custom separators: got %q", got)
+	}
+	if got := FlattenDefinitionsWith(defs, FlattenOptions{EntrySeparator: &none, GlossSeparator: &none}); got != "doghoundspy" {
+		t.Errorf("empty separators: got %q", got)
+	}
+	if got := FlattenDefinitionsWith("1. dog\n2. spy", FlattenOptions{EntrySeparator: &bar}); got != "1. dog | 2. spy" {
+		t.Errorf("plain text: got %q", got)
+	}
+}
+
+func TestIsKana(t *testing.T) {
+	tests := map[string]bool{
+		"ねこ":      true,
+		"ネコ":      true,
+		"ラーメン":    true,
+		"ヴァ":      true,
+		"":        false,
+		"猫":       false,
+		"ねこ猫":     false,
+		"・":       false, // katakana middle dot
+		"テレビ・ゲーム": false,
+		"ゝ":       false, // hiragana iteration marks
+		"すゞ":      false,
+		"ヽ":       false,
+		"゛":       false,
+	}
+	for in, want := range tests {
+		if got := IsKana(in); got != want {
+			t.Errorf("IsKana(%q) = %v; want %v", in, got, want)
+		}
+	}
+}
+
+func TestKanjiHeadword(t *testing.T) {
+	cat := JMdictEntry{Id: "1", Kanji: []JMdictElement{{Text: "猫", Common: true}}, Kana: []JMdictElement{{Text: "ねこ", Common: true}}}
+	rareCat := JMdictEntry{Id: "2", Kanji: []JMdictElement{{Text: "寝子", Common: false}}, Kana: []JMdictElement{{Text: "ねこ", Common: false}}}
+	commonHomophone := JMdictEntry{Id: "3", Kanji: []JMdictElement{{Text: "根子", Common: true}}, Kana: []JMdictElement{{Text: "ねこ", Common: true}}}
+
+	if hw, _, ok := KanjiHeadword("ねこ", []JMdictEntry{cat, rareCat}); !ok || hw != "猫" {
+		t.Errorf("expected 猫, got %q ok=%v", hw, ok)
+	}
+	if hw, _, ok := KanjiHeadword("ネコ", []JMdictEntry{cat}); !ok || hw != "猫" {
+		t.Errorf("expected katakana surface to canonicalize to 猫, got %q ok=%v", hw, ok)
+	}
+	if _, _, ok := KanjiHeadword("ねこ", []JMdictEntry{cat, commonHomophone}); ok {
+		t.Error("expected ambiguous common matches to be left alone")
+	}
+	if _, _, ok := KanjiHeadword("猫", []JMdictEntry{cat}); ok {
+		t.Error("expected non-kana word to be left alone")
+	}
+}
+
+func TestLookupBatch(t *testing.T) {
+	entries := []JMdictEntry{
+		{Id: "1", Kanji: []JMdictElement{{Text: "犬", Common: true}}, Kana: []JMdictElement{{Text: "いぬ", Common: true}}},
+		{Id: "2", Kanji: []JMdictElement{{Text: "猫", Common: true}}, Kana: []JMdictElement{{Text: "ねこ", Common: true}}},
+		{Id: "3", Kana: []JMdictElement{{Text: "テスト", Common: true}}},
+	}
+	im := NewImporter(nil, entries)
+
+	got := im.LookupBatch([]WordQuery{
+		{Word: "犬", Lemma: "犬", Pronunciation: "イヌ"},
+		{Word: "猫", Lemma: "猫"},
+		{Word: "テスト", Lemma: "テスト"},
+		{Word: "未知", Lemma: "未知"},
+		{Word: "鳥", Lemma: "鳥", Pronunciation: "とり"},
+	})
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 resolved words, got %d: %v", len(got), got)
+	}
+	for word, id := range map[string]string{"犬": "1", "猫": "2", "テスト": "3"} {
+		if m := got[word]; len(m) != 1 || m[0].Id != id {
+			t.Errorf("%s: expected entry %s, got %+v", word, id, m)
+		}
+	}
+	if _, ok := got["未知"]; ok {
+		t.Error("expected unmatched word to be omitted")
+	}
+}
+
+func TestNormalizeForMatch(t *testing.T) {
+	pairs := []struct{ a, b string }{
+		{"ガッコウ", "がこう"},    // gemination dropped
+		{"ｼﾝﾌﾞﾝ", "しんぶん"},  // half-width moraic nasal
+		{"ｷｯﾌﾟ", "きっぷ"},    // half-width small tsu
+		{"コーヒー", "こーひー"},   // long vowel mark kept on both sides
+		{"キンエン", "kin'en"}, // moraic nasal before a vowel
+		{"コンヤ", "KON'YA"},  // moraic nasal before y
+		{"ｼﾝﾌﾞﾝ", "shinbun"},
+	}
+	for _, p := range pairs {
+		if NormalizeForMatch(p.a) != NormalizeForMatch(p.b) {
+			t.Errorf("expected %q and %q to match: %q vs %q", p.a, p.b, NormalizeForMatch(p.a), NormalizeForMatch(p.b))
+		}
+	}
+	for _, p := range []struct{ a, b string }{
+		{"しんぶん", "しぶん"},
+		{"きんえん", "きねん"}, // ん+え is not ね
+		{"こんや", "こにゃ"},  // ん+や is not にゃ
+	} {
+		if NormalizeForMatch(p.a) == NormalizeForMatch(p.b) {
+			t.Errorf("expected ん to keep %q and %q apart, both gave %q", p.a, p.b, NormalizeForMatch(p.a))
+		}
+	}
+
+	// isMatch uses the fuzzy form while the stored reading is left alone.
+	im := NewImporter(nil, []JMdictEntry{{Id: "1", Kanji: []JMdictElement{{Text: "切符", Common: true}}, Kana: []JMdictElement{{Text: "きっぷ", Common: true}}}})
+	if m, _ := im.Lookup("切符", "切符", "ｷｯﾌﾟ"); len(m) != 1 {
+		t.Errorf("expected half-width reading to match, got %v", m)
+	}
+}
+
+func TestProcessUpdatesMinOccurrences(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	if err := db.InitDB(conn); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "T", "", "", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{"犬": 1, "猫": 3}
+	ids := map[string]int64{}
+	for w, c := range counts {
+		id, err := db.CreateOrGetWord(conn, w, w, "", "", "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[w] = id
+		if err := db.LinkWordToSource(conn, id, sourceID, w+"がいる。", "", c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	im := NewImporter(conn, []JMdictEntry{
+		{Id: "1", Kanji: []JMdictElement{{Text: "犬"}}, Kana: []JMdictElement{{Text: "いぬ"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "dog"}}}}},
+		{Id: "2", Kanji: []JMdictElement{{Text: "猫"}}, Kana: []JMdictElement{{Text: "ねこ"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "cat"}}}}},
+	})
+	im.MinOccurrencesForDefinition = 2
+
+	n, err := im.ProcessUpdates()
+	if err != nil {
+		t.Fatalf("ProcessUpdates: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 word updated, got %d", n)
+	}
+	for w, wantDefs := range map[string]bool{"犬": false, "猫": true} {
+		var defs sql.NullString
+		if err := conn.QueryRow(`SELECT definitions FROM words WHERE id = ?`, ids[w]).Scan(&defs); err != nil {
+			t.Fatal(err)
+		}
+		if got := defs.String != ""; got != wantDefs {
+			t.Errorf("%s: has definitions = %v, want %v", w, got, wantDefs)
+		}
+	}
+}
+
+func TestProcessUpdatesStreamMatchesInMemory(t *testing.T) {
+	const fixture = "testdata/jmdict_sample.json"
+	words := []struct{ word, lemma, reading, defs string }{
+		{"犬", "犬", "イヌ", ""},
+		{"日", "日", "", ""}, // matches both 日 entries
+		{"走っ", "走る", "", ""},
+		{"ねこ", "ねこ", "ネコ", ""},
+		{"テスト", "テスト", "テスト", ""},
+		{"未知", "未知", "ミチ", ""},
+		{"猫", "猫", "ネコ", "kept"},
+	}
+	// run fills a fresh database with fn and returns word -> stored definitions.
+	run := func(t *testing.T, fn func(conn *sql.DB) (int, error)) (int, map[string]string) {
+		t.Helper()
+		conn, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			t.Fatalf("open db: %v", err)
+		}
+		defer conn.Close()
+		if err := db.InitDB(conn); err != nil {
+			t.Fatalf("init db: %v", err)
+		}
+		for _, w := range words {
+			if _, err := db.CreateOrGetWord(conn, w.word, w.lemma, w.reading, w.defs, "ja"); err != nil {
+				t.Fatalf("create word %s: %v", w.word, err)
+			}
+		}
+		n, err := fn(conn)
+		if err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		got := map[string]string{}
+		rows, err := conn.Query(`SELECT word, COALESCE(definitions, '') FROM words`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var w, d string
+			if err := rows.Scan(&w, &d); err != nil {
+				t.Fatal(err)
+			}
+			got[w] = d
+		}
+		return n, got
+	}
+
+	entries, err := LoadJMdictSimplified(fixture)
+	if err != nil {
+		t.Fatalf("load dict: %v", err)
+	}
+	for _, lang := range []string{"", "ger"} {
+		t.Run("lang="+lang, func(t *testing.T) {
+			wantN, want := run(t, func(conn *sql.DB) (int, error) {
+				im := NewImporter(conn, entries)
+				im.GlossLang = lang
+				return im.ProcessUpdates()
+			})
+			gotN, got := run(t, func(conn *sql.DB) (int, error) {
+				im := NewImporter(conn, nil)
+				im.GlossLang = lang
+				return im.ProcessUpdatesStream(context.Background(), fixture)
+			})
+			if gotN != wantN {
+				t.Errorf("streaming updated %d words, in-memory %d", gotN, wantN)
+			}
+			for w, def := range want {
+				if got[w] != def {
+					t.Errorf("%s: streaming stored %q, in-memory %q", w, got[w], def)
+				}
+			}
+			if got["日"] == "" || got["未知"] != "" || got["猫"] != "kept" {
+				t.Errorf("unexpected definitions %v", got)
+			}
+		})
+	}
+
+	// A canceled context writes nothing.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := db.InitDB(conn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CreateOrGetWord(conn, "犬", "犬", "イヌ", "", "ja"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := NewImporter(conn, nil).ProcessUpdatesStream(ctx, fixture); !errors.Is(err, context.Canceled) || n != 0 {
+		t.Fatalf("expected context.Canceled and no updates, got %d, %v", n, err)
+	}
+}
+
+func TestImporterGlossLang(t *testing.T) {
+	im := NewImporter(nil, []JMdictEntry{{
+		Id:    "1",
+		Kanji: []JMdictElement{{Text: "犬"}},
+		Kana:  []JMdictElement{{Text: "いぬ"}},
+		Sense: []JMdictSense{
+			{Gloss: []JMdictGloss{{Text: "dog"}, {Text: "Hund", Lang: "ger"}}},
+			{Gloss: []JMdictGloss{{Text: "spy", Lang: "eng"}}},
+		},
+	}})
+
+	im.GlossLang = "ger"
+	matches, _ := im.Lookup("犬", "犬", "")
+	if len(matches) != 1 || len(matches[0].Sense) != 1 || len(matches[0].Sense[0].Gloss) != 1 || matches[0].Sense[0].Gloss[0].Text != "Hund" {
+		t.Fatalf("expected only the German gloss, got %+v", matches)
+	}
+
+	// Filtering must not modify the index: English still sees both senses.
+	im.GlossLang = "eng"
+	matches, _ = im.Lookup("犬", "犬", "")
+	if len(matches) != 1 || len(matches[0].Sense) != 2 || matches[0].Sense[0].Gloss[0].Text != "dog" {
+		t.Fatalf("expected English glosses, got %+v", matches)
+	}
+}
+
+func TestLoadJMdictSimplifiedEmpty(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"object.json": `{}`, "array.json": `[]`, "words.json": `{"words":[]}`} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadJMdictSimplified(path); !errors.Is(err, ErrDictionaryEmpty) {
+			t.Errorf("%s: expected ErrDictionaryEmpty, got %v", content, err)
+		}
+		if err := StreamJMdictSimplified(path, func(JMdictEntry) error { return nil }); !errors.Is(err, ErrDictionaryEmpty) {
+			t.Errorf("%s: expected ErrDictionaryEmpty from StreamJMdictSimplified, got %v", content, err)
+		}
+	}
+
+	path := filepath.Join(dir, "broken.json")
+	if err := os.WriteFile(path, []byte(`{"words":[`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadJMdictSimplified(path); err == nil || errors.Is(err, ErrDictionaryEmpty) {
+		t.Errorf("truncated file: expected a parse error, got %v", err)
+	}
+	if err := StreamJMdictSimplified(path, func(JMdictEntry) error { return nil }); err == nil || errors.Is(err, ErrDictionaryEmpty) {
+		t.Errorf("truncated file: expected a parse error from StreamJMdictSimplified, got %v", err)
+	}
+}
+
+func TestImporterCoverage(t *testing.T) {
+	im := NewImporter(nil, []JMdictEntry{
+		{Id: "1", Kanji: []JMdictElement{{Text: "犬"}}, Kana: []JMdictElement{{Text: "いぬ"}}},
+		{Id: "2", Kanji: []JMdictElement{{Text: "猫"}}, Kana: []JMdictElement{{Text: "ねこ"}}},
+	})
+	hit, miss, missing := im.Coverage([]string{"犬", "ねこ", "未知", "犬", "謎", "未知"})
+	if hit != 3 || miss != 3 {
+		t.Errorf("hit=%d miss=%d, want 3 and 3", hit, miss)
+	}
+	if strings.Join(missing, ",") != "未知,謎" {
+		t.Errorf("missing = %v, want [未知 謎]", missing)
+	}
+}
+
+// cancelAfterCtx reports cancellation once Err has been called more than n times.
+type cancelAfterCtx struct {
+	context.Context
+	n int
+}
+
+func (c *cancelAfterCtx) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestProcessUpdatesCtxResumesAfterCancel(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	if err := db.InitDB(conn); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+
+	orig := updateBatchSize
+	updateBatchSize = 2
+	defer func() { updateBatchSize = orig }()
+
+	var entries []JMdictEntry
+	var ids []int64
+	for i, w := range []string{"一", "二", "三", "四", "五"} {
+		id, err := db.CreateOrGetWord(conn, w, w, "", "", "ja")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		entries = append(entries, JMdictEntry{
+			Id:    fmt.Sprint(i),
+			Kanji: []JMdictElement{{Text: w}},
+			Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: fmt.Sprint("number ", i+1)}}}},
+		})
+	}
+	im := NewImporter(conn, entries)
+
+	// Allow exactly one batch before the context reports cancellation.
+	n, err := im.ProcessUpdatesCtx(&cancelAfterCtx{Context: context.Background(), n: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 words updated before cancel, got %d", n)
+	}
+
+	// Wipe a finished word; a resumed run must not revisit it.
+	if err := db.UpdateWordDefinitions(conn, ids[0], ""); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = im.ProcessUpdatesCtx(context.Background())
+	if err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if n != 3 {
+		t.Errorf("expected resumed run to update the remaining 3 words, got %d", n)
+	}
+	for i, id := range ids {
+		var defs string
+		if err := conn.QueryRow(`SELECT IFNULL(definitions, '') FROM words WHERE id = ?`, id).Scan(&defs); err != nil {
+			t.Fatal(err)
+		}
+		if want := i != 0; (defs != "") != want {
+			t.Errorf("word %d: has definitions = %v, want %v", i, defs != "", want)
+		}
+	}
+	if pos, err := db.GetCheckpoint(conn, im.checkpointName()); err != nil || pos != 0 {
+		t.Errorf("expected checkpoint cleared after completion, got %d (err=%v)", pos, err)
+	}
+
+	// A run with other options does not resume from an interrupted run's checkpoint.
+	wipe := func() {
+		for _, id := range ids {
+			if err := db.UpdateWordDefinitions(conn, id, ""); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wipe()
+	if _, err := im.ProcessUpdatesCtx(&cancelAfterCtx{Context: context.Background(), n: 1}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	wipe()
+	other := NewImporter(conn, entries)
+	other.CheckpointScope = "fill-definitions:other.json"
+	if n, err := other.ProcessUpdatesCtx(context.Background()); err != nil || n != 5 {
+		t.Errorf("expected a differently scoped run to update all 5 words, got %d (%v)", n, err)
+	}
+}
+
+func TestDiffDefinitions(t *testing.T) {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	if err := db.InitDB(conn); err != nil {
+		t.Fatalf("init db: %v", err)
+	}
+	for _, w := range []string{"犬", "猫", "鳥"} {
+		if _, err := db.CreateOrGetWord(conn, w, w, "", "", "ja"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry := func(id, kanji string, glosses ...string) JMdictEntry {
+		var gs []JMdictGloss
+		for _, g := range glosses {
+			gs = append(gs, JMdictGloss{Text: g})
+		}
+		return JMdictEntry{Id: id, Kanji: []JMdictElement{{Text: kanji}}, Sense: []JMdictSense{{Gloss: gs}}}
+	}
+	oldDict := NewImporter(conn, []JMdictEntry{entry("1", "犬", "dog"), entry("2", "猫", "cat")})
+	newDict := NewImporter(conn, []JMdictEntry{entry("1", "犬", "dog", "hound"), entry("2", "猫", "cat"), entry("3", "鳥", "bird")})
+
+	changes, err := newDict.DiffDefinitions(oldDict)
+	if err != nil {
+		t.Fatalf("DiffDefinitions: %v", err)
+	}
+	if len(changes) != 2 || changes[0].Word != "犬" || changes[1].Word != "鳥" {
+		t.Fatalf("expected changes for 犬 and 鳥, got %+v", changes)
+	}
+	if FlattenDefinitions(changes[0].Old) != "dog" || FlattenDefinitions(changes[0].New) != "dog; hound" {
+		t.Errorf("unexpected 犬 change: %+v", changes[0])
+	}
+	if changes[1].Old != "" {
+		t.Errorf("expected 鳥 to be new, got old %q", changes[1].Old)
+	}
+
+	// Nothing was written.
+	var defs sql.NullString
+	if err := conn.QueryRow(`SELECT definitions FROM words WHERE word = '犬'`).Scan(&defs); err != nil {
+		t.Fatal(err)
+	}
+	if defs.String != "" {
+		t.Errorf("DiffDefinitions must not write, found %q", defs.String)
+	}
+}
+
+func TestImporterLeanIndex(t *testing.T) {
+	entries := []JMdictEntry{
+		{Id: "1", Kanji: []JMdictElement{{Text: "犬"}}, Kana: []JMdictElement{{Text: "いぬ"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "dog"}}}}},
+		{Id: "2", Kanji: []JMdictElement{{Text: "走る"}}, Kana: []JMdictElement{{Text: "はしる"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "to run"}}}}},
+		{Id: "3", Kanji: []JMdictElement{{Text: "猫"}}, Kana: []JMdictElement{{Text: "ねこ"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "cat"}}}}},
+		{Id: "4", Kana: []JMdictElement{{Text: "テスト"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "test"}}}}},
+		{Id: "5", Kanji: []JMdictElement{{Text: "有難う"}}, Kana: []JMdictElement{{Text: "ありがとう"}}, Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "thank you"}}, Misc: []string{"uk"}}}},
+	}
+	full, err := NewImporterWithOptions(context.Background(), nil, entries, ImporterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lean, err := NewImporterWithOptions(context.Background(), nil, entries, ImporterOptions{LeanIndex: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lean.index) >= len(full.index) {
+		t.Fatalf("expected the lean index to have fewer keys: lean %d, full %d", len(lean.index), len(full.index))
+	}
+
+	// Headwords as they appear in text still resolve, with readings verified as before.
+	for _, q := range []struct{ word, reading, want string }{
+		{"犬", "イヌ", "1"},
+		{"走る", "ハシル", "2"},
+		{"猫", "ネコ", "3"},
+		{"テスト", "テスト", "4"},
+		{"ありがとう", "", "5"}, // usually written in kana
+	} {
+		matches, _ := lean.Lookup(q.word, q.word, q.reading)
+		if len(matches) != 1 || matches[0].Id != q.want {
+			t.Errorf("lean Lookup(%s) = %+v, want entry %s", q.word, matches, q.want)
+		}
+	}
+	// The trade-off: kanji words written in kana are no longer found.
+	if matches, _ := lean.Lookup("ねこ", "ねこ", ""); len(matches) != 0 {
+		t.Errorf("expected ねこ to miss in the lean index, got %+v", matches)
+	}
+	if matches, _ := full.Lookup("ねこ", "ねこ", ""); len(matches) != 1 {
+		t.Errorf("expected ねこ to match in the full index, got %+v", matches)
+	}
+}
+
+// benchEntries builds n dictionary entries with distinct kanji and kana forms.
+func benchEntries(n int) []JMdictEntry {
+	entries := make([]JMdictEntry, n)
+	for i := range entries {
+		entries[i] = JMdictEntry{
+			Id:    strconv.Itoa(i),
+			Kanji: []JMdictElement{{Text: fmt.Sprintf("漢%d", i)}},
+			Kana:  []JMdictElement{{Text: fmt.Sprintf("かな%d", i)}},
+			Sense: []JMdictSense{{Gloss: []JMdictGloss{{Text: "gloss"}}}},
+		}
+	}
+	return entries
+}
+
+// BenchmarkLookupParallel measures Lookup when many goroutines (as with many ingest
+// workers) look words up at once.
+func BenchmarkLookupParallel(b *testing.B) {
+	entries := benchEntries(10000)
+	words := make([]string, len(entries))
+	for i, e := range entries {
+		words[i] = e.Kanji[0].Text
+	}
+	im := NewImporter(nil, entries)
+	b.SetParallelism(8)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			w := words[i%len(words)]
+			if matches, _ := im.Lookup(w, w, ""); len(matches) != 1 {
+				b.Fatalf("no match for %s", w)
+			}
+			i++
+		}
+	})
+}
+
+func TestAnalyzerReadingsFromImporter(t *testing.T) {
+	im := NewImporter(nil, []JMdictEntry{
+		{Id: "1", Kanji: []JMdictElement{{Text: "杳"}}, Kana: []JMdictElement{{Text: "よう", Common: true}}},
+	})
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kagome does not know 杳 and gives it no reading.
+	tokens, err := analyzer.Analyze("杳として")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) == 0 || tokens[0].Surface != "杳" || tokens[0].Reading != "" {
+		t.Fatalf("expected 杳 without a reading from Kagome, got %+v", tokens)
+	}
+
+	analyzer.Readings = im
+	if tokens, err = analyzer.Analyze("杳として"); err != nil {
+		t.Fatal(err)
+	}
+	if tokens[0].Reading != "ヨウ" || tokens[0].Pronunciation != "ヨウ" {
+		t.Errorf("expected the dictionary reading ヨウ, got %q/%q", tokens[0].Reading, tokens[0].Pronunciation)
+	}
+	if tokens[1].Reading != "トシテ" {
+		t.Errorf("expected Kagome's reading to be kept for として, got %q", tokens[1].Reading)
+	}
+}
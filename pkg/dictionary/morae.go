@@ -0,0 +1,62 @@
+package dictionary
+
+import "strings"
+
+// isSmallKana reports whether r is a small kana that combines with the kana before it
+// into one mora (the y of きゃ, or the vowel of ファ).
+func isSmallKana(r rune) bool {
+	return strings.ContainsRune("ゃゅょぁぃぅぇぉゎャュョァィゥェォヮ", r)
+}
+
+// SplitMorae splits a kana reading into morae, the timing units of Japanese: a small
+// ゃ/ゅ/ょ (or ぁ, ぃ, ...) joins the kana before it, while っ, ん and ー each count as a
+// mora of their own. きゃく gives [きゃ く] and とうきょう gives [と う きょ う]. The
+// script of the input is kept; characters other than kana are returned one per mora.
+func SplitMorae(reading string) []string {
+	var morae []string
+	for _, r := range reading {
+		if isSmallKana(r) && len(morae) > 0 {
+			morae[len(morae)-1] += string(r)
+			continue
+		}
+		morae = append(morae, string(r))
+	}
+	return morae
+}
+
+// SplitSyllables groups the morae of a kana reading into syllables: っ, ん, ー and a
+// vowel lengthening the previous one (おう, えい, or the same vowel twice) join the
+// syllable before them. とうきょう gives [とう きょう] and がっこう [がっ こう].
+func SplitSyllables(reading string) []string {
+	var syllables []string
+	prevVowel := ""
+	for _, m := range SplitMorae(reading) {
+		h := ToHiragana(m)
+		if len(syllables) > 0 && (h == "っ" || h == "ん" || h == "ー" || lengthens(prevVowel, h)) {
+			syllables[len(syllables)-1] += m
+			if h != "ー" {
+				prevVowel = ""
+			}
+			continue
+		}
+		syllables = append(syllables, m)
+		prevVowel = lastVowel(ToRomaji(h))
+	}
+	return syllables
+}
+
+// lengthens reports whether the hiragana mora m is a vowel that lengthens prevVowel.
+func lengthens(prevVowel, m string) bool {
+	if prevVowel == "" {
+		return false
+	}
+	runes := []rune(m)
+	if len(runes) != 1 {
+		return false
+	}
+	v := romajiMono[runes[0]]
+	if len(v) != 1 {
+		return false
+	}
+	return v == prevVowel || prevVowel == "o" && v == "u" || prevVowel == "e" && v == "i"
+}
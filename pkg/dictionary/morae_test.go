@@ -0,0 +1,47 @@
+package dictionary
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitMorae(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"とうきょう", "と/う/きょ/う"},
+		{"きゃく", "きゃ/く"},
+		{"がっこう", "が/っ/こ/う"},
+		{"トウキョウ", "ト/ウ/キョ/ウ"},
+		{"しんぶん", "し/ん/ぶ/ん"},
+		{"ラーメン", "ラ/ー/メ/ン"},
+		{"ファイル", "ファ/イ/ル"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(SplitMorae(tt.in), "/"); got != tt.out {
+			t.Errorf("SplitMorae(%q) = %q; want %q", tt.in, got, tt.out)
+		}
+	}
+}
+
+func TestSplitSyllables(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"とうきょう", "とう/きょう"},
+		{"きゃく", "きゃ/く"},
+		{"がっこう", "がっ/こう"},
+		{"しんぶん", "しん/ぶん"},
+		{"ラーメン", "ラー/メン"},
+		{"せんせい", "せん/せい"},
+		{"おばあさん", "お/ばあ/さん"},
+		{"かう", "か/う"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(SplitSyllables(tt.in), "/"); got != tt.out {
+			t.Errorf("SplitSyllables(%q) = %q; want %q", tt.in, got, tt.out)
+		}
+	}
+}
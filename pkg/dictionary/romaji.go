@@ -0,0 +1,116 @@
+package dictionary
+
+import "strings"
+
+// romajiMono maps single hiragana to modified Hepburn romaji.
+var romajiMono = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ゔ': "vu",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o",
+	'ゃ': "ya", 'ゅ': "yu", 'ょ': "yo", 'ゎ': "wa",
+}
+
+// romajiDigraph maps a kana followed by a small kana to a single syllable.
+var romajiDigraph = map[string]string{
+	"きゃ": "kya", "きゅ": "kyu", "きょ": "kyo",
+	"しゃ": "sha", "しゅ": "shu", "しょ": "sho", "しぇ": "she",
+	"ちゃ": "cha", "ちゅ": "chu", "ちょ": "cho", "ちぇ": "che",
+	"にゃ": "nya", "にゅ": "nyu", "にょ": "nyo",
+	"ひゃ": "hya", "ひゅ": "hyu", "ひょ": "hyo",
+	"みゃ": "mya", "みゅ": "myu", "みょ": "myo",
+	"りゃ": "rya", "りゅ": "ryu", "りょ": "ryo",
+	"ぎゃ": "gya", "ぎゅ": "gyu", "ぎょ": "gyo",
+	"じゃ": "ja", "じゅ": "ju", "じょ": "jo", "じぇ": "je",
+	"ぢゃ": "ja", "ぢゅ": "ju", "ぢょ": "jo",
+	"びゃ": "bya", "びゅ": "byu", "びょ": "byo",
+	"ぴゃ": "pya", "ぴゅ": "pyu", "ぴょ": "pyo",
+	"ふぁ": "fa", "ふぃ": "fi", "ふぇ": "fe", "ふぉ": "fo",
+	"てぃ": "ti", "でぃ": "di", "とぅ": "tu", "どぅ": "du",
+	"うぃ": "wi", "うぇ": "we", "うぉ": "wo",
+	"ゔぁ": "va", "ゔぃ": "vi", "ゔぇ": "ve", "ゔぉ": "vo",
+	"つぁ": "tsa", "つぃ": "tsi", "つぇ": "tse", "つぉ": "tso",
+}
+
+// ToRomaji transliterates kana (hiragana or katakana) into modified Hepburn romaji:
+// しんぶん gives "shinbun", がっこう "gakkou", きんえん "kin'en" and ラーメン "raamen"
+// (ー repeats the preceding vowel; long vowels are not marked with macrons). Characters
+// other than kana, such as kanji, are copied through unchanged.
+func ToRomaji(s string) string {
+	runes := []rune(ToHiragana(s))
+	var out strings.Builder
+	geminate := false // a preceding っ doubles the next consonant
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		var syl string
+		if i+1 < len(runes) {
+			syl = romajiDigraph[string(runes[i:i+2])]
+		}
+		if syl != "" {
+			i++
+		} else {
+			switch r {
+			case 'っ':
+				geminate = true
+				continue
+			case 'ん':
+				syl = "n"
+				// Keep ん distinct from a following vowel or y syllable (きんえん → kin'en).
+				if i+1 < len(runes) {
+					if next := romajiMono[runes[i+1]]; next != "" && strings.ContainsRune("aiueoy", rune(next[0])) {
+						syl = "n'"
+					}
+				}
+			case 'ー':
+				syl = lastVowel(out.String())
+			default:
+				syl = romajiMono[r]
+			}
+		}
+		if syl == "" {
+			if geminate {
+				out.WriteString("っ")
+				geminate = false
+			}
+			out.WriteRune(r)
+			continue
+		}
+		if geminate {
+			if strings.HasPrefix(syl, "ch") {
+				out.WriteByte('t')
+			} else if !strings.ContainsRune("aiueon", rune(syl[0])) {
+				out.WriteByte(syl[0])
+			}
+			geminate = false
+		}
+		out.WriteString(syl)
+	}
+	if geminate {
+		out.WriteString("っ")
+	}
+	return out.String()
+}
+
+// lastVowel returns the final vowel of s, or "" if s does not end in one.
+func lastVowel(s string) string {
+	if s == "" {
+		return ""
+	}
+	if c := s[len(s)-1]; strings.IndexByte("aiueo", c) >= 0 {
+		return string(c)
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package dictionary
+
+import "testing"
+
+func TestToRomaji(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"しんぶん", "shinbun"},
+		{"がっこう", "gakkou"},
+		{"きんえん", "kin'en"},
+		{"こんや", "kon'ya"},
+		{"ラーメン", "raamen"},
+		{"とうきょう", "toukyou"},
+		{"まっちゃ", "matcha"},
+		{"ちゃんと", "chanto"},
+		{"ファイル", "fairu"},
+		{"ヴァイオリン", "vaiorin"},
+		{"じゅう", "juu"},
+		{"を", "o"},
+		{"猫ねこ", "猫neko"},
+		{"あっ", "aっ"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ToRomaji(tt.in); got != tt.out {
+			t.Errorf("ToRomaji(%q) = %q; want %q", tt.in, got, tt.out)
+		}
+	}
+}
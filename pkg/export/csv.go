@@ -0,0 +1,93 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/dictionary"
+)
+
+// CSVColumns lists the column names ExportCSV accepts, in their default order.
+var CSVColumns = []string{"word", "lemma", "reading", "furigana", "romaji", "meaning", "occurrences", "status", "example"}
+
+// csvValue returns the value of column for wf.
+func csvValue(column string, wf db.WordFrequency) string {
+	switch column {
+	case "word":
+		return wf.Word.Word
+	case "lemma":
+		return wf.Word.Lemma
+	case "reading":
+		return wf.Word.Pronunciation
+	case "furigana":
+		return Furigana(wf.Word.Word, wf.Word.Pronunciation)
+	case "romaji":
+		return dictionary.ToRomaji(wf.Word.Pronunciation)
+	case "meaning":
+		return dictionary.FlattenDefinitions(wf.Word.Definitions)
+	case "occurrences":
+		return strconv.Itoa(wf.Count)
+	case "status":
+		return wf.Status
+	case "example":
+		return wf.Example
+	}
+	return ""
+}
+
+// ExportCSV writes the words of sourceID (0 for every source), most frequent first, as
+// RFC 4180 CSV with a header row of the given columns (see CSVColumns; nil selects all
+// of them). Unknown column names are rejected before anything is written.
+func ExportCSV(conn db.DBExecutor, sourceID int64, columns []string, w io.Writer) error {
+	if len(columns) == 0 {
+		columns = CSVColumns
+	}
+	for _, c := range columns {
+		if !validCSVColumn(c) {
+			return fmt.Errorf("unknown CSV column %q (want one of %s)", c, strings.Join(CSVColumns, ", "))
+		}
+	}
+
+	words, err := db.GetWordFrequencies(conn, sourceID, 0)
+	if err != nil {
+		return err
+	}
+	for _, c := range columns {
+		if c == "example" {
+			if err := FillExamples(conn, words); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true // RFC 4180 line endings
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	record := make([]string, len(columns))
+	for _, wf := range words {
+		for i, c := range columns {
+			record[i] = csvValue(c, wf)
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func validCSVColumn(name string) bool {
+	for _, c := range CSVColumns {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/db"
+)
+
+func TestExportCSV(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "website_article", "猫の話", "", "", "https://example.com/cat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catID, err := db.CreateOrGetWord(conn, "猫", "猫", "ねこ", `[{"senses":["cat","\"kitty\", informally"],"pos":["n"]}]`, "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dogID, err := db.CreateOrGetWord(conn, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, catID, sourceID, "", "", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, dogID, sourceID, "", "", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWordStatus(conn, catID, db.WordStatusLearning); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportCSV(conn, sourceID, []string{"word", "romaji", "meaning", "occurrences", "status"}, &buf); err != nil {
+		t.Fatalf("ExportCSV: %v", err)
+	}
+	lines := strings.Split(buf.String(), "\r\n")
+	if lines[0] != "word,romaji,meaning,occurrences,status" {
+		t.Fatalf("unexpected header %q", lines[0])
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q", records)
+	}
+	cat := records[1]
+	if cat[0] != "猫" || cat[1] != "neko" || !strings.Contains(cat[2], `"kitty", informally`) || cat[3] != "3" || cat[4] != db.WordStatusLearning {
+		t.Errorf("unexpected row %q", cat)
+	}
+	if records[2][0] != "犬" || records[2][4] != db.WordStatusNew {
+		t.Errorf("unexpected row %q", records[2])
+	}
+
+	buf.Reset()
+	if err := ExportCSV(conn, sourceID, []string{"word", "furigana"}, &buf); err != nil {
+		t.Fatalf("ExportCSV furigana: %v", err)
+	}
+	if records, err = csv.NewReader(&buf).ReadAll(); err != nil || len(records) != 3 {
+		t.Fatalf("expected a header and 2 rows, got %q (%v)", records, err)
+	}
+	if records[1][1] != "猫[ねこ]" || records[2][1] != "犬[いぬ]" {
+		t.Errorf("unexpected furigana column %q, %q", records[1], records[2])
+	}
+
+	if err := ExportCSV(conn, sourceID, []string{"word", "jlpt"}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), `"jlpt"`) {
+		t.Fatalf("expected an unknown column error, got %v", err)
+	}
+}
+
+func TestExportCSVExamplePrefersPrimarySource(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	short, err := db.CreateOrGetSource(conn, "website_article", "短い", "", "", "https://example.com/short", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	long, err := db.CreateOrGetSource(conn, "website_article", "長い", "", "", "https://example.com/long", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catID, err := db.CreateOrGetWord(conn, "猫", "猫", "ねこ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	primaryExample := "猫だ。"
+	betterExample := "今日は庭で猫がのんびり遊んでいました。"
+	if err := db.LinkWordToSource(conn, catID, short, primaryExample, primaryExample, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, catID, long, betterExample, betterExample, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	example := func() string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := ExportCSV(conn, 0, []string{"word", "example"}, &buf); err != nil {
+			t.Fatalf("ExportCSV: %v", err)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil || len(records) != 2 {
+			t.Fatalf("expected a header and 1 row, got %q (%v)", records, err)
+		}
+		return records[1][1]
+	}
+
+	if got := example(); got != betterExample {
+		t.Errorf("without a primary source expected the best-scoring example %q, got %q", betterExample, got)
+	}
+	if err := db.SetPrimarySource(conn, catID, short); err != nil {
+		t.Fatal(err)
+	}
+	if got := example(); got != primaryExample {
+		t.Errorf("expected the primary source's example %q, got %q", primaryExample, got)
+	}
+}
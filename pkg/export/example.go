@@ -0,0 +1,23 @@
+package export
+
+import (
+	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+// FillExamples sets Example on each of words to the sentence db.GetBestExample picks: the
+// example from the word's primary source if it has one, otherwise the best-scoring one
+// (readerer.ScoreSentence) across all of its sources.
+func FillExamples(conn db.DBExecutor, words []db.WordFrequency) error {
+	for i := range words {
+		word := words[i].Word.Word
+		example, err := db.GetBestExample(conn, words[i].Word.ID, func(sentence string) int {
+			return readerer.ScoreSentence(sentence, word)
+		})
+		if err != nil {
+			return err
+		}
+		words[i].Example = example
+	}
+	return nil
+}
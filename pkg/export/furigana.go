@@ -0,0 +1,71 @@
+package export
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/japaniel/readerer/pkg/dictionary"
+)
+
+// Furigana renders word with its reading in Anki's furigana syntax, attaching readings to
+// the kanji only: 食べる/たべる gives "食[た]べる", 取り消す/とりけす gives "取[と]り 消[け]す"
+// (a space ends the text each reading applies to) and 犬/いぬ gives "犬[いぬ]". Kana-only
+// words and words without a reading are returned unchanged. When the kana in word cannot
+// be lined up with reading, the whole word is annotated as a fallback.
+func Furigana(word, reading string) string {
+	reading = dictionary.ToHiragana(reading)
+	if reading == "" || dictionary.IsKana(word) || dictionary.ToHiragana(word) == reading {
+		return word
+	}
+
+	runs := splitKanaRuns(word)
+	// Kanji runs match one or more reading characters; kana runs must match themselves.
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range runs {
+		if r.kana {
+			pattern.WriteString(regexp.QuoteMeta(dictionary.ToHiragana(r.text)))
+		} else {
+			pattern.WriteString("(.+?)")
+		}
+	}
+	pattern.WriteString("$")
+	m := regexp.MustCompile(pattern.String()).FindStringSubmatch(reading)
+	if m == nil {
+		return word + "[" + reading + "]"
+	}
+
+	var out strings.Builder
+	group := 1
+	for i, r := range runs {
+		if r.kana {
+			out.WriteString(r.text)
+			continue
+		}
+		if i > 0 {
+			out.WriteString(" ")
+		}
+		out.WriteString(r.text + "[" + m[group] + "]")
+		group++
+	}
+	return out.String()
+}
+
+// kanaRun is a maximal stretch of word that is either all kana or contains no kana.
+type kanaRun struct {
+	text string
+	kana bool
+}
+
+func splitKanaRuns(word string) []kanaRun {
+	var runs []kanaRun
+	for _, r := range word {
+		kana := dictionary.IsKana(string(r))
+		if n := len(runs); n > 0 && runs[n-1].kana == kana {
+			runs[n-1].text += string(r)
+			continue
+		}
+		runs = append(runs, kanaRun{text: string(r), kana: kana})
+	}
+	return runs
+}
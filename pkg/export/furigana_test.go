@@ -0,0 +1,24 @@
+package export
+
+import "testing"
+
+func TestFurigana(t *testing.T) {
+	tests := []struct {
+		word, reading, want string
+	}{
+		{"食べる", "たべる", "食[た]べる"},
+		{"犬", "いぬ", "犬[いぬ]"},
+		{"犬", "イヌ", "犬[いぬ]"},
+		{"取り消す", "とりけす", "取[と]り 消[け]す"},
+		{"お茶", "おちゃ", "お 茶[ちゃ]"},
+		{"ねこ", "ねこ", "ねこ"},
+		{"テスト", "てすと", "テスト"},
+		{"漢字", "", "漢字"},
+		{"食べる", "のむ", "食べる[のむ]"},
+	}
+	for _, tt := range tests {
+		if got := Furigana(tt.word, tt.reading); got != tt.want {
+			t.Errorf("Furigana(%q, %q) = %q; want %q", tt.word, tt.reading, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package export renders stored vocabulary and analyzed text into study and data formats.
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/dictionary"
+)
+
+// WriteMarkdown writes a Markdown study sheet for src: a title heading followed by a
+// table of word | reading | meaning | occurrences | example, in the order given
+// (typically the result of db.GetWordFrequencies, with FillExamples applied).
+func WriteMarkdown(w io.Writer, src db.Source, words []db.WordFrequency) error {
+	bw := bufio.NewWriter(w)
+
+	title := src.Title
+	if title == "" {
+		title = src.URL
+	}
+	fmt.Fprintf(bw, "# %s\n\n", escapeMarkdown(title))
+	if src.URL != "" && src.URL != title {
+		fmt.Fprintf(bw, "Source: <%s>\n\n", src.URL)
+	}
+
+	fmt.Fprintln(bw, "| Word | Reading | Meaning | Occurrences | Example |")
+	fmt.Fprintln(bw, "| --- | --- | --- | ---: | --- |")
+	for _, wf := range words {
+		fmt.Fprintf(bw, "| %s | %s | %s | %d | %s |\n",
+			escapeMarkdown(wf.Word.Word),
+			escapeMarkdown(wf.Word.Pronunciation),
+			escapeMarkdown(dictionary.FlattenDefinitions(wf.Word.Definitions)),
+			wf.Count,
+			escapeMarkdown(wf.Example))
+	}
+	return bw.Flush()
+}
+
+// escapeMarkdown keeps a value on one line and stops pipes from splitting table cells.
+func escapeMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	return strings.ReplaceAll(s, "|", `\|`)
+}
@@ -0,0 +1,73 @@
+package export
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/db"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func setupDB(t *testing.T) *sql.DB {
+	conn, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	conn.SetMaxOpenConns(1)
+	if err := db.InitDB(conn); err != nil {
+		t.Fatalf("failed to init db: %v", err)
+	}
+	return conn
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "website_article", "猫の話", "", "example.com", "https://example.com/cat", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catID, err := db.CreateOrGetWord(conn, "猫", "猫", "ねこ", `[{"senses":["cat"],"pos":["n"]}]`, "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dogID, err := db.CreateOrGetWord(conn, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, catID, sourceID, "猫がいる。", "猫がいる。", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LinkWordToSource(conn, dogID, sourceID, "犬もいる。", "犬もいる。", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := db.GetSource(conn, sourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words, err := db.GetWordFrequencies(conn, sourceID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, src, words); err != nil {
+		t.Fatalf("WriteMarkdown failed: %v", err)
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "# 猫の話\n") {
+		t.Errorf("expected title heading, got:\n%s", out)
+	}
+	catRow := "| 猫 | ねこ | cat | 3 |"
+	if !strings.Contains(out, catRow) {
+		t.Errorf("expected row %q, got:\n%s", catRow, out)
+	}
+	if strings.Index(out, catRow) > strings.Index(out, "| 犬 |") {
+		t.Errorf("expected rows sorted by frequency, got:\n%s", out)
+	}
+}
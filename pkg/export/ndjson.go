@@ -0,0 +1,25 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+// WriteSentencesNDJSON writes each sentence received from sentences to w as one line of
+// JSON (newline-delimited JSON) until the channel is closed, so book-length documents can
+// be emitted while they are still being analyzed. It returns the number of sentences written.
+// On a write error it stops reading; the caller must cancel the producer.
+func WriteSentencesNDJSON(w io.Writer, sentences <-chan readerer.Sentence) (int, error) {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	n := 0
+	for s := range sentences {
+		if err := enc.Encode(s); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,55 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+func TestWriteSentencesNDJSON(t *testing.T) {
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "猫が好きです。犬も好きです！\n\n鳥は空を飛ぶ。魚は泳ぐ？"
+	want, err := analyzer.AnalyzeDocument(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan readerer.Sentence)
+	errc := make(chan error, 1)
+	go func() { errc <- analyzer.StreamDocument(context.Background(), text, ch) }()
+
+	var buf bytes.Buffer
+	n, err := WriteSentencesNDJSON(&buf, ch)
+	if err != nil {
+		t.Fatalf("WriteSentencesNDJSON: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("StreamDocument: %v", err)
+	}
+	if n != len(want) {
+		t.Fatalf("wrote %d sentences, want %d", n, len(want))
+	}
+
+	lines := 0
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var s readerer.Sentence
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatalf("line %d is not valid JSON: %v\n%s", lines+1, err, sc.Text())
+		}
+		if s.Text != want[lines].Text || s.ParagraphIndex != want[lines].ParagraphIndex || len(s.Tokens) != len(want[lines].Tokens) {
+			t.Errorf("line %d = %+v, want %+v", lines+1, s, want[lines])
+		}
+		lines++
+	}
+	if lines != len(want) {
+		t.Fatalf("got %d lines, want %d", lines, len(want))
+	}
+}
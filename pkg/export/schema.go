@@ -0,0 +1,81 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+// jsonSchemaDraft is the JSON Schema dialect SentenceSchema declares.
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// SentenceSchema returns a JSON Schema describing one line written by
+// WriteSentencesNDJSON (a readerer.Sentence). It is generated from the Go struct with
+// reflection, so it always follows the json tags of the output types.
+func SentenceSchema() ([]byte, error) {
+	schema, err := schemaFor(reflect.TypeOf(readerer.Sentence{}))
+	if err != nil {
+		return nil, err
+	}
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "readerer sentence"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// schemaFor builds the schema of values of type t as encoding/json would marshal them.
+// Fields without omitempty are required, and objects admit no other properties.
+func schemaFor(t reflect.Type) (map[string]any, error) {
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}, nil
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaFor(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		// encoding/json writes nil slices as null.
+		return map[string]any{"type": []string{"array", "null"}, "items": items}, nil
+	case reflect.Struct:
+		props := make(map[string]any)
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			prop, err := schemaFor(f.Type)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+			}
+			props[name] = prop
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		return map[string]any{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}, nil
+	default:
+		return nil, fmt.Errorf("no JSON Schema mapping for %s", t)
+	}
+}
@@ -0,0 +1,160 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+// validate checks doc (decoded with encoding/json) against the subset of JSON Schema that
+// SentenceSchema emits: type, properties, required, additionalProperties and items.
+func validate(schema map[string]any, doc any, path string) error {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = []string{t}
+	case []any:
+		for _, v := range t {
+			types = append(types, v.(string))
+		}
+	}
+	matched := ""
+	for _, typ := range types {
+		if jsonTypeMatches(typ, doc) {
+			matched = typ
+			break
+		}
+	}
+	if matched == "" {
+		return fmt.Errorf("%s: %v (%T) is not of type %v", path, doc, doc, types)
+	}
+	switch matched {
+	case "object":
+		obj := doc.(map[string]any)
+		props, _ := schema["properties"].(map[string]any)
+		for _, name := range schema["required"].([]any) {
+			if _, ok := obj[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			prop, ok := props[k]
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: unexpected property %q", path, k)
+				}
+				continue
+			}
+			if err := validate(prop.(map[string]any), obj[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		for i, item := range doc.([]any) {
+			if err := validate(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func jsonTypeMatches(typ string, v any) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "null":
+		return v == nil
+	}
+	return false
+}
+
+func TestSentenceSchemaValidatesNDJSONOutput(t *testing.T) {
+	raw, err := SentenceSchema()
+	if err != nil {
+		t.Fatalf("SentenceSchema: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	if schema["$schema"] != jsonSchemaDraft {
+		t.Errorf("unexpected $schema %v", schema["$schema"])
+	}
+
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan readerer.Sentence)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- analyzer.StreamDocument(context.Background(), "猫が好きです。\n\nズヴォグラッチは何？", ch)
+	}()
+	var buf bytes.Buffer
+	if _, err := WriteSentencesNDJSON(&buf, ch); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+
+	lines := 0
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var doc any
+		if err := json.Unmarshal(sc.Bytes(), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := validate(schema, doc, "$"); err != nil {
+			t.Errorf("line %d does not match the schema: %v\n%s", lines+1, err, sc.Text())
+		}
+		lines++
+	}
+	if lines == 0 {
+		t.Fatal("no output to validate")
+	}
+
+	// The validator itself must reject documents that break the schema.
+	for _, bad := range []string{
+		`{"text":"猫","tokens":[],"paragraph_index":"0"}`,
+		`{"text":"猫","tokens":[]}`,
+		`{"text":"猫","tokens":[],"paragraph_index":0,"extra":1}`,
+		`{"text":"猫","tokens":[{"surface":"猫"}],"paragraph_index":0}`,
+	} {
+		var doc any
+		if err := json.Unmarshal([]byte(bad), &doc); err != nil {
+			t.Fatal(err)
+		}
+		if err := validate(schema, doc, "$"); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
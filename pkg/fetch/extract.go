@@ -0,0 +1,114 @@
+package fetch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"unicode"
+
+	"github.com/go-shiori/go-readability"
+	"github.com/japaniel/readerer/pkg/readerer"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultMinContentRunes is the minimum amount of extracted text (in non-whitespace
+// runes) treated as a real article. Pages below it are usually SPA shells or paywalls.
+const DefaultMinContentRunes = 30
+
+// ErrNoContent is returned when extraction yields too little text to be worth ingesting.
+var ErrNoContent = errors.New("no article content extracted")
+
+// ErrExtraction is returned (wrapping readability's error) when the page cannot be
+// parsed into an article at all. Batch callers can log it and move on to the next URL.
+var ErrExtraction = errors.New("failed to extract article")
+
+// Extractor turns fetched HTML into article text using go-readability.
+type Extractor struct {
+	// MinContentRunes is the minimum number of non-whitespace runes the extracted
+	// text must contain; below it ExtractArticle returns ErrNoContent. 0 disables the check.
+	MinContentRunes int
+	// MaxElements makes extraction fail with ErrExtraction on pages with more HTML
+	// elements than this, guarding against pathological documents. 0 means no limit.
+	MaxElements int
+}
+
+// NewExtractor creates an Extractor with DefaultMinContentRunes.
+func NewExtractor() *Extractor {
+	return &Extractor{MinContentRunes: DefaultMinContentRunes}
+}
+
+// ExtractArticle removes ruby annotations from body and extracts the main article.
+// pageURL helps readability resolve relative links and may be empty.
+//
+// If the extracted text is shorter than MinContentRunes, the article is returned
+// together with an error wrapping ErrNoContent so callers can still report its title.
+func (e *Extractor) ExtractArticle(body []byte, pageURL string) (readability.Article, error) {
+	parsedURL, _ := url.Parse(pageURL)
+
+	// Drop scripts, styles and comments, then sanitize Ruby tags (remove <rt>...</rt>)
+	// to prevent duplicate text.
+	cleaned := readerer.SanitizeRuby(stripNonContent(body))
+
+	parser := readability.NewParser()
+	parser.MaxElemsToParse = e.MaxElements
+	article, err := parser.Parse(bytes.NewReader(cleaned), parsedURL)
+	if err != nil {
+		return readability.Article{}, fmt.Errorf("%w: %w", ErrExtraction, err)
+	}
+
+	if e.MinContentRunes > 0 {
+		if n := countContentRunes(article.TextContent); n < e.MinContentRunes {
+			return article, fmt.Errorf("%w: %d characters extracted, need at least %d", ErrNoContent, n, e.MinContentRunes)
+		}
+	}
+	return article, nil
+}
+
+// stripNonContent removes <script> and <style> elements and HTML comments, which
+// readability occasionally leaks into the article text. Everything else is copied
+// through byte for byte, so the document's encoding is left untouched.
+func stripNonContent(body []byte) []byte {
+	var out bytes.Buffer
+	out.Grow(len(body))
+	z := html.NewTokenizer(bytes.NewReader(body))
+	var skip atom.Atom // element whose contents are being dropped, 0 if none
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			// io.EOF or a read error; either way the rest of the input is unusable.
+			return out.Bytes()
+		}
+		switch tt {
+		case html.CommentToken:
+			continue
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if a := atom.Lookup(name); skip == 0 && (a == atom.Script || a == atom.Style) {
+				skip = a
+				continue
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if skip != 0 && atom.Lookup(name) == skip {
+				skip = 0
+				continue
+			}
+		}
+		if skip == 0 {
+			out.Write(z.Raw())
+		}
+	}
+}
+
+// countContentRunes counts non-whitespace runes.
+func countContentRunes(s string) int {
+	n := 0
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			n++
+		}
+	}
+	return n
+}
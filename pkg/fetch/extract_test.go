@@ -0,0 +1,101 @@
+package fetch
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/readerer"
+)
+
+func TestExtractArticleNoContent(t *testing.T) {
+	body, err := os.ReadFile("testdata/empty_body.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	_, err = NewExtractor().ExtractArticle(body, "http://localhost/app")
+	if !errors.Is(err, ErrNoContent) {
+		t.Fatalf("expected ErrNoContent, got %v", err)
+	}
+
+	// Disabling the threshold lets the (empty) article through.
+	e := &Extractor{MinContentRunes: 0}
+	if _, err := e.ExtractArticle(body, "http://localhost/app"); err != nil {
+		t.Fatalf("expected no error with threshold disabled, got %v", err)
+	}
+}
+
+func TestExtractArticleFixture(t *testing.T) {
+	body, err := os.ReadFile("../readerer/testdata/mainichi_article.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	article, err := NewExtractor().ExtractArticle(body, "https://mainichi.jp/articles/20260208/k00/00m/050/079000c")
+	if err != nil {
+		t.Fatalf("ExtractArticle failed: %v", err)
+	}
+	if countContentRunes(article.TextContent) < DefaultMinContentRunes {
+		t.Fatalf("expected article text, got %q", article.TextContent)
+	}
+}
+
+func TestExtractArticleMalformedReturnsErrExtraction(t *testing.T) {
+	// An unclosed, deeply nested document that exceeds the element budget.
+	body := []byte("<html><body>" + strings.Repeat("<div><p>本文", 50))
+
+	e := NewExtractor()
+	e.MaxElements = 20
+	_, err := e.ExtractArticle(body, "http://localhost/broken")
+	if !errors.Is(err, ErrExtraction) {
+		t.Fatalf("expected ErrExtraction, got %v", err)
+	}
+	if errors.Is(err, ErrNoContent) {
+		t.Fatalf("extraction failure must not look like an empty page: %v", err)
+	}
+
+	// The next document in a batch is unaffected.
+	if _, err := e.ExtractArticle([]byte("<html><body><p>短い</p></body></html>"), ""); errors.Is(err, ErrExtraction) {
+		t.Fatalf("expected small document to extract, got %v", err)
+	}
+}
+
+func TestExtractArticleStripsScriptsStylesAndComments(t *testing.T) {
+	body, err := os.ReadFile("testdata/inline_script.html")
+	if err != nil {
+		t.Fatalf("read fixture: %v", err)
+	}
+
+	article, err := NewExtractor().ExtractArticle(body, "http://localhost/library")
+	if err != nil {
+		t.Fatalf("ExtractArticle failed: %v", err)
+	}
+	if !strings.Contains(article.TextContent, "市立図書館") {
+		t.Fatalf("expected article text, got %q", article.TextContent)
+	}
+
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := analyzer.Analyze(article.TextContent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens {
+		for _, leaked := range []string{"追跡", "トラッキング", "広告", "編集", "構造"} {
+			if strings.Contains(tok.Surface, leaked) {
+				t.Errorf("token %q leaked from script, style or comment", tok.Surface)
+			}
+		}
+	}
+}
+
+func TestStripNonContentKeepsMarkup(t *testing.T) {
+	in := `<p>前<!-- c --><script>x()</script>後</p><style>p{}</style><p>次</p>`
+	if got, want := string(stripNonContent([]byte(in))), `<p>前後</p><p>次</p>`; got != want {
+		t.Errorf("stripNonContent = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,226 @@
+// Package fetch downloads web pages for ingestion.
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// DefaultMaxBodySize limits how much HTML is read from untrusted URLs to prevent OOM.
+const DefaultMaxBodySize = 10 * 1024 * 1024 // 10 MB
+
+// ErrBodyTooLarge is returned when a response body exceeds the fetcher's size limit.
+// Callers can distinguish it from network errors with errors.Is.
+var ErrBodyTooLarge = errors.New("response body exceeds size limit")
+
+// HTTPDoer sends HTTP requests. *http.Client implements it; tests and library users can
+// supply their own to serve fixtures without a network or a server.
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DefaultClient is the HTTPDoer used by NewFetcher, and by Fetch when Client is nil.
+// Replace it to route every fetch through a custom client.
+var DefaultClient HTTPDoer = &http.Client{Timeout: 30 * time.Second}
+
+// Fetcher downloads pages using browser-like request headers and a body size limit.
+type Fetcher struct {
+	// Client performs the requests. nil means DefaultClient.
+	Client HTTPDoer
+	// MaxBodySize is the maximum number of body bytes accepted. 0 means DefaultMaxBodySize.
+	MaxBodySize int64
+}
+
+// NewFetcher creates a Fetcher using DefaultClient (a 30 second timeout unless replaced)
+// and the default size limit.
+func NewFetcher() *Fetcher {
+	return &Fetcher{
+		Client:      DefaultClient,
+		MaxBodySize: DefaultMaxBodySize,
+	}
+}
+
+// Fetch GETs rawURL and returns the response body.
+//
+// If the body exceeds MaxBodySize, Fetch returns an error wrapping ErrBodyTooLarge.
+// When the oversize was only discovered while reading (no Content-Length), the
+// truncated body read so far is returned alongside the error so callers can decide
+// whether to proceed with partial content.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	maxSize := f.MaxBodySize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxBodySize
+	}
+	client := f.Client
+	if client == nil {
+		client = DefaultClient
+	}
+
+	// Create a custom request with a User-Agent to avoid being blocked (e.g. 403 Forbidden or Cloudflare)
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	setBrowserHeaders(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("got status code %d (blocking or API error)", resp.StatusCode)
+	}
+
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: Content-Length %d exceeds limit of %d bytes", ErrBodyTooLarge, resp.ContentLength, maxSize)
+	}
+
+	reader, err := decodedBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	// Read one byte past the limit so a body of exactly maxSize bytes is not mistaken for truncation.
+	body, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(body)) > maxSize {
+		return body[:maxSize], fmt.Errorf("%w: body exceeded %d bytes", ErrBodyTooLarge, maxSize)
+	}
+	return body, nil
+}
+
+// decodedBody returns resp.Body, gunzipped if the server marked it Content-Encoding gzip.
+// The transport only decompresses transparently when it negotiated gzip itself, so a
+// server that compresses regardless would otherwise hand back compressed bytes. The
+// size limit applies to the decompressed stream.
+func decodedBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress gzip response body: %w", err)
+		}
+		return zr, nil
+	}
+	return resp.Body, nil
+}
+
+// Page is one fetched page of a (possibly paginated) article.
+type Page struct {
+	URL  string
+	Body []byte
+}
+
+// FetchPages fetches rawURL and then follows its "next page" links (see NextPageURL) for
+// up to maxFollow more pages, stopping early at the last page or at a link to a page
+// already fetched. Pages are returned in reading order.
+//
+// If a follow-up page fails, the pages fetched so far are returned with the error, so
+// callers can still use the first part of the article.
+func (f *Fetcher) FetchPages(ctx context.Context, rawURL string, maxFollow int) ([]Page, error) {
+	body, err := f.Fetch(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	pages := []Page{{URL: rawURL, Body: body}}
+	seen := map[string]bool{rawURL: true}
+	for len(pages) <= maxFollow {
+		last := pages[len(pages)-1]
+		next, ok := NextPageURL(last.Body, last.URL)
+		if !ok || seen[next] {
+			break
+		}
+		seen[next] = true
+		body, err := f.Fetch(ctx, next)
+		if err != nil {
+			return pages, fmt.Errorf("fetch page %d (%s): %w", len(pages)+1, next, err)
+		}
+		pages = append(pages, Page{URL: next, Body: body})
+	}
+	return pages, nil
+}
+
+// NextPageURL finds the link to the next page of a paginated article in body: the first
+// <link> or <a> element with rel="next". The link is resolved against pageURL and only
+// returned if it stays on the same host.
+func NextPageURL(body []byte, pageURL string) (string, bool) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return "", false
+	}
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return "", false
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if a := atom.Lookup(name); (a != atom.Link && a != atom.A) || !hasAttr {
+			continue
+		}
+		var rel, href string
+		for more := true; more; {
+			var k, v []byte
+			k, v, more = z.TagAttr()
+			switch string(k) {
+			case "rel":
+				rel = string(v)
+			case "href":
+				href = string(v)
+			}
+		}
+		if href == "" || !hasRel(rel, "next") {
+			continue
+		}
+		next, err := base.Parse(href)
+		if err != nil || next.Host != base.Host {
+			continue
+		}
+		next.Fragment = ""
+		return next.String(), true
+	}
+}
+
+// hasRel reports whether the space-separated rel attribute value contains want.
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// setBrowserHeaders mimics a real browser (Windows Chrome) so sites serve the normal article page.
+func setBrowserHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9,ja;q=0.8")
+	req.Header.Set("Referer", "https://www.google.com/")
+	req.Header.Set("Sec-Ch-Ua", `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`)
+	req.Header.Set("Sec-Ch-Ua-Mobile", "?0")
+	req.Header.Set("Sec-Ch-Ua-Platform", `"Windows"`)
+	req.Header.Set("Sec-Fetch-Dest", "document")
+	req.Header.Set("Sec-Fetch-Mode", "navigate")
+	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	req.Header.Set("Sec-Fetch-User", "?1")
+	req.Header.Set("Upgrade-Insecure-Requests", "1")
+}
@@ -0,0 +1,240 @@
+package fetch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFetchReturnsBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			t.Errorf("expected a browser User-Agent header")
+		}
+		w.Write([]byte("<html>ok</html>"))
+	}))
+	defer srv.Close()
+
+	body, err := NewFetcher().Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(body) != "<html>ok</html>" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+func TestFetchBodyTooLarge(t *testing.T) {
+	payload := strings.Repeat("あ", 100) // 300 bytes
+
+	t.Run("Content-Length", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(payload))
+		}))
+		defer srv.Close()
+
+		f := NewFetcher()
+		f.MaxBodySize = 64
+		_, err := f.Fetch(context.Background(), srv.URL)
+		if !errors.Is(err, ErrBodyTooLarge) {
+			t.Fatalf("expected ErrBodyTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("Streamed", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Flushing before writing forces chunked encoding without a Content-Length.
+			w.(http.Flusher).Flush()
+			w.Write([]byte(payload))
+		}))
+		defer srv.Close()
+
+		f := NewFetcher()
+		f.MaxBodySize = 64
+		body, err := f.Fetch(context.Background(), srv.URL)
+		if !errors.Is(err, ErrBodyTooLarge) {
+			t.Fatalf("expected ErrBodyTooLarge, got %v", err)
+		}
+		if len(body) != 64 {
+			t.Fatalf("expected truncated body of 64 bytes, got %d", len(body))
+		}
+	})
+
+	t.Run("ExactlyAtLimit", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(payload))
+		}))
+		defer srv.Close()
+
+		f := NewFetcher()
+		f.MaxBodySize = int64(len(payload))
+		if _, err := f.Fetch(context.Background(), srv.URL); err != nil {
+			t.Fatalf("expected body at the limit to be accepted, got %v", err)
+		}
+	})
+}
+
+func TestFetchNonOKStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := NewFetcher().Fetch(context.Background(), srv.URL)
+	if err == nil || errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected a status error, got %v", err)
+	}
+}
+
+func TestFetchGzipWithoutNegotiation(t *testing.T) {
+	page := `<html><head><title>記事</title></head><body><article><h1>記事</h1>` +
+		strings.Repeat("<p>今日は学校で日本語の新しい言葉をたくさん勉強しました。</p>", 5) +
+		`</article></body></html>`
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(page))
+	zw.Close()
+	compressed := buf.Bytes()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Compress regardless of what the client asked for.
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(compressed)
+	}))
+	defer srv.Close()
+
+	// With compression disabled the transport neither asks for gzip nor decodes it.
+	f := NewFetcher()
+	f.Client = &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	body, err := f.Fetch(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(body) != page {
+		t.Fatalf("expected the decompressed page, got %q", body)
+	}
+	article, err := NewExtractor().ExtractArticle(body, srv.URL)
+	if err != nil {
+		t.Fatalf("ExtractArticle failed: %v", err)
+	}
+	if !strings.Contains(article.TextContent, "日本語の新しい言葉") {
+		t.Fatalf("unexpected article text %q", article.TextContent)
+	}
+
+	// The size limit counts decompressed bytes, so a small gzip can't expand past it.
+	f.MaxBodySize = int64(len(compressed)) + 1
+	if _, err := f.Fetch(context.Background(), srv.URL); !errors.Is(err, ErrBodyTooLarge) {
+		t.Fatalf("expected ErrBodyTooLarge for the decompressed size, got %v", err)
+	}
+}
+
+// fakeDoer answers every request from memory and records the URLs it was asked for.
+type fakeDoer struct {
+	body string
+	urls []string
+}
+
+func (d *fakeDoer) Do(req *http.Request) (*http.Response, error) {
+	d.urls = append(d.urls, req.URL.String())
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(d.body)),
+		ContentLength: int64(len(d.body)),
+		Request:       req,
+	}, nil
+}
+
+func TestFetchUsesInjectedClient(t *testing.T) {
+	doer := &fakeDoer{body: "<html>fixture</html>"}
+
+	f := NewFetcher()
+	f.Client = doer
+	body, err := f.Fetch(context.Background(), "https://example.invalid/page")
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(body) != "<html>fixture</html>" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if len(doer.urls) != 1 || doer.urls[0] != "https://example.invalid/page" {
+		t.Fatalf("expected one request to the page, got %v", doer.urls)
+	}
+
+	// Replacing DefaultClient reroutes fetchers that don't set their own.
+	orig := DefaultClient
+	DefaultClient = doer
+	defer func() { DefaultClient = orig }()
+	if _, err := (&Fetcher{}).Fetch(context.Background(), "https://example.invalid/other"); err != nil {
+		t.Fatalf("Fetch with default client failed: %v", err)
+	}
+	if len(doer.urls) != 2 {
+		t.Fatalf("expected DefaultClient to be used, got %v", doer.urls)
+	}
+}
+
+// pagesDoer serves a fixed HTML page per URL and 404 for anything else.
+type pagesDoer struct {
+	pages map[string]string
+	urls  []string
+}
+
+func (d *pagesDoer) Do(req *http.Request) (*http.Response, error) {
+	d.urls = append(d.urls, req.URL.String())
+	body, ok := d.pages[req.URL.String()]
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestFetchPagesFollowsNextLinks(t *testing.T) {
+	doer := &pagesDoer{pages: map[string]string{
+		"https://news.example/a":        `<html><head><link rel="next" href="/a?page=2"></head><body>one</body></html>`,
+		"https://news.example/a?page=2": `<html><body>two <a class="pager" rel="next" href="?page=3#top">次へ</a></body></html>`,
+		"https://news.example/a?page=3": `<html><body>three <a rel="next" href="https://other.example/a?page=4">next</a></body></html>`,
+	}}
+	f := NewFetcher()
+	f.Client = doer
+
+	pages, err := f.FetchPages(context.Background(), "https://news.example/a", 5)
+	if err != nil {
+		t.Fatalf("FetchPages: %v", err)
+	}
+	var got []string
+	for _, p := range pages {
+		got = append(got, p.URL)
+	}
+	// The link to another host is not followed.
+	if strings.Join(got, " ") != "https://news.example/a https://news.example/a?page=2 https://news.example/a?page=3" {
+		t.Fatalf("unexpected pages %v", got)
+	}
+
+	doer.urls = nil
+	if pages, err = f.FetchPages(context.Background(), "https://news.example/a", 1); err != nil || len(pages) != 2 {
+		t.Fatalf("expected the limit to stop after 2 pages, got %d (err %v)", len(pages), err)
+	}
+	if len(doer.urls) != 2 {
+		t.Fatalf("expected 2 requests, got %v", doer.urls)
+	}
+
+	// A failing follow-up page keeps the pages already fetched.
+	doer.pages["https://news.example/a?page=2"] = `<html><link rel="next" href="/missing"></html>`
+	pages, err = f.FetchPages(context.Background(), "https://news.example/a", 5)
+	if err == nil || len(pages) != 2 {
+		t.Fatalf("expected 2 pages and an error, got %d pages (err %v)", len(pages), err)
+	}
+}
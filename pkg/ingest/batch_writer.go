@@ -3,6 +3,7 @@ package ingest
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -22,9 +23,23 @@ type BatchWriter struct {
 	ctx         context.Context
 	cancel      context.CancelFunc
 
+	// shutdownCtx is passed to batch transactions and write callbacks. Unlike ctx it is not
+	// canceled by Close, so pending batches still commit; only AbortAfter cancels it.
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+	abortTimer     *time.Timer
+
 	commitCh chan []WriteFunc
 	db       *sql.DB
 	OnError  func(error)
+	// OnCommit is called from the committer goroutine after each batch has been
+	// durably committed. It is not called for batches that fail or are dropped.
+	OnCommit func()
+	// ContinueOnItemError runs each callback in its own savepoint so a failing callback
+	// is rolled back alone and the rest of its batch still commits. Item failures are
+	// passed to OnError but are not returned by Close. The default (false) rolls back the
+	// whole batch when any callback fails. Set it before the first Submit.
+	ContinueOnItemError bool
 
 	// lastErr stores the first asynchronous error seen by the writer. Protected by errMu.
 	errMu   sync.Mutex
@@ -40,14 +55,17 @@ func NewBatchWriter(db *sql.DB, bufferSize int, flushInterval time.Duration) *Ba
 		bufferSize = 10
 	}
 	ctx, cancel := context.WithCancel(context.Background())
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
 	bw := &BatchWriter{
-		buf:         make([]WriteFunc, 0, bufferSize),
-		cap:         bufferSize,
-		flushTicker: nil,
-		ctx:         ctx,
-		cancel:      cancel,
-		commitCh:    make(chan []WriteFunc, 2), // Buffer a couple of batches
-		db:          db,
+		shutdownCtx:    shutdownCtx,
+		shutdownCancel: shutdownCancel,
+		buf:            make([]WriteFunc, 0, bufferSize),
+		cap:            bufferSize,
+		flushTicker:    nil,
+		ctx:            ctx,
+		cancel:         cancel,
+		commitCh:       make(chan []WriteFunc, 2), // Buffer a couple of batches
+		db:             db,
 	}
 
 	bw.wg.Add(1)
@@ -117,44 +135,129 @@ func (bw *BatchWriter) committer() {
 			if bw.OnError != nil {
 				bw.OnError(err)
 			}
+			continue
+		}
+		if bw.OnCommit != nil {
+			bw.OnCommit()
 		}
 	}
 }
 
 func (bw *BatchWriter) executeBatch(batch []WriteFunc) error {
+	// Batches run under shutdownCtx rather than the writer's ctx, so Close (or a canceled
+	// ingestion) still lets pending batches commit; only AbortAfter interrupts them.
+	ctx := bw.shutdownCtx
+
 	// If no DB is configured (e.g. testing without DB), just run callbacks with nil tx
 	if bw.db == nil {
 		for _, w := range batch {
-			if err := w(bw.ctx, nil); err != nil {
+			if err := w(ctx, nil); err != nil {
+				if ctx.Err() != nil {
+					return fmt.Errorf("%w: %w", ErrBatchAborted, err)
+				}
+				if bw.ContinueOnItemError {
+					bw.reportItemError(err)
+					continue
+				}
 				return err
 			}
 		}
 		return nil
 	}
 
-	// Use background context for flushing to avoid "context canceled" if bw is closing.
-	ctx := context.Background()
-
 	tx, err := bw.db.BeginTx(ctx, nil)
 	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", ErrBatchAborted, err)
+		}
 		return fmt.Errorf("failed to begin batch tx: %w", err)
 	}
 	defer func() {
 		_ = tx.Rollback() // ignored if committed
 	}()
 
+	err = bw.runBatch(ctx, tx, batch)
+	if err == nil {
+		err = tx.Commit()
+		if err != nil {
+			err = fmt.Errorf("failed to commit batch (%d items): %w", len(batch), err)
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", ErrBatchAborted, err)
+	}
+	return err
+}
+
+// runBatch runs the callbacks of batch inside tx.
+func (bw *BatchWriter) runBatch(ctx context.Context, tx *sql.Tx, batch []WriteFunc) error {
 	for _, w := range batch {
+		if bw.ContinueOnItemError {
+			if err := runInSavepoint(ctx, tx, w); err != nil {
+				var itemErr *itemError
+				if !errors.As(err, &itemErr) {
+					return err
+				}
+				bw.reportItemError(itemErr.err)
+			}
+			continue
+		}
 		if err := w(ctx, tx); err != nil {
 			return err
 		}
 	}
+	return nil
+}
+
+// ErrBatchAborted is wrapped by batch errors caused by AbortAfter's grace period expiring.
+var ErrBatchAborted = errors.New("batch aborted after shutdown grace period")
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit batch (%d items): %w", len(batch), err)
+// AbortAfter bounds how long pending writes may take on a forced shutdown. Normally Close
+// waits for every queued batch to commit, however long that takes; after AbortAfter,
+// any batch still running once grace has elapsed is rolled back and later ones fail, with
+// errors wrapping ErrBatchAborted. Call it at most once, e.g. when the ingestion context
+// is canceled.
+func (bw *BatchWriter) AbortAfter(grace time.Duration) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.abortTimer == nil {
+		bw.abortTimer = time.AfterFunc(grace, bw.shutdownCancel)
+	}
+}
+
+// itemError marks a callback failure that runInSavepoint rolled back cleanly.
+type itemError struct{ err error }
+
+func (e *itemError) Error() string { return e.err.Error() }
+
+// runInSavepoint runs w inside a savepoint of tx. If w fails, only its changes are rolled
+// back and the failure is returned as an *itemError; other errors mean tx is unusable.
+func runInSavepoint(ctx context.Context, tx *sql.Tx, w WriteFunc) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT batch_item"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	if werr := w(ctx, tx); werr != nil {
+		if _, err := tx.ExecContext(ctx, "ROLLBACK TO batch_item"); err != nil {
+			return fmt.Errorf("failed to roll back item: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE batch_item"); err != nil {
+			return fmt.Errorf("failed to release savepoint: %w", err)
+		}
+		return &itemError{werr}
+	}
+	if _, err := tx.ExecContext(ctx, "RELEASE batch_item"); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
 	}
 	return nil
 }
 
+// reportItemError hands a skipped callback's error to OnError.
+func (bw *BatchWriter) reportItemError(err error) {
+	if bw.OnError != nil {
+		bw.OnError(fmt.Errorf("batch writer: skipped failed item: %w", err))
+	}
+}
+
 func (bw *BatchWriter) loop() {
 	defer bw.wg.Done()
 	for {
@@ -192,6 +295,13 @@ func (bw *BatchWriter) Close() error {
 	close(bw.commitCh) // Stop committer loop
 	bw.wg.Wait()
 
+	bw.mu.Lock()
+	if bw.abortTimer != nil {
+		bw.abortTimer.Stop()
+	}
+	bw.mu.Unlock()
+	bw.shutdownCancel()
+
 	// Return any async error that was recorded during execution
 	bw.errMu.Lock()
 	defer bw.errMu.Unlock()
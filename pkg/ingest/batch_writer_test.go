@@ -3,7 +3,9 @@ package ingest
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"path/filepath"
 	"strings"
 	"sync"
 	"testing"
@@ -204,3 +206,154 @@ func TestBatchWriterDropsBatchOnCancel(t *testing.T) {
 		t.Fatal("expected OnError to be called when batch dropped")
 	}
 }
+
+func TestBatchWriterOnCommitOnlyAfterSuccess(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, val TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	bw := NewBatchWriter(db, 1, 0)
+	var mu sync.Mutex
+	commits := 0
+	bw.OnCommit = func() {
+		mu.Lock()
+		commits++
+		mu.Unlock()
+	}
+	bw.OnError = func(error) {}
+
+	bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.Exec("INSERT INTO test (val) VALUES (?)", "ok")
+		return err
+	})
+	bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
+		return fmt.Errorf("intentional error")
+	})
+	bw.Close()
+
+	if commits != 1 {
+		t.Fatalf("expected OnCommit once (failed batch excluded), got %d", commits)
+	}
+}
+
+func TestBatchWriterContinueOnItemError(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, val TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	bw := NewBatchWriter(db, 3, 0)
+	bw.ContinueOnItemError = true
+	var mu sync.Mutex
+	var errs []error
+	bw.OnError = func(e error) {
+		mu.Lock()
+		errs = append(errs, e)
+		mu.Unlock()
+	}
+
+	insert := func(val string) WriteFunc {
+		return func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.Exec("INSERT INTO test (val) VALUES (?)", val)
+			return err
+		}
+	}
+	bw.Submit(insert("A"))
+	bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
+		// Write something, then fail: the partial write must be rolled back.
+		if _, err := tx.Exec("INSERT INTO test (val) VALUES ('partial')"); err != nil {
+			return err
+		}
+		return fmt.Errorf("boom")
+	})
+	bw.Submit(insert("C"))
+
+	if err := bw.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	rows, err := db.Query("SELECT val FROM test ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var vals []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		vals = append(vals, v)
+	}
+	if strings.Join(vals, ",") != "A,C" {
+		t.Errorf("expected A and C to persist, got %v", vals)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "boom") {
+		t.Errorf("expected the failing item reported via OnError, got %v", errs)
+	}
+}
+
+func TestBatchWriterAbortAfterGrace(t *testing.T) {
+	// A file database, since aborting may discard the connection (and an in-memory
+	// database with it).
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "abort.db"))
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE test (id INTEGER PRIMARY KEY, val TEXT)"); err != nil {
+		t.Fatalf("failed to create table: %v", err)
+	}
+
+	bw := NewBatchWriter(db, 1, 0)
+	started := make(chan struct{})
+	// A batch that would run forever unless its context is canceled.
+	if err := bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.Exec("INSERT INTO test (val) VALUES ('partial')"); err != nil {
+			return err
+		}
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}); err != nil {
+		t.Fatalf("submit failed: %v", err)
+	}
+	<-started
+
+	grace := 50 * time.Millisecond
+	start := time.Now()
+	bw.AbortAfter(grace)
+	doneCh := make(chan error, 1)
+	go func() { doneCh <- bw.Close() }()
+	select {
+	case err := <-doneCh:
+		if !errors.Is(err, ErrBatchAborted) || !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected an aborted batch error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed < grace {
+			t.Fatalf("batch aborted after %v, before the %v grace period", elapsed, grace)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not return after the grace period")
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM test").Scan(&count); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected the aborted batch to be rolled back, found %d rows", count)
+	}
+}
@@ -116,3 +116,41 @@ func BenchmarkIngestConcurrencyScaling(b *testing.B) {
 		})
 	}
 }
+
+func BenchmarkIngestQueueSize(b *testing.B) {
+	// Compare queue/result channel capacities at a fixed worker count.
+	// 0 exercises the default derived from Workers.
+	sizes := []int{0, 1, 16, 64, 256}
+	sentences := generateBenchmarkSentences(1000)
+
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("QueueSize_%d", size), func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				conn := setupBenchmarkDB(b)
+
+				sourceName := fmt.Sprintf("bench_q%d_%d", size, i)
+				sourceID, err := db.CreateOrGetSource(conn, "test", sourceName, "", "", "http://bench", "")
+				if err != nil {
+					conn.Close()
+					b.Fatalf("CreateOrGetSource failed: %v", err)
+				}
+
+				ingester := NewIngester(conn, nil)
+				ingester.Workers = 8
+				ingester.QueueSize = size
+				ingester.BatchSize = 100
+				b.StartTimer()
+
+				_, err = ingester.Ingest(context.Background(), sourceID, sentences)
+				b.StopTimer()
+				if err != nil {
+					conn.Close()
+					b.Fatalf("Ingest failed: %v", err)
+				}
+				conn.Close()
+			}
+		})
+	}
+}
@@ -2,20 +2,33 @@ package ingest
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"regexp"
+	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/japaniel/readerer/pkg/db"
 	"github.com/japaniel/readerer/pkg/dictionary"
 	"github.com/japaniel/readerer/pkg/readerer"
+	"golang.org/x/text/unicode/norm"
 )
 
 // WorkerPoolInterface abstracts the worker pool so tests can inject failing implementations.
+//
+// A pool may run and finish jobs in any order. The Ingester buffers results and writes
+// them, and checkpoints last_processed_sentence, strictly in sentence order, so progress
+// never moves backwards or past a sentence still being processed. Close must not return
+// until every submitted job has finished.
 type WorkerPoolInterface interface {
 	Start(ctx context.Context)
 	Submit(Job) error
@@ -24,30 +37,180 @@ type WorkerPoolInterface interface {
 	Close()
 }
 
+// DefinitionProvider abstracts dictionary lookups so tests can inject fakes that
+// count calls or return canned definitions. *dictionary.Importer satisfies it.
+//
+// A provider that also implements dictionary.DefinitionFormatter (as *dictionary.Importer
+// does) controls how its matches are stored; otherwise they are stored as
+// dictionary.FormatDefinitions JSON.
+type DefinitionProvider interface {
+	Lookup(word, lemma, pronunciation string) ([]dictionary.JMdictEntry, error)
+}
+
 // Ingester handles the ingestion of sentences into the database.
 type Ingester struct {
 	DB           *sql.DB
-	DictImporter *dictionary.Importer
+	DictImporter DefinitionProvider
 	BatchSize    int
 	// Logger is used for informational messages (e.g. resume status). nil means no logging.
 	Logger *log.Logger
 	// OnProgress is called periodically with the number of processed sentences and total sentences.
+	// It fires when sentences are handed to the batch writer, so it may run ahead of durable state.
 	OnProgress func(current, total int)
+	// OnCommitted is called with the highest sentence index whose writes (and progress checkpoint)
+	// have been durably committed. Unlike OnProgress it never overstates what a resume would skip.
+	// It runs on the batch writer's commit goroutine, so it should return quickly.
+	OnCommitted func(index int)
+
+	// CachedDefinitionsOnly makes the Ingester reuse definitions (and readings) already stored
+	// in the words table from prior runs instead of consulting DictImporter. Words without
+	// cached definitions are stored without them. Useful for reproducible offline runs.
+	CachedDefinitionsOnly bool
+
+	// CanonicalizeKana stores words that appear only in kana (e.g. ねこ) under their kanji
+	// headword (猫) when the dictionary has exactly one confident match, keeping the kana
+	// as the reading. See dictionary.KanjiHeadword for the exact rules.
+	CanonicalizeKana bool
+
+	// Force makes IngestContent ingest even when the content hash matches the last run
+	// (replacing that run's counts rather than adding to them), and makes Ingest start over instead of failing with ErrResumeMismatch when saved
+	// progress belongs to a sentence list of a different length.
+	Force bool
+
+	// KeepNumbers keeps number tokens: those tagged 数 by the tokenizer (including kanji
+	// numerals) or made only of digits and punctuation, such as "5" in "5時" or "3.5".
+	// Counters that follow a number (時, 人) are ordinary words and always kept.
+	KeepNumbers bool
+	// KeepAlphanumeric keeps tokens written in Latin letters, optionally mixed with digits,
+	// such as "COVID", "iPhone" or "5G". Full-width letters count as Latin. A token that
+	// mixes Latin text with Japanese is an ordinary word and always kept. Tokens of only
+	// ASCII punctuation and spaces are always dropped.
+	KeepAlphanumeric bool
+
+	// MaxSentencesPerSource caps how many distinct sentence rows a source may create.
+	// Beyond it, words are still linked and counted but without context or example
+	// sentences. 0 means no limit; negative values are rejected.
+	MaxSentencesPerSource int
+
+	// SkipSentences links words to the source with occurrence counts only, storing no
+	// sentences, contexts or examples. It keeps frequency-only databases small; sources
+	// ingested this way cannot be rebuilt with db.ReconstructSource.
+	SkipSentences bool
+
+	// RequireDefinitions reports words the dictionary (or, with CachedDefinitionsOnly, the
+	// cache) cannot define. They are still stored; once the run completes Ingest returns a
+	// *MissingDefinitionsError listing them. Requires DictImporter or CachedDefinitionsOnly.
+	RequireDefinitions bool
+	// AbortOnMissingDefinition makes RequireDefinitions stop the run at the first sentence
+	// with an undefined word instead of collecting them. Sentences still in flight are not
+	// written.
+	AbortOnMissingDefinition bool
+	// UnmatchedWriter, if set, receives each word the dictionary (or, with
+	// CachedDefinitionsOnly, the cache) cannot define, one per line and once per run, for
+	// manual review of likely OCR or segmentation errors. The words are still stored.
+	// Requires DictImporter or CachedDefinitionsOnly.
+	UnmatchedWriter io.Writer
+
+	// BoilerplateRepeats makes Ingest treat a sentence whose exact text occurs at least
+	// this many times in the document (a repeated byline, share prompt or caption) as
+	// boilerplate: its words are counted at its first occurrence only, and later repeats
+	// link no words, so they don't inflate frequencies. 0 disables it; negative values are
+	// rejected. IngestStream cannot count repeats in advance and rejects it.
+	BoilerplateRepeats int
+
+	// Formatter turns matched dictionary entries into the stored definitions string, e.g.
+	// dictionary.PlainTextFormatter for human-readable text. nil uses DictImporter's own
+	// formatter if it has one (as *dictionary.Importer does), else JSON.
+	Formatter dictionary.DefinitionFormatter
+
+	// ReadingStyle controls the script of stored pronunciations. The zero value means
+	// ReadingHiragana.
+	ReadingStyle ReadingStyle
 
 	// Concurrency settings
 	Workers int
+	// QueueSize is the capacity of both the worker pool's job queue and the result channel.
+	// 0 derives it from Workers (Workers*2). Raise it on many-core machines so fast workers
+	// are not starved waiting on the ordered consumer. Negative values are rejected.
+	QueueSize int
+
+	// ShutdownGrace bounds how long pending database writes may keep running once ctx is
+	// canceled (see BatchWriter.AbortAfter); writes still running after it are rolled back.
+	// 0 waits for them to finish, however long that takes.
+	ShutdownGrace time.Duration
 
 	// PoolFactory allows tests to inject custom worker pool implementations.
 	PoolFactory func(workers, queue int) WorkerPoolInterface
 }
 
-// NewIngester creates a new Ingester.
-func NewIngester(conn *sql.DB, dict *dictionary.Importer) *Ingester {
+// ReadingStyle selects how stored pronunciations are written.
+type ReadingStyle string
+
+const (
+	// ReadingHiragana converts readings to hiragana (the default).
+	ReadingHiragana ReadingStyle = "hiragana"
+	// ReadingKatakana converts readings to katakana, as many dictionaries print them.
+	ReadingKatakana ReadingStyle = "katakana"
+	// ReadingAsIs stores readings exactly as the tokenizer or dictionary provides them.
+	ReadingAsIs ReadingStyle = "as-is"
+)
+
+// validate reports an error for unknown styles; the empty style is allowed.
+func (rs ReadingStyle) validate() error {
+	switch rs {
+	case "", ReadingHiragana, ReadingKatakana, ReadingAsIs:
+		return nil
+	}
+	return fmt.Errorf("unknown ReadingStyle %q (want %q, %q or %q)", string(rs), ReadingHiragana, ReadingKatakana, ReadingAsIs)
+}
+
+// apply converts reading to the style.
+func (rs ReadingStyle) apply(reading string) string {
+	switch rs {
+	case ReadingKatakana:
+		return dictionary.ToKatakana(reading)
+	case ReadingAsIs:
+		return reading
+	default:
+		return dictionary.ToHiragana(reading)
+	}
+}
+
+// MaxDefaultWorkers caps the worker count NewIngester derives from the CPU count. Beyond
+// this the single ordered consumer and SQLite writer are the bottleneck anyway.
+const MaxDefaultWorkers = 16
+
+// defaultWorkers returns runtime.NumCPU() clamped to [1, MaxDefaultWorkers].
+func defaultWorkers() int {
+	n := runtime.NumCPU()
+	if n < 1 {
+		return 1
+	}
+	if n > MaxDefaultWorkers {
+		return MaxDefaultWorkers
+	}
+	return n
+}
+
+// formatDefinitions formats matches with the Ingester's Formatter, else the provider's
+// formatter, if it has one.
+func (ig *Ingester) formatDefinitions(matches []dictionary.JMdictEntry) (string, error) {
+	if ig.Formatter != nil {
+		return ig.Formatter.Format(matches)
+	}
+	if f, ok := ig.DictImporter.(dictionary.DefinitionFormatter); ok {
+		return f.Format(matches)
+	}
+	return dictionary.FormatDefinitions(matches)
+}
+
+// NewIngester creates a new Ingester. dict may be nil to ingest without definitions.
+func NewIngester(conn *sql.DB, dict DefinitionProvider) *Ingester {
 	return &Ingester{
 		DB:           conn,
 		DictImporter: dict,
 		BatchSize:    50,
-		Workers:      4, // Default worker count
+		Workers:      defaultWorkers(),
 	}
 }
 
@@ -57,6 +220,11 @@ type wordData struct {
 	Reading     string
 	Definitions string
 	Count       int
+	// ExampleScore rates the enclosing sentence as an example for Word (see readerer.ScoreSentence).
+	// The consumer replaces it with the score of Example.
+	ExampleScore int
+	// Example is the best-scoring sentence seen so far for Word in this run; set by the consumer.
+	Example string
 }
 
 // processedSentence holds the result of processing a sentence before DB ingestion
@@ -64,12 +232,174 @@ type processedSentence struct {
 	Index    int
 	Sentence string
 	Words    []wordData
-	Error    error
+	// Missing lists the words without definitions when RequireDefinitions or UnmatchedWriter is set.
+	Missing []string
+	Error   error
+}
+
+// ErrMissingDefinitions is wrapped by MissingDefinitionsError.
+var ErrMissingDefinitions = errors.New("words without dictionary definitions")
+
+// MissingDefinitionsError is returned when RequireDefinitions is set and some words could
+// not be defined. Words are listed once each, in order of first appearance.
+type MissingDefinitionsError struct {
+	Words []string
+}
+
+func (e *MissingDefinitionsError) Error() string {
+	return fmt.Sprintf("%d %s: %s", len(e.Words), ErrMissingDefinitions, strings.Join(e.Words, ", "))
 }
 
+func (e *MissingDefinitionsError) Unwrap() error { return ErrMissingDefinitions }
+
 // Ingest processes sentences and saves them to the database using concurrent workers and batched writes.
 // It supports resuming from the last checkpoint using the sourceID.
 func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []readerer.Sentence) (int, error) {
+	if ig.BoilerplateRepeats < 0 {
+		return 0, fmt.Errorf("BoilerplateRepeats must not be negative, got %d", ig.BoilerplateRepeats)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src := make(chan readerer.Sentence)
+	go func() {
+		defer close(src)
+		for _, s := range sentences {
+			select {
+			case src <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ig.ingest(ctx, sourceID, src, len(sentences), boilerplateRepeats(sentences, ig.BoilerplateRepeats))
+}
+
+// boilerplateRepeats returns the indexes of sentences that repeat, after its first
+// occurrence, a text appearing at least threshold times. threshold 0 finds none.
+func boilerplateRepeats(sentences []readerer.Sentence, threshold int) map[int]bool {
+	if threshold <= 0 {
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, s := range sentences {
+		counts[strings.TrimSpace(s.Text)]++
+	}
+	repeats := make(map[int]bool)
+	seen := make(map[string]bool)
+	for i, s := range sentences {
+		text := strings.TrimSpace(s.Text)
+		if counts[text] < threshold {
+			continue
+		}
+		if seen[text] {
+			repeats[i] = true
+		}
+		seen[text] = true
+	}
+	return repeats
+}
+
+// ErrResumeMismatch is returned (wrapped) when a source has saved progress but the
+// sentence list given to Ingest has a different length from the one the progress was
+// recorded against, so resuming would skip or repeat the wrong sentences.
+var ErrResumeMismatch = errors.New("sentence list changed since the interrupted run")
+
+// ErrContentUnchanged is returned by IngestContent when the source's content is identical
+// to what was last ingested for it.
+var ErrContentUnchanged = errors.New("content unchanged since last ingestion")
+
+// ContentHash returns the hex SHA-256 of a document's text, used to detect re-runs on
+// identical content.
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// IngestContent is Ingest for a document whose full text is known. It skips the run with
+// ErrContentUnchanged when text hashes the same as the last completed ingestion of the
+// source, even if progress was reset, unless Force is set. When the text has changed since
+// a completed run, or Force re-ingests unchanged text, the source's earlier ingestion is
+// undone first (see resetSource) so old checkpoints don't skip sentences and counts are
+// not added twice.
+// The hash is recorded only after ingestion succeeds.
+func (ig *Ingester) IngestContent(ctx context.Context, sourceID int64, text string, sentences []readerer.Sentence) (int, error) {
+	hash := ContentHash(text)
+	prev, err := db.GetSourceContentHash(ig.DB, sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read content hash: %w", err)
+	}
+	if prev == hash && !ig.Force {
+		return 0, ErrContentUnchanged
+	}
+	if prev != "" {
+		if err := ig.resetSource(sourceID); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := ig.Ingest(ctx, sourceID, sentences)
+	if err != nil {
+		return n, err
+	}
+	if err := db.SetSourceContentHash(ig.DB, sourceID, hash); err != nil {
+		return n, fmt.Errorf("failed to record content hash: %w", err)
+	}
+	return n, nil
+}
+
+// resetSource removes the source's progress, sentence order and word links in one
+// transaction, so the next run starts over with counts from zero.
+func (ig *Ingester) resetSource(sourceID int64) error {
+	tx, err := ig.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := db.ResetSourceIngestion(tx, sourceID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// IngestStream is like Ingest but consumes sentences from src as they are produced, so the
+// whole document never has to be held in memory. Sentences are indexed in arrival order,
+// so resuming requires src to replay the same sentences from the start; already-checkpointed
+// ones are skipped. Because the total is unknown up front, OnProgress receives -1 as total
+// until the stream ends. The caller must close src.
+func (ig *Ingester) IngestStream(ctx context.Context, sourceID int64, src <-chan readerer.Sentence) (int, error) {
+	if ig.BoilerplateRepeats != 0 {
+		return 0, fmt.Errorf("BoilerplateRepeats is not supported by IngestStream")
+	}
+	return ig.ingest(ctx, sourceID, src, -1, nil)
+}
+
+// ingest is the shared pipeline behind Ingest and IngestStream. totalSentences is -1 when
+// unknown. Sentences whose index is in repeats are written without words.
+func (ig *Ingester) ingest(ctx context.Context, sourceID int64, src <-chan readerer.Sentence, totalSentences int, repeats map[int]bool) (int, error) {
+	queueSize, err := ig.queueSize()
+	if err != nil {
+		return 0, err
+	}
+	if err := ig.ReadingStyle.validate(); err != nil {
+		return 0, err
+	}
+	if ig.MaxSentencesPerSource < 0 {
+		return 0, fmt.Errorf("MaxSentencesPerSource must not be negative, got %d", ig.MaxSentencesPerSource)
+	}
+	if ig.RequireDefinitions && ig.DictImporter == nil && !ig.CachedDefinitionsOnly {
+		return 0, fmt.Errorf("RequireDefinitions needs a DictImporter or CachedDefinitionsOnly")
+	}
+	if ig.UnmatchedWriter != nil && ig.DictImporter == nil && !ig.CachedDefinitionsOnly {
+		return 0, fmt.Errorf("UnmatchedWriter needs a DictImporter or CachedDefinitionsOnly")
+	}
+
+	// Words are stored under their source's language.
+	language, err := db.GetSourceLanguage(ig.DB, sourceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read source language: %w", err)
+	}
+
 	// Check progress
 	lastProcessed, err := db.GetSourceProgress(ig.DB, sourceID)
 	if err != nil {
@@ -79,6 +409,30 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 		lastProcessed = -1
 	}
 
+	// A checkpoint only makes sense for the sentence list it was taken on; if the document
+	// now splits into a different number of sentences, the saved index points elsewhere.
+	if lastProcessed >= 0 && totalSentences >= 0 {
+		prevTotal, err := db.GetSourceTotalSentences(ig.DB, sourceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read sentence total: %w", err)
+		}
+		if prevTotal >= 0 && prevTotal != totalSentences {
+			if !ig.Force {
+				return 0, fmt.Errorf("%w: saved progress is at sentence %d of %d, but the document now has %d sentences (set Force to start over)",
+					ErrResumeMismatch, lastProcessed+1, prevTotal, totalSentences)
+			}
+			if ig.Logger != nil {
+				ig.Logger.Printf("Sentence count changed from %d to %d; discarding saved progress and starting over\n", prevTotal, totalSentences)
+			}
+			// The counts of the sentences already ingested are dropped too, or the
+			// restart would add them a second time.
+			if err := ig.resetSource(sourceID); err != nil {
+				return 0, err
+			}
+			lastProcessed = -1
+		}
+	}
+
 	if lastProcessed >= 0 {
 		if ig.Logger != nil {
 			ig.Logger.Printf("Resuming from sentence index %d (skipping %d messages)\n", lastProcessed+1, lastProcessed+1)
@@ -87,20 +441,25 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 		// Just starting or no progress found
 	}
 
-	totalSentences := len(sentences)
+	if totalSentences >= 0 {
+		if err := db.SetSourceTotalSentences(ig.DB, sourceID, totalSentences); err != nil {
+			return 0, fmt.Errorf("failed to record sentence total: %w", err)
+		}
+	}
+
 	startIdx := lastProcessed + 1
-	if startIdx >= totalSentences {
+	if totalSentences >= 0 && startIdx >= totalSentences {
 		return 0, nil // Nothing to do
 	}
 
 	// 1. Setup concurrency components
 	var wp WorkerPoolInterface
 	if ig.PoolFactory != nil {
-		wp = ig.PoolFactory(ig.Workers, ig.Workers*2)
+		wp = ig.PoolFactory(ig.Workers, queueSize)
 	} else {
-		wp = NewWorkerPool(ig.Workers, ig.Workers*2)
+		wp = NewWorkerPool(ig.Workers, queueSize)
 	}
-	resultCh := make(chan processedSentence, ig.Workers*2)
+	resultCh := make(chan processedSentence, queueSize)
 	closedResultCh := false
 
 	// We use a separate channel to communicate final done/error state
@@ -123,6 +482,123 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 		batchErrMu.Unlock()
 	}
 
+	// committedIdx is the index of the last sentence written by the batch currently being
+	// committed. Write callbacks and OnCommit both run on the committer goroutine, so it needs
+	// no locking.
+	committedIdx := -1
+	bw.OnCommit = func() {
+		if ig.OnCommitted != nil && committedIdx >= 0 {
+			ig.OnCommitted(committedIdx)
+		}
+	}
+
+	// bestExamples tracks the highest-scoring sentence per word for this source. It is only
+	// touched by the ordered consumer, so ties resolve to the earliest sentence.
+	type scoredExample struct {
+		text  string
+		score int
+	}
+	bestExamples := make(map[string]scoredExample)
+
+	// missing collects undefined words for RequireDefinitions; like bestExamples it is only
+	// touched by the ordered consumer, which also writes them to UnmatchedWriter.
+	var missing []string
+	seenMissing := make(map[string]bool)
+	var unmatchedErr error
+
+	// writeSentence builds the DB write job for a processed sentence. It must be called in
+	// sentence order so the example selection is deterministic.
+	writeSentence := func(item processedSentence) WriteFunc {
+		if repeats[item.Index] {
+			item.Words, item.Missing = nil, nil
+		}
+		for _, word := range item.Missing {
+			if seenMissing[word] {
+				continue
+			}
+			seenMissing[word] = true
+			if ig.RequireDefinitions {
+				missing = append(missing, word)
+			}
+			if ig.UnmatchedWriter != nil && unmatchedErr == nil {
+				_, unmatchedErr = fmt.Fprintln(ig.UnmatchedWriter, word)
+			}
+		}
+		for i, w := range item.Words {
+			best, ok := bestExamples[w.Word]
+			if !ok || w.ExampleScore > best.score {
+				best = scoredExample{text: item.Sentence, score: w.ExampleScore}
+				bestExamples[w.Word] = best
+			}
+			item.Words[i].Example = best.text
+			item.Words[i].ExampleScore = best.score
+		}
+		return func(ctx context.Context, tx *sql.Tx) error {
+			// Sentences over the per-source cap, or all of them with SkipSentences, are
+			// linked without context or example.
+			ok := false
+			if !ig.SkipSentences {
+				var err error
+				if ok, err = db.RecordSourceSentence(tx, sourceID, item.Sentence, item.Index, ig.MaxSentencesPerSource); err != nil {
+					return fmt.Errorf("failed to record sentence: %w", err)
+				}
+			}
+			contextText := ""
+			if ok {
+				contextText = item.Sentence
+			}
+			// Examples come from earlier sentences; only reuse those stored for this source.
+			stored := map[string]bool{item.Sentence: ok}
+			storedExample := func(text string) (string, error) {
+				if ig.SkipSentences {
+					return "", nil
+				}
+				ok, seen := stored[text]
+				if !seen {
+					var err error
+					if ok, err = db.SourceHasSentence(tx, sourceID, text); err != nil {
+						return "", fmt.Errorf("failed to check example sentence: %w", err)
+					}
+					stored[text] = ok
+				}
+				if !ok {
+					return "", nil
+				}
+				return text, nil
+			}
+			for _, w := range item.Words {
+				wordID, err := db.CreateOrGetWord(tx, w.Word, w.Word, w.Reading, w.Definitions, language)
+				if err != nil {
+					return fmt.Errorf("failed to persist word %s: %w", w.Word, err)
+				}
+				example, err := storedExample(w.Example)
+				if err != nil {
+					return err
+				}
+				// An earlier run may have stored a better example; only replace a worse one.
+				if example != "" {
+					prev, err := db.GetWordSourceExample(tx, wordID, sourceID)
+					if err != nil {
+						return fmt.Errorf("failed to read example for word %d: %w", wordID, err)
+					}
+					if prev != "" && readerer.ScoreSentence(prev, w.Word) >= w.ExampleScore {
+						example = ""
+					}
+				}
+				if err := db.LinkWordToSource(tx, wordID, sourceID, contextText, example, w.Count); err != nil {
+					return fmt.Errorf("failed to link word %d: %w", wordID, err)
+				}
+				atomic.AddInt64(&totalLinks, int64(w.Count))
+			}
+			// Checkpoint progress for this sentence
+			if err := db.UpdateSourceProgress(tx, sourceID, item.Index); err != nil {
+				return fmt.Errorf("failed to save progress: %w", err)
+			}
+			committedIdx = item.Index
+			return nil
+		}
+	}
+
 	// Ensure resources are cleaned up on any return path: stop workers, close resultCh, flush batches.
 	defer func() {
 		// Close the worker pool and other resources on exit.
@@ -134,9 +610,24 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 		_ = bw.Close()
 	}()
 
+	// shutdown is the caller's context; ctx below is also canceled by the run's own errors.
+	shutdown := ctx
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	if ig.ShutdownGrace > 0 {
+		finished := make(chan struct{})
+		// Deferred after cancel, so it runs first: a finished run never arms the abort.
+		defer close(finished)
+		go func() {
+			select {
+			case <-shutdown.Done():
+				bw.AbortAfter(ig.ShutdownGrace)
+			case <-finished:
+			}
+		}()
+	}
+
 	wp.Start(ctx)
 
 	go func() {
@@ -162,24 +653,7 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 					}
 					delete(buffer, nextIdx)
 
-					currentItem := item
-					err := bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
-						for _, w := range currentItem.Words {
-							wordID, err := db.CreateOrGetWord(tx, w.Word, w.Word, w.Reading, w.Definitions, "ja")
-							if err != nil {
-								return fmt.Errorf("failed to persist word %s: %w", w.Word, err)
-							}
-							if err := db.LinkWordToSource(tx, wordID, sourceID, currentItem.Sentence, currentItem.Sentence, w.Count); err != nil {
-								return fmt.Errorf("failed to link word %d: %w", wordID, err)
-							}
-							atomic.AddInt64(&totalLinks, int64(w.Count))
-						}
-						if err := db.UpdateSourceProgress(tx, sourceID, currentItem.Index); err != nil {
-							return fmt.Errorf("failed to save progress: %w", err)
-						}
-						return nil
-					})
-
+					err := bw.Submit(writeSentence(item))
 					if err != nil {
 						// Signal producers to stop to prevent them from blocking on resultCh.
 						cancel()
@@ -193,7 +667,11 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 				}
 
 				if ig.OnProgress != nil {
-					ig.OnProgress(totalSentences, totalSentences)
+					final := totalSentences
+					if final < 0 {
+						final = nextIdx
+					}
+					ig.OnProgress(final, final)
 				}
 				doneCh <- nil
 				return
@@ -217,26 +695,7 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 				delete(buffer, nextIdx)
 
 				// Submit DB write job to BatchWriter
-				// Isolate loop variable
-				currentItem := item
-				err := bw.Submit(func(ctx context.Context, tx *sql.Tx) error {
-					for _, w := range currentItem.Words {
-						wordID, err := db.CreateOrGetWord(tx, w.Word, w.Word, w.Reading, w.Definitions, "ja")
-						if err != nil {
-							return fmt.Errorf("failed to persist word %s: %w", w.Word, err)
-						}
-						if err := db.LinkWordToSource(tx, wordID, sourceID, currentItem.Sentence, currentItem.Sentence, w.Count); err != nil {
-							return fmt.Errorf("failed to link word %d: %w", wordID, err)
-						}
-						atomic.AddInt64(&totalLinks, int64(w.Count))
-					}
-					// Checkpoint progress for this sentence
-					if err := db.UpdateSourceProgress(tx, sourceID, currentItem.Index); err != nil {
-						return fmt.Errorf("failed to save progress: %w", err)
-					}
-					return nil
-				})
-
+				err := bw.Submit(writeSentence(item))
 				if err != nil {
 					// Signal producers to stop to prevent them from blocking on resultCh.
 					cancel()
@@ -254,24 +713,31 @@ func (ig *Ingester) Ingest(ctx context.Context, sourceID int64, sentences []read
 	}()
 
 	// 3. Producer loop: Submit tokenization jobs
-	// The original regex was compiled once
-	asciiRegex := regexp.MustCompile(`^[a-zA-Z0-9\s[:punct:]]+$`)
 
+	nextSentence := 0
 Loop:
-	for i := startIdx; i < totalSentences; i++ {
+	for {
+		var sent readerer.Sentence
+		var ok bool
 		// handle early exit if consumer failed
 		select {
 		case <-ctx.Done():
 			break Loop
-		default:
+		case sent, ok = <-src:
+		}
+		if !ok {
+			break Loop
 		}
 
-		idx := i
-		sent := sentences[i]
+		idx := nextSentence
+		nextSentence++
+		if idx < startIdx {
+			continue // already checkpointed
+		}
 
 		job := func(ctx context.Context) error {
 			// CPU-bound work: Analyze sentence and prepare data
-			res := ig.processSentence(idx, sent, asciiRegex)
+			res := ig.processSentence(idx, sent, language)
 			fmt.Println("job: processed", idx)
 
 			// Attempt to send result; the channel may be closed if cancellation occurred,
@@ -328,13 +794,84 @@ Loop:
 	}
 	batchErrMu.Unlock()
 
+	// A stream's length is only known once it has been fully read.
+	if totalSentences < 0 && consumerErr == nil {
+		if err := db.SetSourceTotalSentences(ig.DB, sourceID, nextSentence); err != nil {
+			consumerErr = fmt.Errorf("failed to record sentence total: %w", err)
+		}
+	}
+
+	// The consumer has exited (doneCh was received), so missing is safe to read.
+	if consumerErr == nil && unmatchedErr != nil {
+		consumerErr = fmt.Errorf("failed to write unmatched words: %w", unmatchedErr)
+	}
+	if consumerErr == nil && len(missing) > 0 {
+		consumerErr = &MissingDefinitionsError{Words: missing}
+	}
+
 	// Return the accumulated number of linked word occurrences recorded during ingestion.
 	// `totalLinks` is updated atomically by DB write callbacks.
 	return int(atomic.LoadInt64(&totalLinks)), consumerErr
 }
 
-// processSentence performs the CPU-heavy token analysis and dictionary lookup
-func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, asciiRegex *regexp.Regexp) processedSentence {
+// queueSize returns the configured QueueSize, defaulting to twice the worker count.
+func (ig *Ingester) queueSize() (int, error) {
+	if ig.QueueSize < 0 {
+		return 0, fmt.Errorf("QueueSize must be positive, got %d", ig.QueueSize)
+	}
+	if ig.QueueSize > 0 {
+		return ig.QueueSize, nil
+	}
+	workers := ig.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	return workers * 2, nil
+}
+
+// tokenClass is how processSentence's number and Latin-text filters see a token.
+type tokenClass int
+
+const (
+	tokenWord tokenClass = iota
+	tokenNumber
+	tokenAlphanumeric
+	tokenSymbol
+)
+
+// classifyToken decides whether t is a number, Latin text, bare punctuation or an ordinary
+// word. The surface is NFKC-folded first so full-width "ＣＯＶＩＤ" and "５" behave like
+// their ASCII forms.
+func classifyToken(t readerer.Token) tokenClass {
+	var hasLetter, hasDigit bool
+	for _, r := range norm.NFKC.String(t.Surface) {
+		switch {
+		case r >= utf8.RuneSelf:
+			// Any non-ASCII character makes this Japanese (or mixed) text; only the
+			// tokenizer's number tag can still mark it as a number.
+			if len(t.PartsOfSpeech) > 1 && t.PartsOfSpeech[1] == "数" {
+				return tokenNumber
+			}
+			return tokenWord
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	switch {
+	case hasLetter:
+		return tokenAlphanumeric
+	case hasDigit:
+		return tokenNumber
+	default:
+		return tokenSymbol
+	}
+}
+
+// processSentence performs the CPU-heavy token analysis and dictionary lookup. language
+// is the source's, used to find definitions cached under it.
+func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, language string) processedSentence {
 	cleanSentence := sentence.Text
 	wordCounts := make(map[string]int)
 	wordReadings := make(map[string]string)
@@ -345,11 +882,17 @@ func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, ascii
 		if t.PrimaryPOS == "記号" || t.PrimaryPOS == "補助記号" || t.PrimaryPOS == "助詞" || t.PrimaryPOS == "助動詞" {
 			continue
 		}
-		if len(t.PartsOfSpeech) > 1 && t.PartsOfSpeech[1] == "数" {
-			continue
-		}
-		if asciiRegex.MatchString(t.Surface) {
+		switch classifyToken(t) {
+		case tokenSymbol:
 			continue
+		case tokenNumber:
+			if !ig.KeepNumbers {
+				continue
+			}
+		case tokenAlphanumeric:
+			if !ig.KeepAlphanumeric {
+				continue
+			}
 		}
 
 		// Normalization: Use BaseForm (Lemma) as the canonical word if available
@@ -360,11 +903,11 @@ func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, ascii
 
 		if _, exists := wordCounts[wordToSave]; !exists {
 			wordCounts[wordToSave] = 0
-			wordReadings[wordToSave] = dictionary.ToHiragana(t.Reading)
+			wordReadings[wordToSave] = t.Reading
 			orderedWords = append(orderedWords, wordToSave)
 		} else {
 			currentReading := wordReadings[wordToSave]
-			newReading := dictionary.ToHiragana(t.Reading)
+			newReading := t.Reading
 			if currentReading == "" && newReading != "" {
 				wordReadings[wordToSave] = newReading
 			}
@@ -373,19 +916,37 @@ func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, ascii
 	}
 
 	var words []wordData
+	var missing []string
 	for _, wordToSave := range orderedWords {
 		count := wordCounts[wordToSave]
 		definitions := ""
 		readingToSave := wordReadings[wordToSave]
 
-		if ig.DictImporter != nil {
+		if ig.CachedDefinitionsOnly {
+			if cached, err := db.GetWord(ig.DB, wordToSave, wordToSave, language); err == nil {
+				definitions = cached.Definitions
+				if cached.Pronunciation != "" {
+					readingToSave = cached.Pronunciation
+				}
+			}
+		} else if ig.DictImporter != nil {
 			matches, _ := ig.DictImporter.Lookup(wordToSave, wordToSave, "")
+			canonical := false
+			if ig.CanonicalizeKana {
+				if headword, entry, ok := dictionary.KanjiHeadword(wordToSave, matches); ok {
+					// The kana surface is exactly how the word is read.
+					readingToSave = wordToSave
+					wordToSave = headword
+					matches = []dictionary.JMdictEntry{entry}
+					canonical = true
+				}
+			}
 			if len(matches) > 0 {
-				if d, err := dictionary.FormatDefinitions(matches); err == nil {
+				if d, err := ig.formatDefinitions(matches); err == nil {
 					definitions = d
 				}
 				// Use the dictionary's primary reading for this Lemma.
-				if len(matches[0].Kana) > 0 {
+				if !canonical && len(matches[0].Kana) > 0 {
 					foundReading := ""
 					for _, k := range matches[0].Kana {
 						if k.Common {
@@ -396,21 +957,30 @@ func (ig *Ingester) processSentence(index int, sentence readerer.Sentence, ascii
 					if foundReading == "" {
 						foundReading = matches[0].Kana[0].Text
 					}
-					readingToSave = dictionary.ToHiragana(foundReading)
+					readingToSave = foundReading
 				}
 			}
 		}
+		if (ig.RequireDefinitions || ig.UnmatchedWriter != nil) && definitions == "" {
+			missing = append(missing, wordToSave)
+		}
 		words = append(words, wordData{
-			Word:        wordToSave,
-			Reading:     readingToSave,
-			Definitions: definitions,
-			Count:       count,
+			Word:         wordToSave,
+			Reading:      ig.ReadingStyle.apply(readingToSave),
+			Definitions:  definitions,
+			Count:        count,
+			ExampleScore: readerer.ScoreSentence(cleanSentence, wordToSave),
 		})
 	}
 
-	return processedSentence{
+	res := processedSentence{
 		Index:    index,
 		Sentence: cleanSentence,
 		Words:    words,
+		Missing:  missing,
+	}
+	if len(missing) > 0 && ig.RequireDefinitions && ig.AbortOnMissingDefinition {
+		res.Error = fmt.Errorf("sentence %d: %w", index, &MissingDefinitionsError{Words: missing})
 	}
+	return res
 }
@@ -0,0 +1,149 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/readerer"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// reversingPool holds submitted jobs until it has a group of them, then runs the group
+// last-submitted first, so results reach the Ingester out of sentence order. Close runs
+// any partial group and waits for every job.
+type reversingPool struct {
+	group int
+	ctx   context.Context
+	wg    sync.WaitGroup
+
+	mu      sync.Mutex
+	pending []Job
+	next    int   // submission number of the next job
+	ran     []int // submission numbers in the order the jobs ran
+	seqs    []int // submission numbers of pending
+}
+
+func (p *reversingPool) Start(ctx context.Context) { p.ctx = ctx }
+
+func (p *reversingPool) Submit(job Job) error { return p.SubmitCtx(p.ctx, job) }
+
+func (p *reversingPool) SubmitCtx(ctx context.Context, job Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, job)
+	p.seqs = append(p.seqs, p.next)
+	p.next++
+	if len(p.pending) == p.group {
+		p.flushLocked()
+	}
+	return nil
+}
+
+// flushLocked runs the pending group in reverse on its own goroutine.
+func (p *reversingPool) flushLocked() {
+	jobs, seqs := p.pending, p.seqs
+	p.pending, p.seqs = nil, nil
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		for i := len(jobs) - 1; i >= 0; i-- {
+			p.mu.Lock()
+			p.ran = append(p.ran, seqs[i])
+			p.mu.Unlock()
+			_ = jobs[i](p.ctx)
+		}
+	}()
+}
+
+func (p *reversingPool) Close() {
+	p.mu.Lock()
+	if len(p.pending) > 0 {
+		p.flushLocked()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// TestIngestWritesInSentenceOrder pins down the Ingester's ordering contract: however
+// out of order the pool completes jobs, sentences are written and checkpointed strictly in
+// sentence order, so last_processed_sentence only ever moves forward and ends on the last
+// sentence.
+func TestIngestWritesInSentenceOrder(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "OutOfOrder", "", "", "http://out-of-order", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 23 // not a multiple of the group size, so Close flushes a partial group
+	sentences := make([]readerer.Sentence, n)
+	texts := make([]string, n)
+	for i := range sentences {
+		texts[i] = fmt.Sprintf("文%02d。", i)
+		sentences[i] = readerer.Sentence{
+			Text:   texts[i],
+			Tokens: []readerer.Token{{Surface: "文", BaseForm: "文", Reading: "ブン", PrimaryPOS: "名詞"}},
+		}
+	}
+
+	pool := &reversingPool{group: 5}
+	ingester := NewIngester(conn, nil)
+	ingester.BatchSize = 3
+	ingester.PoolFactory = func(workers, queue int) WorkerPoolInterface { return pool }
+
+	var committed []int
+	ingester.OnCommitted = func(index int) {
+		progress, err := db.GetSourceProgress(conn, sourceID)
+		if err != nil {
+			t.Errorf("read progress: %v", err)
+			return
+		}
+		if progress != index {
+			t.Errorf("OnCommitted(%d) but stored progress is %d", index, progress)
+		}
+		committed = append(committed, index)
+	}
+
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	if sort.IntsAreSorted(pool.ran) {
+		t.Fatalf("expected the pool to run jobs out of order, got %v", pool.ran)
+	}
+	if len(pool.ran) != n {
+		t.Fatalf("expected %d jobs to run, got %d", n, len(pool.ran))
+	}
+	if len(committed) == 0 {
+		t.Fatal("expected OnCommitted to be called")
+	}
+	for i := 1; i < len(committed); i++ {
+		if committed[i] <= committed[i-1] {
+			t.Fatalf("committed progress went backwards: %v", committed)
+		}
+	}
+	if last := committed[len(committed)-1]; last != n-1 {
+		t.Errorf("expected final committed index %d, got %d", n-1, last)
+	}
+	if progress, err := db.GetSourceProgress(conn, sourceID); err != nil || progress != n-1 {
+		t.Errorf("expected last_processed_sentence %d, got %d (%v)", n-1, progress, err)
+	}
+	// Every sentence was recorded at its own position.
+	got, err := db.ReconstructSource(conn, sourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(texts, "\n"); got != want {
+		t.Errorf("ReconstructSource = %q, want %q", got, want)
+	}
+}
@@ -3,10 +3,16 @@ package ingest
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/japaniel/readerer/pkg/db"
+	"github.com/japaniel/readerer/pkg/dictionary"
 	"github.com/japaniel/readerer/pkg/readerer"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -61,6 +67,101 @@ func TestIngestResume(t *testing.T) {
 	if count != 5 {
 		t.Errorf("Expected 5 linked items, got %d", count)
 	}
+	if pct, err := db.GetSourceProgressPercent(conn, sourceID); err != nil || pct != 100 {
+		t.Errorf("expected 100%% progress, got %v (%v)", pct, err)
+	}
+}
+
+func TestIngestResumeWithChangedSentenceList(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Changed", "", "", "http://changed", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	makeSentences := func(n int) []readerer.Sentence {
+		out := make([]readerer.Sentence, n)
+		for i := range out {
+			out[i] = readerer.Sentence{Text: fmt.Sprintf("犬%d", i), Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"}}}
+		}
+		return out
+	}
+
+	// An interrupted run over 10 sentences checkpointed index 4.
+	ingester := NewIngester(conn, nil)
+	if _, err := ingester.Ingest(context.Background(), sourceID, makeSentences(5)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSourceTotalSentences(conn, sourceID, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ingester.Ingest(context.Background(), sourceID, makeSentences(7)); !errors.Is(err, ErrResumeMismatch) {
+		t.Fatalf("expected ErrResumeMismatch for a 7-sentence list, got %v", err)
+	}
+	if last, err := db.GetSourceProgress(conn, sourceID); err != nil || last != 4 {
+		t.Fatalf("expected progress to be left alone, got %d (%v)", last, err)
+	}
+
+	// With Force the saved progress is discarded and all 7 sentences are ingested.
+	ingester.Force = true
+	count, err := ingester.Ingest(context.Background(), sourceID, makeSentences(7))
+	if err != nil {
+		t.Fatalf("Ingest with Force: %v", err)
+	}
+	if count != 7 {
+		t.Errorf("expected all 7 sentences to be ingested, got %d links", count)
+	}
+	// The 5 occurrences from the interrupted run are not counted again.
+	var occurrences int
+	if err := conn.QueryRow(`SELECT occurrence_count FROM word_sources WHERE source_id = ?`, sourceID).Scan(&occurrences); err != nil || occurrences != 7 {
+		t.Errorf("expected 7 occurrences after starting over, got %d (%v)", occurrences, err)
+	}
+}
+
+func TestIngestRecordsSentenceTotal(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Total", "", "", "http://total", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentences := make([]readerer.Sentence, 4)
+	for i := range sentences {
+		sentences[i] = readerer.Sentence{Text: "犬", Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"}}}
+	}
+
+	// An interrupted run still records the total, so progress reads as a percentage.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewIngester(conn, nil).Ingest(ctx, sourceID, sentences); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	last, err := db.GetSourceProgress(conn, sourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pct, err := db.GetSourceProgressPercent(conn, sourceID)
+	if err != nil || pct != float64(last+1)*25 {
+		t.Fatalf("expected %v%% for progress index %d, got %v (%v)", float64(last+1)*25, last, pct, err)
+	}
+
+	// Streams record their total once fully read.
+	streamID, err := db.CreateOrGetSource(conn, "test", "TotalStream", "", "", "http://total-stream", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := make(chan readerer.Sentence, len(sentences))
+	for _, s := range sentences {
+		src <- s
+	}
+	close(src)
+	if _, err := NewIngester(conn, nil).IngestStream(context.Background(), streamID, src); err != nil {
+		t.Fatalf("IngestStream: %v", err)
+	}
+	if pct, err := db.GetSourceProgressPercent(conn, streamID); err != nil || pct != 100 {
+		t.Fatalf("expected 100%% after a full stream, got %v (%v)", pct, err)
+	}
 }
 
 func TestIngestContextCancel(t *testing.T) {
@@ -317,3 +418,998 @@ func TestIngestEarlyCancellationDoesNotDeadlock(t *testing.T) {
 		t.Fatal("Ingest hung after cancellation")
 	}
 }
+
+// fakeProvider returns canned dictionary entries and counts lookups.
+type fakeProvider struct {
+	mu      sync.Mutex
+	calls   int
+	entries map[string][]dictionary.JMdictEntry
+}
+
+func (f *fakeProvider) Lookup(word, lemma, pronunciation string) ([]dictionary.JMdictEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	return f.entries[word], nil
+}
+
+func TestIngestUsesDefinitionProvider(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "ProviderTest", "", "", "http://provider", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canned := []dictionary.JMdictEntry{{
+		Id:    "42",
+		Kanji: []dictionary.JMdictElement{{Text: "犬", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "いぬ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "canned dog"}}, PartOfSpeech: []string{"n"}}},
+	}}
+	provider := &fakeProvider{entries: map[string][]dictionary.JMdictEntry{"犬": canned}}
+
+	sentences := []readerer.Sentence{{
+		Text:   "犬がいる",
+		Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", Reading: "イヌ", PrimaryPOS: "名詞"}},
+	}}
+
+	ingester := NewIngester(conn, provider)
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	if provider.calls != 1 {
+		t.Errorf("expected 1 lookup, got %d", provider.calls)
+	}
+
+	want, err := dictionary.FormatDefinitions(canned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	if err := conn.QueryRow(`SELECT definitions FROM words WHERE word = ?`, "犬").Scan(&got); err != nil {
+		t.Fatalf("query definitions: %v", err)
+	}
+	if got != want {
+		t.Errorf("expected definitions %s from provider, got %s", want, got)
+	}
+}
+
+// glossListFormatter stores the first gloss of each entry, separated by " / ".
+type glossListFormatter struct{}
+
+func (glossListFormatter) Format(entries []dictionary.JMdictEntry) (string, error) {
+	var glosses []string
+	for _, e := range entries {
+		if len(e.Sense) > 0 && len(e.Sense[0].Gloss) > 0 {
+			glosses = append(glosses, e.Sense[0].Gloss[0].Text)
+		}
+	}
+	return "deck:" + strings.Join(glosses, " / "), nil
+}
+
+func TestIngestUsesImporterFormatter(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "FormatterTest", "", "", "http://formatter", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importer := dictionary.NewImporter(conn, []dictionary.JMdictEntry{{
+		Id:    "42",
+		Kanji: []dictionary.JMdictElement{{Text: "犬", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "いぬ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "dog"}}, PartOfSpeech: []string{"n"}}},
+	}})
+	importer.Formatter = glossListFormatter{}
+
+	sentences := []readerer.Sentence{{
+		Text:   "犬がいる",
+		Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", Reading: "イヌ", PrimaryPOS: "名詞"}},
+	}}
+	if _, err := NewIngester(conn, importer).Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	var got string
+	if err := conn.QueryRow(`SELECT definitions FROM words WHERE word = ?`, "犬").Scan(&got); err != nil {
+		t.Fatalf("query definitions: %v", err)
+	}
+	if got != "deck:dog" {
+		t.Errorf("expected the custom formatter's output, got %q", got)
+	}
+}
+
+func TestIngestPlainTextDefinitions(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "PlainText", "", "", "http://plain-text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeProvider{entries: map[string][]dictionary.JMdictEntry{"犬": {{
+		Id:    "1",
+		Kanji: []dictionary.JMdictElement{{Text: "犬", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "いぬ", Common: true}},
+		Sense: []dictionary.JMdictSense{
+			{Gloss: []dictionary.JMdictGloss{{Text: "dog"}, {Text: "hound"}}, PartOfSpeech: []string{"n"}},
+			{Gloss: []dictionary.JMdictGloss{{Text: "spy"}}, PartOfSpeech: []string{"n", "adj-no"}},
+		},
+	}}}}
+	sentences := []readerer.Sentence{{
+		Text:   "犬がいる",
+		Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", Reading: "イヌ", PrimaryPOS: "名詞"}},
+	}}
+	ingester := NewIngester(conn, provider)
+	ingester.Formatter = dictionary.PlainTextFormatter{}
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	word, err := db.GetWord(conn, "犬", "犬", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "1. dog; hound (n)\n2. spy (n, adj-no)"; word.Definitions != want {
+		t.Errorf("stored definitions = %q, want %q", word.Definitions, want)
+	}
+}
+
+func TestIngestOnCommittedTracksDurableProgress(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	// A single connection keeps the in-memory DB shared between the writer and the callback's reads.
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "CommitTest", "", "", "http://commit", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sentences := make([]readerer.Sentence, 25)
+	for i := range sentences {
+		sentences[i] = readerer.Sentence{
+			Text:   "コミットテスト",
+			Tokens: []readerer.Token{{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PrimaryPOS: "名詞"}},
+		}
+	}
+
+	ingester := NewIngester(conn, nil)
+	ingester.BatchSize = 4
+
+	var committed []int
+	ingester.OnCommitted = func(index int) {
+		// The checkpoint must already be durable when the hook fires.
+		progress, err := db.GetSourceProgress(conn, sourceID)
+		if err != nil {
+			t.Errorf("read progress: %v", err)
+			return
+		}
+		if progress != index {
+			t.Errorf("OnCommitted(%d) fired before commit; stored progress is %d", index, progress)
+		}
+		committed = append(committed, index)
+	}
+
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	if len(committed) == 0 {
+		t.Fatal("expected OnCommitted to be called")
+	}
+	for i := 1; i < len(committed); i++ {
+		if committed[i] <= committed[i-1] {
+			t.Fatalf("committed index did not advance monotonically: %v", committed)
+		}
+	}
+	if last := committed[len(committed)-1]; last != len(sentences)-1 {
+		t.Errorf("expected final committed index %d, got %d", len(sentences)-1, last)
+	}
+}
+
+func TestIngestCachedDefinitionsOnly(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	// Workers read cached definitions while the writer holds transactions; share one in-memory DB.
+	conn.SetMaxOpenConns(1)
+
+	// Seed definitions as a prior run with a dictionary would have.
+	wordID, err := db.CreateOrGetWord(conn, "犬", "犬", "いぬ", "", "ja")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cachedDefs := `[{"senses":["dog"],"pos":["n"]}]`
+	if err := db.UpdateWordDefinitions(conn, wordID, cachedDefs); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "CacheOnly", "", "", "http://cache-only", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentences := []readerer.Sentence{{
+		Text: "犬と猫",
+		Tokens: []readerer.Token{
+			{Surface: "犬", BaseForm: "犬", Reading: "", PrimaryPOS: "名詞"},
+			{Surface: "猫", BaseForm: "猫", Reading: "ネコ", PrimaryPOS: "名詞"},
+		},
+	}}
+
+	// No importer at all: definitions must come from the words table.
+	ingester := NewIngester(conn, nil)
+	ingester.CachedDefinitionsOnly = true
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	words, err := db.GetWordsBySource(conn, sourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]db.Word{}
+	for _, w := range words {
+		got[w.Word] = w
+	}
+	if got["犬"].Definitions != cachedDefs {
+		t.Errorf("expected cached definitions for 犬, got %q", got["犬"].Definitions)
+	}
+	if got["犬"].Pronunciation != "いぬ" {
+		t.Errorf("expected cached reading いぬ for 犬, got %q", got["犬"].Pronunciation)
+	}
+	if got["猫"].Definitions != "" {
+		t.Errorf("expected no definitions for uncached 猫, got %q", got["猫"].Definitions)
+	}
+}
+
+func TestIngestQueueSizeValidation(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentences := []readerer.Sentence{{
+		Text:   "テスト",
+		Tokens: []readerer.Token{{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}},
+	}}
+
+	ingester := NewIngester(conn, nil)
+	ingester.QueueSize = -1
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err == nil {
+		t.Fatal("expected error for negative QueueSize")
+	}
+
+	ingester.QueueSize = 1
+	count, err := ingester.Ingest(context.Background(), sourceID, sentences)
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 linked item, got %d", count)
+	}
+}
+
+func TestIngestPicksBestExampleSentence(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := readerer.Token{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}
+	candidates := []string{
+		"テスト", // too short, no 。
+		"今日は学校で大事なテストがありました。", // contains word, good length, ends with 。
+		"テストだ。", // short
+		"明日も同じような内容のテストがあるかもしれない", // no 。
+	}
+	var sentences []readerer.Sentence
+	for _, text := range candidates {
+		sentences = append(sentences, readerer.Sentence{Text: text, Tokens: []readerer.Token{token}})
+	}
+
+	ingester := NewIngester(conn, nil)
+	ingester.Workers = 2
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	var example string
+	err = conn.QueryRow(`SELECT s.text FROM word_sources ws
+		JOIN words w ON w.id = ws.word_id
+		JOIN sentences s ON s.id = ws.example_sentence_id
+		WHERE w.word = ? AND ws.source_id = ?`, "テスト", sourceID).Scan(&example)
+	if err != nil {
+		t.Fatalf("query example: %v", err)
+	}
+	if example != candidates[1] {
+		t.Errorf("expected best example %q, got %q", candidates[1], example)
+	}
+}
+
+func TestIngestKeepsBetterStoredExample(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := readerer.Token{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}
+	ingester := NewIngester(conn, nil)
+
+	// Each run starts over with a single candidate, as a later run over different
+	// sentences would, so the in-run comparison alone cannot keep the stored example.
+	runWith := func(text string) string {
+		t.Helper()
+		if err := db.UpdateSourceProgress(conn, sourceID, -1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ingester.Ingest(context.Background(), sourceID, []readerer.Sentence{{Text: text, Tokens: []readerer.Token{token}}}); err != nil {
+			t.Fatalf("Ingest %q failed: %v", text, err)
+		}
+		var example string
+		err := conn.QueryRow(`SELECT s.text FROM word_sources ws
+			JOIN words w ON w.id = ws.word_id
+			JOIN sentences s ON s.id = ws.example_sentence_id
+			WHERE w.word = ? AND ws.source_id = ?`, "テスト", sourceID).Scan(&example)
+		if err != nil {
+			t.Fatalf("query example: %v", err)
+		}
+		return example
+	}
+
+	fair := "今日は学校でテストがある" // no 。
+	worse := "テストだ。"       // short
+	good := "今日は学校で大事なテストがありました。"
+
+	if got := runWith(fair); got != fair {
+		t.Fatalf("expected first example %q, got %q", fair, got)
+	}
+	if got := runWith(worse); got != fair {
+		t.Errorf("expected stored example %q to be kept over %q, got %q", fair, worse, got)
+	}
+	if got := runWith(good); got != good {
+		t.Errorf("expected better example %q to replace the stored one, got %q", good, got)
+	}
+}
+
+func TestIngestStreamMatchesSlice(t *testing.T) {
+	var sentences []readerer.Sentence
+	for i, w := range []string{"猫", "犬", "猫", "鳥", "魚", "犬"} {
+		sentences = append(sentences, readerer.Sentence{
+			Text:   fmt.Sprintf("%sがいる%d。", w, i),
+			Tokens: []readerer.Token{{Surface: w, BaseForm: w, Reading: "", PartsOfSpeech: []string{"名詞"}, PrimaryPOS: "名詞"}},
+		})
+	}
+
+	type result struct {
+		links    int
+		counts   map[string]int
+		progress int
+	}
+	run := func(stream bool, preset int) result {
+		conn := setupDB(t)
+		defer conn.Close()
+		conn.SetMaxOpenConns(1)
+
+		sourceID, err := db.CreateOrGetSource(conn, "test", "Stream", "Author", "Site", "http://stream", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preset >= 0 {
+			if err := db.UpdateSourceProgress(conn, sourceID, preset); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ingester := NewIngester(conn, nil)
+		ingester.BatchSize = 2
+		var links int
+		if stream {
+			src := make(chan readerer.Sentence)
+			go func() {
+				defer close(src)
+				for _, s := range sentences {
+					src <- s
+				}
+			}()
+			links, err = ingester.IngestStream(context.Background(), sourceID, src)
+		} else {
+			links, err = ingester.Ingest(context.Background(), sourceID, sentences)
+		}
+		if err != nil {
+			t.Fatalf("ingest (stream=%v) failed: %v", stream, err)
+		}
+
+		counts := make(map[string]int)
+		rows, err := conn.Query(`SELECT w.word, ws.occurrence_count FROM word_sources ws JOIN words w ON w.id = ws.word_id WHERE ws.source_id = ?`, sourceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var w string
+			var c int
+			if err := rows.Scan(&w, &c); err != nil {
+				t.Fatal(err)
+			}
+			counts[w] = c
+		}
+		progress, err := db.GetSourceProgress(conn, sourceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result{links: links, counts: counts, progress: progress}
+	}
+
+	for _, preset := range []int{-1, 2} {
+		want := run(false, preset)
+		got := run(true, preset)
+		if got.links != want.links || got.progress != want.progress {
+			t.Errorf("preset %d: stream links/progress = %d/%d, slice = %d/%d", preset, got.links, got.progress, want.links, want.progress)
+		}
+		if fmt.Sprint(got.counts) != fmt.Sprint(want.counts) {
+			t.Errorf("preset %d: stream counts %v, slice counts %v", preset, got.counts, want.counts)
+		}
+	}
+}
+
+func TestIngestCanonicalizeKana(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "KanaTest", "", "", "http://kana", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cat := dictionary.JMdictEntry{
+		Id:    "1",
+		Kanji: []dictionary.JMdictElement{{Text: "猫", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "ねこ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "cat"}}, PartOfSpeech: []string{"n"}}},
+	}
+	// これ is usually written in kana, so it must stay as-is.
+	kore := dictionary.JMdictEntry{
+		Id:    "2",
+		Kanji: []dictionary.JMdictElement{{Text: "此れ", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "これ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "this"}}, PartOfSpeech: []string{"pn"}, Misc: []string{"uk"}}},
+	}
+	provider := &fakeProvider{entries: map[string][]dictionary.JMdictEntry{
+		"ねこ": {cat},
+		"これ": {kore},
+	}}
+
+	sentences := []readerer.Sentence{{
+		Text: "これはねこ",
+		Tokens: []readerer.Token{
+			{Surface: "これ", BaseForm: "これ", Reading: "コレ", PrimaryPOS: "名詞"},
+			{Surface: "ねこ", BaseForm: "ねこ", Reading: "ネコ", PrimaryPOS: "名詞"},
+		},
+	}}
+
+	ingester := NewIngester(conn, provider)
+	ingester.CanonicalizeKana = true
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	w, err := db.GetWord(conn, "猫", "猫", "ja")
+	if err != nil {
+		t.Fatalf("expected ねこ to be stored as 猫: %v", err)
+	}
+	if w.Pronunciation != "ねこ" {
+		t.Errorf("expected kana surface as reading, got %q", w.Pronunciation)
+	}
+	if _, err := db.GetWord(conn, "ねこ", "ねこ", "ja"); err != sql.ErrNoRows {
+		t.Errorf("expected no separate ねこ entry, got err=%v", err)
+	}
+	if _, err := db.GetWord(conn, "これ", "これ", "ja"); err != nil {
+		t.Errorf("expected usually-kana word to stay in kana: %v", err)
+	}
+}
+
+func TestIngestReadingStyle(t *testing.T) {
+	sentences := []readerer.Sentence{{
+		Text: "コーヒーを飲む",
+		Tokens: []readerer.Token{
+			{Surface: "コーヒー", BaseForm: "コーヒー", Reading: "コーヒー", PrimaryPOS: "名詞"},
+			{Surface: "飲む", BaseForm: "飲む", Reading: "ノム", PrimaryPOS: "動詞"},
+		},
+	}}
+
+	cases := []struct {
+		style        ReadingStyle
+		coffee, nomu string
+	}{
+		{"", "こーひー", "のむ"},
+		{ReadingKatakana, "コーヒー", "ノム"},
+		{ReadingAsIs, "コーヒー", "ノム"},
+	}
+	for _, tc := range cases {
+		conn := setupDB(t)
+		conn.SetMaxOpenConns(1)
+		sourceID, err := db.CreateOrGetSource(conn, "test", "Style", "", "", "http://style", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ingester := NewIngester(conn, nil)
+		ingester.ReadingStyle = tc.style
+		if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+			t.Fatalf("style %q: Ingest failed: %v", tc.style, err)
+		}
+		for word, want := range map[string]string{"コーヒー": tc.coffee, "飲む": tc.nomu} {
+			w, err := db.GetWord(conn, word, word, "ja")
+			if err != nil {
+				t.Fatalf("style %q: get %s: %v", tc.style, word, err)
+			}
+			if w.Pronunciation != want {
+				t.Errorf("style %q: %s reading = %q, want %q", tc.style, word, w.Pronunciation, want)
+			}
+		}
+		conn.Close()
+	}
+
+	conn := setupDB(t)
+	defer conn.Close()
+	ingester := NewIngester(conn, nil)
+	ingester.ReadingStyle = "romaji"
+	if _, err := ingester.Ingest(context.Background(), 1, sentences); err == nil {
+		t.Fatal("expected error for unknown ReadingStyle")
+	}
+}
+
+func TestNewIngesterDefaultWorkersTracksNumCPU(t *testing.T) {
+	want := runtime.NumCPU()
+	if want > MaxDefaultWorkers {
+		want = MaxDefaultWorkers
+	}
+	ig := NewIngester(nil, nil)
+	if ig.Workers != want {
+		t.Errorf("default Workers = %d, want %d (NumCPU=%d)", ig.Workers, want, runtime.NumCPU())
+	}
+	if ig.Workers < 1 || ig.Workers > MaxDefaultWorkers {
+		t.Errorf("default Workers %d outside [1, %d]", ig.Workers, MaxDefaultWorkers)
+	}
+}
+
+func TestIngestContentSkipsUnchangedHash(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "テスト。"
+	sentences := []readerer.Sentence{{
+		Text:   text,
+		Tokens: []readerer.Token{{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}},
+	}}
+
+	ig := NewIngester(conn, nil)
+	if n, err := ig.IngestContent(context.Background(), sourceID, text, sentences); err != nil || n != 1 {
+		t.Fatalf("first run: n=%d err=%v", n, err)
+	}
+
+	// Even with progress reset, identical content must not be ingested twice.
+	if err := db.UpdateSourceProgress(conn, sourceID, -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ig.IngestContent(context.Background(), sourceID, text, sentences); !errors.Is(err, ErrContentUnchanged) {
+		t.Fatalf("expected ErrContentUnchanged, got %v", err)
+	}
+	var count int
+	if err := conn.QueryRow(`SELECT occurrence_count FROM word_sources`).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("expected occurrence count 1 after skipped run, got %d", count)
+	}
+
+	// Force re-ingests the finished source without a manual progress reset, replacing
+	// its counts instead of adding to them.
+	if err := db.UpdateSourceProgress(conn, sourceID, 0); err != nil {
+		t.Fatal(err)
+	}
+	ig.Force = true
+	if n, err := ig.IngestContent(context.Background(), sourceID, text, sentences); err != nil || n != 1 {
+		t.Fatalf("forced run: n=%d err=%v", n, err)
+	}
+	if err := conn.QueryRow(`SELECT occurrence_count FROM word_sources`).Scan(&count); err != nil || count != 1 {
+		t.Errorf("expected occurrence count 1 after forced run, got %d (%v)", count, err)
+	}
+
+	// Changed content is counted from scratch as well.
+	ig.Force = false
+	changed := "テスト。テスト。"
+	if n, err := ig.IngestContent(context.Background(), sourceID, changed, append(sentences, sentences[0])); err != nil || n != 2 {
+		t.Fatalf("changed run: n=%d err=%v", n, err)
+	}
+	if err := conn.QueryRow(`SELECT occurrence_count FROM word_sources`).Scan(&count); err != nil || count != 2 {
+		t.Errorf("expected occurrence count 2 for the changed text, got %d (%v)", count, err)
+	}
+}
+
+func TestIngestMaxSentencesPerSource(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sentences []readerer.Sentence
+	for i := 0; i < 5; i++ {
+		sentences = append(sentences, readerer.Sentence{
+			Text:   fmt.Sprintf("テスト%dです。", i),
+			Tokens: []readerer.Token{{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}},
+		})
+	}
+
+	ig := NewIngester(conn, nil)
+	ig.MaxSentencesPerSource = 2
+	if _, err := ig.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+
+	var sentenceRows, sourceSentences, contexts, count int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM sentences`).Scan(&sentenceRows); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM source_sentences WHERE source_id = ?`, sourceID).Scan(&sourceSentences); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM word_contexts`).Scan(&contexts); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.QueryRow(`SELECT occurrence_count FROM word_sources WHERE source_id = ?`, sourceID).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if sentenceRows != 2 || sourceSentences != 2 {
+		t.Errorf("expected sentence creation to stop at 2, got %d sentences (%d tracked)", sentenceRows, sourceSentences)
+	}
+	if contexts != 2 {
+		t.Errorf("expected 2 contexts, got %d", contexts)
+	}
+	if count != 5 {
+		t.Errorf("expected occurrences to keep counting to 5, got %d", count)
+	}
+
+	ig.MaxSentencesPerSource = -1
+	if _, err := ig.Ingest(context.Background(), sourceID, sentences); err == nil {
+		t.Error("expected error for negative MaxSentencesPerSource")
+	}
+}
+
+func TestIngestNumbersAndAlphanumeric(t *testing.T) {
+	analyzer, err := readerer.NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sentences, err := analyzer.AnalyzeDocument("5時にCOVIDの検査をiPhoneで予約した。")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		keepNumbers, keepAlnum bool
+		want                   map[string]bool
+	}{
+		{false, false, map[string]bool{"5": false, "時": true, "COVID": false, "iPhone": false}},
+		{true, false, map[string]bool{"5": true, "時": true, "COVID": false, "iPhone": false}},
+		{false, true, map[string]bool{"5": false, "時": true, "COVID": true, "iPhone": true}},
+		{true, true, map[string]bool{"5": true, "時": true, "COVID": true, "iPhone": true}},
+	}
+	for _, c := range cases {
+		conn := setupDB(t)
+		sourceID, err := db.CreateOrGetSource(conn, "test", "T", "", "", "http://test", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ig := NewIngester(conn, nil)
+		ig.KeepNumbers = c.keepNumbers
+		ig.KeepAlphanumeric = c.keepAlnum
+		if _, err := ig.Ingest(context.Background(), sourceID, sentences); err != nil {
+			t.Fatalf("Ingest failed: %v", err)
+		}
+		for word, want := range c.want {
+			_, err := db.GetWord(conn, word, word, "ja")
+			if got := err == nil; got != want {
+				t.Errorf("KeepNumbers=%v KeepAlphanumeric=%v: %s stored = %v, want %v", c.keepNumbers, c.keepAlnum, word, got, want)
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestClassifyToken(t *testing.T) {
+	cases := []struct {
+		tok  readerer.Token
+		want tokenClass
+	}{
+		{readerer.Token{Surface: "5", PartsOfSpeech: []string{"名詞", "数"}}, tokenNumber},
+		{readerer.Token{Surface: "５", PartsOfSpeech: []string{"名詞", "数"}}, tokenNumber},
+		{readerer.Token{Surface: "三", PartsOfSpeech: []string{"名詞", "数"}}, tokenNumber},
+		{readerer.Token{Surface: "3.5", PartsOfSpeech: []string{"名詞"}}, tokenNumber},
+		{readerer.Token{Surface: "ＣＯＶＩＤ", PartsOfSpeech: []string{"名詞", "一般"}}, tokenAlphanumeric},
+		{readerer.Token{Surface: "5G", PartsOfSpeech: []string{"名詞"}}, tokenAlphanumeric},
+		{readerer.Token{Surface: "5時", PartsOfSpeech: []string{"名詞"}}, tokenWord},
+		{readerer.Token{Surface: "...", PartsOfSpeech: []string{"名詞"}}, tokenSymbol},
+		{readerer.Token{Surface: "時", PartsOfSpeech: []string{"名詞", "接尾"}}, tokenWord},
+	}
+	for _, c := range cases {
+		if got := classifyToken(c.tok); got != c.want {
+			t.Errorf("classifyToken(%q) = %d, want %d", c.tok.Surface, got, c.want)
+		}
+	}
+}
+
+func TestIngestReconstructSource(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Title", "Author", "Site", "http://test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := []string{"はい。", "猫が好きです。", "はい。", "犬も好きです。"}
+	var sentences []readerer.Sentence
+	for _, text := range texts {
+		sentences = append(sentences, readerer.Sentence{
+			Text:   text,
+			Tokens: []readerer.Token{{Surface: "テスト", BaseForm: "テスト", Reading: "テスト", PartsOfSpeech: []string{"名詞"}}},
+		})
+	}
+
+	ig := NewIngester(conn, nil)
+	ig.BatchSize = 1
+	if _, err := ig.IngestContent(context.Background(), sourceID, strings.Join(texts, ""), sentences); err != nil {
+		t.Fatalf("IngestContent failed: %v", err)
+	}
+	got, err := db.ReconstructSource(conn, sourceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(texts, "\n"); got != want {
+		t.Errorf("ReconstructSource = %q, want %q", got, want)
+	}
+
+	// Changed content replaces the stored order instead of mixing with it.
+	changed := sentences[1:2]
+	if _, err := ig.IngestContent(context.Background(), sourceID, "猫が好きです。", changed); err != nil {
+		t.Fatalf("IngestContent (changed) failed: %v", err)
+	}
+	if got, err := db.ReconstructSource(conn, sourceID); err != nil || got != "猫が好きです。" {
+		t.Errorf("after change: ReconstructSource = %q (err=%v)", got, err)
+	}
+}
+
+func TestIngestRequireDefinitions(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "RequireDefs", "", "", "http://require-defs", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeProvider{entries: map[string][]dictionary.JMdictEntry{"犬": {{
+		Id:    "1",
+		Kanji: []dictionary.JMdictElement{{Text: "犬", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "いぬ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "dog"}}, PartOfSpeech: []string{"n"}}},
+	}}}}
+	sentences := []readerer.Sentence{
+		{Text: "犬がいる", Tokens: []readerer.Token{{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"}}},
+		{Text: "ズヴォグと犬", Tokens: []readerer.Token{
+			{Surface: "ズヴォグ", BaseForm: "ズヴォグ", PrimaryPOS: "名詞"},
+			{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"},
+		}},
+		{Text: "ズヴォグだ", Tokens: []readerer.Token{{Surface: "ズヴォグ", BaseForm: "ズヴォグ", PrimaryPOS: "名詞"}}},
+	}
+
+	ingester := NewIngester(conn, provider)
+	ingester.RequireDefinitions = true
+	_, err = ingester.Ingest(context.Background(), sourceID, sentences)
+	var missing *MissingDefinitionsError
+	if !errors.As(err, &missing) || !errors.Is(err, ErrMissingDefinitions) {
+		t.Fatalf("expected a MissingDefinitionsError, got %v", err)
+	}
+	if len(missing.Words) != 1 || missing.Words[0] != "ズヴォグ" {
+		t.Fatalf("expected only ズヴォグ to be reported once, got %q", missing.Words)
+	}
+	// Collect mode still stores everything.
+	var n int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM words`).Scan(&n); err != nil || n != 2 {
+		t.Fatalf("expected both words stored, got %d (%v)", n, err)
+	}
+
+	// Abort mode stops on the first undefined word.
+	other, err := db.CreateOrGetSource(conn, "test", "RequireDefsAbort", "", "", "http://require-defs-abort", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingester = NewIngester(conn, provider)
+	ingester.RequireDefinitions = true
+	ingester.AbortOnMissingDefinition = true
+	if _, err := ingester.Ingest(context.Background(), other, sentences); !errors.As(err, &missing) {
+		t.Fatalf("expected the run to abort with a MissingDefinitionsError, got %v", err)
+	}
+
+	// Without a dictionary the option cannot work and is rejected.
+	ingester = NewIngester(conn, nil)
+	ingester.RequireDefinitions = true
+	if _, err := ingester.Ingest(context.Background(), other, sentences); err == nil || errors.As(err, &missing) {
+		t.Fatalf("expected a configuration error, got %v", err)
+	}
+}
+
+func TestIngestUnmatchedWriter(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	sourceID, err := db.CreateOrGetSource(conn, "test", "Unmatched", "", "", "http://unmatched", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &fakeProvider{entries: map[string][]dictionary.JMdictEntry{"犬": {{
+		Id:    "1",
+		Kanji: []dictionary.JMdictElement{{Text: "犬", Common: true}},
+		Kana:  []dictionary.JMdictElement{{Text: "いぬ", Common: true}},
+		Sense: []dictionary.JMdictSense{{Gloss: []dictionary.JMdictGloss{{Text: "dog"}}, PartOfSpeech: []string{"n"}}},
+	}}}}
+	sentences := []readerer.Sentence{
+		{Text: "ズヴォグと犬", Tokens: []readerer.Token{
+			{Surface: "ズヴォグ", BaseForm: "ズヴォグ", PrimaryPOS: "名詞"},
+			{Surface: "と", BaseForm: "と", PrimaryPOS: "助詞"},
+			{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"},
+		}},
+		{Text: "ズヴォグだ", Tokens: []readerer.Token{{Surface: "ズヴォグ", BaseForm: "ズヴォグ", PrimaryPOS: "名詞"}}},
+	}
+
+	var out strings.Builder
+	ingester := NewIngester(conn, provider)
+	ingester.UnmatchedWriter = &out
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+	if got := out.String(); got != "ズヴォグ\n" {
+		t.Fatalf("expected only ズヴォグ, once, got %q", got)
+	}
+
+	ingester = NewIngester(conn, nil)
+	ingester.UnmatchedWriter = &out
+	if _, err := ingester.Ingest(context.Background(), sourceID, sentences); err == nil {
+		t.Fatal("expected UnmatchedWriter without a dictionary to be rejected")
+	}
+}
+
+func TestIngestSkipSentences(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+	sourceID, err := db.CreateOrGetSource(conn, "test", "WordsOnly", "", "", "http://words-only", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dog := readerer.Token{Surface: "犬", BaseForm: "犬", PrimaryPOS: "名詞"}
+	cat := readerer.Token{Surface: "猫", BaseForm: "猫", PrimaryPOS: "名詞"}
+	sentences := []readerer.Sentence{
+		{Text: "犬と猫。", Tokens: []readerer.Token{dog, cat}},
+		{Text: "犬と犬。", Tokens: []readerer.Token{dog, dog}},
+	}
+
+	ingester := NewIngester(conn, nil)
+	ingester.SkipSentences = true
+	count, err := ingester.Ingest(context.Background(), sourceID, sentences)
+	if err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("expected 4 linked occurrences, got %d", count)
+	}
+
+	for _, table := range []string{"sentences", "word_contexts", "source_sentences"} {
+		var n int
+		if err := conn.QueryRow(`SELECT COUNT(*) FROM ` + table).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("expected no %s rows in word-only mode, got %d", table, n)
+		}
+	}
+	var dogCount int
+	if err := conn.QueryRow(`SELECT ws.occurrence_count FROM word_sources ws JOIN words w ON w.id = ws.word_id WHERE w.word = '犬'`).Scan(&dogCount); err != nil {
+		t.Fatal(err)
+	}
+	if dogCount != 3 {
+		t.Errorf("expected 犬 counted 3 times, got %d", dogCount)
+	}
+}
+
+func TestIngestBoilerplateRepeatsCountedOnce(t *testing.T) {
+	conn := setupDB(t)
+	defer conn.Close()
+
+	boiler := readerer.Sentence{
+		Text:   "記事を共有する",
+		Tokens: []readerer.Token{{Surface: "記事", BaseForm: "記事", Reading: "キジ", PrimaryPOS: "名詞"}},
+	}
+	body := readerer.Sentence{
+		Text:   "猫の記事",
+		Tokens: []readerer.Token{{Surface: "猫", BaseForm: "猫", Reading: "ネコ", PrimaryPOS: "名詞"}, {Surface: "記事", BaseForm: "記事", Reading: "キジ", PrimaryPOS: "名詞"}},
+	}
+	var sentences []readerer.Sentence
+	for i := 0; i < 10; i++ {
+		sentences = append(sentences, boiler)
+		if i == 4 {
+			sentences = append(sentences, body)
+		}
+	}
+
+	count := func(sourceID int64, word string) int {
+		t.Helper()
+		var n int
+		if err := conn.QueryRow(`SELECT ws.occurrence_count FROM word_sources ws JOIN words w ON w.id = ws.word_id
+			WHERE ws.source_id = ? AND w.word = ?`, sourceID, word).Scan(&n); err != nil {
+			t.Fatalf("count %s: %v", word, err)
+		}
+		return n
+	}
+
+	plainID, err := db.CreateOrGetSource(conn, "test", "Plain", "", "", "http://plain", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewIngester(conn, nil).Ingest(context.Background(), plainID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	if got := count(plainID, "記事"); got != 11 {
+		t.Fatalf("expected every repeat counted without the option, got %d", got)
+	}
+
+	dedupedID, err := db.CreateOrGetSource(conn, "test", "Deduped", "", "", "http://deduped", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ingester := NewIngester(conn, nil)
+	ingester.BoilerplateRepeats = 3
+	if _, err := ingester.Ingest(context.Background(), dedupedID, sentences); err != nil {
+		t.Fatalf("Ingest failed: %v", err)
+	}
+	// Once from the boilerplate, once from the article sentence that appears only once.
+	if got := count(dedupedID, "記事"); got != 2 {
+		t.Fatalf("expected the boilerplate to contribute once, got %d occurrences", got)
+	}
+	if got := count(dedupedID, "猫"); got != 1 {
+		t.Fatalf("expected 猫 once, got %d", got)
+	}
+	if progress, err := db.GetSourceProgress(conn, dedupedID); err != nil || progress != len(sentences)-1 {
+		t.Fatalf("expected progress through every sentence, got %d (err %v)", progress, err)
+	}
+
+	// A threshold above the repeat count leaves the sentences alone.
+	if repeats := boilerplateRepeats(sentences, 11); len(repeats) != 0 {
+		t.Fatalf("expected no repeats above the threshold, got %v", repeats)
+	}
+	streamer := NewIngester(conn, nil)
+	streamer.BoilerplateRepeats = 3
+	if _, err := streamer.IngestStream(context.Background(), dedupedID, make(chan readerer.Sentence)); err == nil {
+		t.Fatal("expected IngestStream to reject BoilerplateRepeats")
+	}
+}
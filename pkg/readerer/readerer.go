@@ -1,8 +1,13 @@
 package readerer
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"regexp"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/ikawaha/kagome-dict/ipa"
 	"github.com/ikawaha/kagome/v2/tokenizer"
@@ -13,25 +18,127 @@ func Version() string { return "0.1.0" }
 
 // Token represents a single analyzed unit of text.
 type Token struct {
-	Surface       string   // The text as it appears (e.g. "行っ")
-	BaseForm      string   // The dictionary form (e.g. "行く")
-	Reading       string   // The pronunciation (katakana, e.g. "イッ")
-	PartsOfSpeech []string // e.g. ["動詞", "自立", "*", "*"] (Kagome POS labels)
+	Surface       string   `json:"surface"`         // The text as it appears (e.g. "行っ")
+	BaseForm      string   `json:"base_form"`       // The dictionary form (e.g. "行く")
+	Reading       string   `json:"reading"`         // The reading (katakana, e.g. "イッ")
+	PartsOfSpeech []string `json:"parts_of_speech"` // e.g. ["動詞", "自立", "*", "*"] (Kagome POS labels)
 	// PrimaryPOS stores the first (primary) part of speech if available.
-	PrimaryPOS string
+	PrimaryPOS string `json:"primary_pos"`
+	// Pronunciation is how the token is spoken (katakana). It differs from Reading for
+	// some tokens, e.g. the particle は reads ハ but is pronounced ワ. Falls back to Reading.
+	Pronunciation string `json:"pronunciation"`
+	// Unknown is true when the word is not in the tokenizer's dictionary; such tokens
+	// are often names or neologisms, and their base form and reading are unreliable.
+	Unknown bool `json:"unknown"`
+	// IsConjugated is true when the token is an inflected form of its dictionary form,
+	// i.e. Surface differs from BaseForm (書い for 書く).
+	IsConjugated bool `json:"is_conjugated"`
+	// Morae is Reading split into morae (キョウ → キョ, ウ), filled only when the
+	// analyzer has a MoraSplitter.
+	Morae []string `json:"morae,omitempty"`
 }
 
 // Sentence represents a sentence containing tokens.
 type Sentence struct {
-	Text   string
-	Tokens []Token
+	Text   string  `json:"text"`
+	Tokens []Token `json:"tokens"`
+	// ParagraphIndex is the zero-based paragraph (blank-line separated block) the
+	// sentence came from, counting only paragraphs that contain text.
+	ParagraphIndex int `json:"paragraph_index"`
+}
+
+// TokenizerMode selects how Kagome segments text.
+type TokenizerMode string
+
+const (
+	// ModeNormal is regular segmentation; long compounds stay whole. The zero value means ModeNormal.
+	ModeNormal TokenizerMode = "normal"
+	// ModeSearch additionally splits long compounds (関西国際空港 → 関西/国際/空港),
+	// which tends to match more dictionary headwords.
+	ModeSearch TokenizerMode = "search"
+	// ModeExtended is ModeSearch but also splits unknown words into single characters.
+	ModeExtended TokenizerMode = "extended"
+)
+
+// ParseTokenizerMode validates a mode name such as a CLI flag value.
+func ParseTokenizerMode(s string) (TokenizerMode, error) {
+	m := TokenizerMode(s)
+	if _, err := m.kagome(); err != nil {
+		return "", err
+	}
+	return m, nil
+}
+
+// kagome maps m to Kagome's tokenize mode.
+func (m TokenizerMode) kagome() (tokenizer.TokenizeMode, error) {
+	switch m {
+	case "", ModeNormal:
+		return tokenizer.Normal, nil
+	case ModeSearch:
+		return tokenizer.Search, nil
+	case ModeExtended:
+		return tokenizer.Extended, nil
+	default:
+		return 0, fmt.Errorf("invalid tokenizer mode %q (want normal, search or extended)", string(m))
+	}
 }
 
 // Analyzer handles text segmentation.
 type Analyzer struct {
 	t *tokenizer.Tokenizer
+	// Mode is the Kagome segmentation mode used by Analyze. The zero value is ModeNormal.
+	Mode TokenizerMode
+	// SentenceSplitter splits each paragraph of a document into sentences for
+	// AnalyzeDocument and StreamDocument. nil uses the built-in splitter (。！？ and newlines).
+	SentenceSplitter func(text string) []string
+	// KeepQuotes makes the built-in splitter ignore 。！？ inside 「」 and 『』, so quoted
+	// dialogue such as 「今日は晴れだ。明日は雨だ。」と言った。 stays one sentence. Newlines
+	// still split, which bounds the damage of an unclosed quote.
+	KeepQuotes bool
+	// MinSentenceRunes drops sentences with fewer runes than this (ignoring surrounding
+	// whitespace) before tokenization, e.g. navigation scraps like ホーム. 0 disables it.
+	MinSentenceRunes int
+	// MaxSentenceRunes is a safety valve for pathological input such as thousands of
+	// characters without punctuation: sentences longer than this are cut into pieces of at
+	// most this many runes, preferably after a space or 、 or where hiragana gives way to
+	// another script, so tokenization time and stored contexts stay bounded. It applies
+	// after SentenceSplitter too. 0 disables it.
+	MaxSentenceRunes int
+	// JoinLatinWords makes Analyze emit each run of Latin words and numbers separated only
+	// by spaces (e.g. "New York", "iPhone 15 Pro") as a single token instead of one per word.
+	JoinLatinWords bool
+	// MiddleDot controls katakana sequences joined by ・ (e.g. マリー・アントワネット). The
+	// zero value, MiddleDotAsIs, keeps Kagome's segmentation, which varies by name.
+	MiddleDot MiddleDotMode
+	// Readings, if set, supplies the reading of tokens Kagome has no reliable reading for:
+	// those with an empty reading and unknown words. *dictionary.Importer implements it.
+	Readings ReadingSource
+	// MoraSplitter, if set, fills each token's Morae from its reading, e.g.
+	// dictionary.SplitMorae. nil leaves Morae empty.
+	MoraSplitter func(reading string) []string
 }
 
+// ReadingSource looks up the reading of a surface form, e.g. in a dictionary.
+type ReadingSource interface {
+	// Reading returns the katakana reading of surface, or false if it has none.
+	Reading(surface string) (string, bool)
+}
+
+// MiddleDotMode selects how Analyze segments ・-joined katakana names.
+type MiddleDotMode int
+
+const (
+	// MiddleDotAsIs leaves the tokens as Kagome produced them.
+	MiddleDotAsIs MiddleDotMode = iota
+	// MiddleDotJoin emits each ・-joined run of katakana words as a single token.
+	MiddleDotJoin
+	// MiddleDotSplit emits each katakana word and each ・ as separate tokens.
+	MiddleDotSplit
+)
+
+// middleDot is the katakana middle dot (nakaguro) used to separate words in names.
+const middleDot = "・"
+
 // NewAnalyzer creates a new tokenizer instance.
 func NewAnalyzer() (*Analyzer, error) {
 	t, err := tokenizer.New(ipa.Dict(), tokenizer.OmitBosEos())
@@ -43,13 +150,34 @@ func NewAnalyzer() (*Analyzer, error) {
 
 // Analyze breaks text into tokens with readings and base forms.
 func (a *Analyzer) Analyze(text string) ([]Token, error) {
-	tokens := a.t.Tokenize(text)
+	mode, err := a.Mode.kagome()
+	if err != nil {
+		return nil, err
+	}
+	tokens := a.t.Analyze(text, mode)
 	var result []Token
 
-	for _, token := range tokens {
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
 		if token.Class == tokenizer.DUMMY {
 			continue
 		}
+		if a.JoinLatinWords && isLatinWord(token.Surface) {
+			if end := latinRunEnd(tokens, i); end > i {
+				result = append(result, joinTokens(text, tokens[i:end+1]))
+				i = end
+				continue
+			}
+		}
+		if a.MiddleDot == MiddleDotJoin && isKatakanaWord(token.Surface) {
+			if end := middleDotRunEnd(tokens, i); end > i {
+				tok := joinMiddleDotRun(text, tokens[i:end+1])
+				a.fillReading(&tok)
+				result = append(result, tok)
+				i = end
+				continue
+			}
+		}
 
 		features := token.Features()
 
@@ -73,6 +201,10 @@ func (a *Analyzer) Analyze(text string) ([]Token, error) {
 		if len(features) > 7 && features[7] != "*" {
 			reading = features[7]
 		}
+		pronunciation := reading
+		if len(features) > 8 && features[8] != "*" {
+			pronunciation = features[8]
+		}
 
 		// Filter out whitespace only tokens if desired, though often particles are good to keep.
 		if strings.TrimSpace(token.Surface) == "" {
@@ -85,48 +217,371 @@ func (a *Analyzer) Analyze(text string) ([]Token, error) {
 			primaryPOS = features[0]
 		}
 
-		result = append(result, Token{
+		tok := Token{
 			Surface:       token.Surface,
 			BaseForm:      base,
 			Reading:       reading,
+			Pronunciation: pronunciation,
 			PartsOfSpeech: features,
 			PrimaryPOS:    primaryPOS,
-		})
+			Unknown:       token.Class == tokenizer.UNKNOWN,
+			IsConjugated:  base != token.Surface,
+		}
+		a.fillReading(&tok)
+		if a.MiddleDot == MiddleDotJoin && tok.Reading == "" && strings.Contains(tok.Surface, middleDot) && isKatakanaWord(tok.Surface) {
+			// Kagome may already keep a name together; like a joined run, it reads as written.
+			tok.Reading, tok.Pronunciation = tok.Surface, tok.Surface
+		}
+		if a.MiddleDot == MiddleDotSplit && token.Surface != middleDot &&
+			strings.Contains(token.Surface, middleDot) && isKatakanaWord(token.Surface) {
+			result = append(result, splitMiddleDot(tok)...)
+			continue
+		}
+		result = append(result, tok)
 	}
 
+	if a.MoraSplitter != nil {
+		for i := range result {
+			if result[i].Reading != "" {
+				result[i].Morae = a.MoraSplitter(result[i].Reading)
+			}
+		}
+	}
 	return result, nil
 }
 
-// AnalyzeDocument splits the text into sentences and tokenizes each sentence.
-func (a *Analyzer) AnalyzeDocument(text string) ([]Sentence, error) {
-	rawSentences := splitSentences(text)
-	var result []Sentence
+// fillReading replaces a missing or guessed (unknown-word) reading of tok with the one
+// from a.Readings, if it has one.
+func (a *Analyzer) fillReading(tok *Token) {
+	if a.Readings == nil || (tok.Reading != "" && !tok.Unknown) {
+		return
+	}
+	if r, ok := a.Readings.Reading(tok.Surface); ok {
+		tok.Reading = r
+		tok.Pronunciation = r
+	}
+}
 
-	for _, s := range rawSentences {
-		if strings.TrimSpace(s) == "" {
+// isLatinWord reports whether s consists only of Latin letters and digits (ASCII or full-width).
+func isLatinWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) && !unicode.Is(unicode.Latin, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// latinRunEnd returns the index of the last token in the run of Latin words starting at
+// tokens[start], where consecutive words may be separated by spaces (but not newlines).
+func latinRunEnd(tokens []tokenizer.Token, start int) int {
+	end := start
+	for i := start + 1; i < len(tokens); i++ {
+		switch {
+		case isLatinWord(tokens[i].Surface):
+			end = i
+		case strings.Trim(tokens[i].Surface, " \t\u3000") == "":
+			// A space only joins words if another Latin word follows it.
+			continue
+		default:
+			return end
+		}
+	}
+	return end
+}
+
+// joinTokens merges a run of Latin tokens into one token covering the original text,
+// spaces included. The part of speech is taken from the first word.
+func joinTokens(text string, run []tokenizer.Token) Token {
+	first, last := run[0], run[len(run)-1]
+	surface := text[first.Position : last.Position+len(last.Surface)]
+	features := first.Features()
+	primaryPOS := ""
+	if len(features) > 0 {
+		primaryPOS = features[0]
+	}
+	unknown := false
+	for _, t := range run {
+		unknown = unknown || t.Class == tokenizer.UNKNOWN
+	}
+	return Token{
+		Surface:       surface,
+		BaseForm:      surface,
+		PartsOfSpeech: features,
+		PrimaryPOS:    primaryPOS,
+		Unknown:       unknown,
+	}
+}
+
+// joinMiddleDotRun merges a run of katakana words and ・ into one token like joinTokens.
+// Its reading concatenates the parts' readings, taking a part's surface when Kagome has
+// none, since katakana reads as written; MiddleDotSplit gives the parts the same readings.
+func joinMiddleDotRun(text string, run []tokenizer.Token) Token {
+	tok := joinTokens(text, run)
+	var reading, pronunciation strings.Builder
+	for _, t := range run {
+		features := t.Features()
+		r := t.Surface
+		if len(features) > 7 && features[7] != "*" {
+			r = features[7]
+		}
+		p := r
+		if len(features) > 8 && features[8] != "*" {
+			p = features[8]
+		}
+		reading.WriteString(r)
+		pronunciation.WriteString(p)
+	}
+	tok.Reading, tok.Pronunciation = reading.String(), pronunciation.String()
+	return tok
+}
+
+// isKatakanaWord reports whether s is a katakana word, possibly containing ・ and ー,
+// with at least one katakana letter.
+func isKatakanaWord(s string) bool {
+	letters := false
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Katakana, r):
+			letters = true
+		case r == 'ー' || r == '・':
+		default:
+			return false
+		}
+	}
+	return letters
+}
+
+// middleDotRunEnd returns the index of the last token in the run of katakana words
+// joined by ・ tokens starting at tokens[start]. A trailing ・ is not part of the run.
+func middleDotRunEnd(tokens []tokenizer.Token, start int) int {
+	end := start
+	for i := start + 1; i+1 < len(tokens); i += 2 {
+		if tokens[i].Surface != middleDot || !isKatakanaWord(tokens[i+1].Surface) {
+			break
+		}
+		end = i + 1
+	}
+	return end
+}
+
+// splitMiddleDot splits a katakana token on ・ into its words, which are their own
+// readings, with a symbol token for each ・.
+func splitMiddleDot(tok Token) []Token {
+	var out []Token
+	for i, part := range strings.Split(tok.Surface, middleDot) {
+		if i > 0 {
+			out = append(out, Token{
+				Surface:       middleDot,
+				BaseForm:      middleDot,
+				Reading:       middleDot,
+				Pronunciation: middleDot,
+				PartsOfSpeech: []string{"記号", "一般", "*", "*", "*", "*", middleDot, middleDot, middleDot},
+				PrimaryPOS:    "記号",
+			})
+		}
+		if part == "" {
 			continue
 		}
-		tokens, err := a.Analyze(s)
+		out = append(out, Token{
+			Surface:       part,
+			BaseForm:      part,
+			Reading:       part,
+			Pronunciation: part,
+			PartsOfSpeech: tok.PartsOfSpeech,
+			PrimaryPOS:    tok.PrimaryPOS,
+			Unknown:       tok.Unknown,
+		})
+	}
+	return out
+}
+
+// AnalyzeDocument splits the text into paragraphs on blank lines, splits each paragraph
+// into sentences and tokenizes each sentence.
+func (a *Analyzer) AnalyzeDocument(text string) ([]Sentence, error) {
+	var result []Sentence
+
+	for _, seg := range a.segments(text) {
+		tokens, err := a.Analyze(seg.text)
 		if err != nil {
 			return nil, err
 		}
 		result = append(result, Sentence{
-			Text:   s,
-			Tokens: tokens,
+			Text:           seg.text,
+			Tokens:         tokens,
+			ParagraphIndex: seg.paragraph,
 		})
 	}
 	return result, nil
 }
 
+// StreamDocument is like AnalyzeDocument but sends each tokenized sentence on out as soon
+// as it is ready instead of collecting them all. It closes out when done and returns
+// ctx.Err() if ctx is canceled before the whole text has been sent.
+func (a *Analyzer) StreamDocument(ctx context.Context, text string, out chan<- Sentence) error {
+	defer close(out)
+	for _, seg := range a.segments(text) {
+		tokens, err := a.Analyze(seg.text)
+		if err != nil {
+			return err
+		}
+		select {
+		case out <- Sentence{Text: seg.text, Tokens: tokens, ParagraphIndex: seg.paragraph}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// segment is one non-blank sentence of a document and the paragraph it belongs to.
+type segment struct {
+	text      string
+	paragraph int
+}
+
+// segments splits text into paragraphs, then each paragraph into sentences, dropping
+// whitespace-only sentences and those shorter than MinSentenceRunes.
+func (a *Analyzer) segments(text string) []segment {
+	var out []segment
+	paragraph := 0
+	for _, p := range splitParagraphs(text) {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		for _, s := range a.split(p) {
+			trimmed := strings.TrimSpace(s)
+			if trimmed == "" || utf8.RuneCountInString(trimmed) < a.MinSentenceRunes {
+				continue
+			}
+			out = append(out, segment{text: s, paragraph: paragraph})
+		}
+		paragraph++
+	}
+	return out
+}
+
+// reParagraphBreak matches a newline followed by one or more blank lines.
+var reParagraphBreak = regexp.MustCompile(`\n(?:[ \t\r\x{3000}]*\n)+`)
+
+// splitParagraphs cuts text after each run of blank lines. The pieces concatenate back to
+// text, and since every cut falls right after a newline the built-in sentence splitter
+// gives the same sentences whether it runs on the pieces or on the whole text.
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+	start := 0
+	for _, loc := range reParagraphBreak.FindAllStringIndex(text, -1) {
+		paragraphs = append(paragraphs, text[start:loc[1]])
+		start = loc[1]
+	}
+	if start < len(text) {
+		paragraphs = append(paragraphs, text[start:])
+	}
+	return paragraphs
+}
+
+// split applies the configured SentenceSplitter, falling back to splitSentences, then
+// enforces MaxSentenceRunes.
+func (a *Analyzer) split(text string) []string {
+	var sentences []string
+	switch {
+	case a.SentenceSplitter != nil:
+		sentences = a.SentenceSplitter(text)
+	case a.KeepQuotes:
+		sentences = splitSentencesKeepQuotes(text)
+	default:
+		sentences = splitSentences(text)
+	}
+	if a.MaxSentenceRunes <= 0 {
+		return sentences
+	}
+	var out []string
+	for _, s := range sentences {
+		out = append(out, splitLongSentence(s, a.MaxSentenceRunes)...)
+	}
+	return out
+}
+
+// splitLongSentence cuts s into pieces of at most limit runes. Each cut goes after the last
+// space, 、 or ， in the second half of the piece, else after the last hiragana followed by
+// another script there, else at exactly limit runes.
+func splitLongSentence(s string, limit int) []string {
+	if utf8.RuneCountInString(s) <= limit {
+		return []string{s}
+	}
+	runes := []rune(s)
+	var out []string
+	for len(runes) > limit {
+		cut := limit
+		if i := lastBoundary(runes[:limit+1], limit/2); i > 0 {
+			cut = i
+		}
+		out = append(out, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	if len(runes) > 0 {
+		out = append(out, string(runes))
+	}
+	return out
+}
+
+// lastBoundary returns the largest cut position in [from, len(window)-1] that falls after a
+// separator, or failing that after hiragana followed by a non-hiragana rune. It returns 0
+// if there is none. window includes one rune past the cut limit so the rune after a
+// candidate cut is known.
+func lastBoundary(window []rune, from int) int {
+	if from < 1 {
+		from = 1
+	}
+	for i := len(window) - 1; i >= from; i-- {
+		if r := window[i-1]; unicode.IsSpace(r) || r == '、' || r == '，' {
+			return i
+		}
+	}
+	for i := len(window) - 1; i >= from; i-- {
+		if unicode.Is(unicode.Hiragana, window[i-1]) && !unicode.Is(unicode.Hiragana, window[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
 func splitSentences(text string) []string {
+	return splitSentencesQuoted(text, false)
+}
+
+// splitSentencesKeepQuotes is splitSentences without splits inside 「」 or 『』.
+func splitSentencesKeepQuotes(text string) []string {
+	return splitSentencesQuoted(text, true)
+}
+
+func splitSentencesQuoted(text string, keepQuotes bool) []string {
 	var sentences []string
 	var current strings.Builder
+	depth := 0 // open quotes, when keepQuotes is set
 
 	for _, r := range text {
 		current.WriteRune(r)
+		switch r {
+		case '「', '『':
+			if keepQuotes {
+				depth++
+			}
+			continue
+		case '」', '』':
+			if depth > 0 {
+				depth--
+			}
+			continue
+		case '\n':
+			depth = 0
+		}
 		// Split on common Japanese sentence delimiters and newlines.
 		// 。(3002), ！(FF01), ？(FF1F)
-		if r == '。' || r == '！' || r == '？' || r == '\n' {
+		if (r == '。' || r == '！' || r == '？') && depth == 0 || r == '\n' {
 			sentences = append(sentences, current.String())
 			current.Reset()
 		}
@@ -137,20 +592,76 @@ func splitSentences(text string) []string {
 	return sentences
 }
 
+// Sentence length bounds (in runes) that ScoreSentence treats as comfortable to read.
+const (
+	idealMinSentenceRunes = 10
+	idealMaxSentenceRunes = 40
+)
+
+// ScoreSentence rates how useful text is as an example sentence for word. Higher is better.
+// It rewards sentences that contain the word and end with 。, and penalizes
+// sentences that are very short or very long.
+func ScoreSentence(text, word string) int {
+	trimmed := strings.TrimSpace(text)
+	score := 0
+	if word != "" && strings.Contains(trimmed, word) {
+		score += 10
+	}
+	if strings.HasSuffix(trimmed, "。") {
+		score += 3
+	}
+	n := utf8.RuneCountInString(trimmed)
+	switch {
+	case n < idealMinSentenceRunes:
+		score -= idealMinSentenceRunes - n
+	case n > idealMaxSentenceRunes:
+		score -= (n - idealMaxSentenceRunes + 4) / 5
+	}
+	return score
+}
+
 var (
 	// (?s) allows dot to match newlines
 	// (?i) makes it case-insensitive
-	reRT = regexp.MustCompile(`(?si)<rt\b[^>]*>.*?</rt>`)
+	reRT = regexp.MustCompile(`(?si)<rt\b[^>]*>(.*?)</rt>`)
 	reRP = regexp.MustCompile(`(?si)<rp\b[^>]*>.*?</rp>`)
 )
 
+// SanitizeRubyMode selects what SanitizeRubyWithMode does with ruby readings.
+type SanitizeRubyMode int
+
+const (
+	// RubyStrip drops readings entirely: <ruby>漢字<rt>かんじ</rt></ruby> → 漢字. It is the zero value.
+	RubyStrip SanitizeRubyMode = iota
+	// RubyBracket keeps readings inline in parentheses: → 漢字(かんじ).
+	RubyBracket
+)
+
 // SanitizeRuby removes ruby text (<rt>...</rt>) and ruby parentheses (<rp>...</rp>)
 // from HTML content. This is useful because readability extracts all text including
 // furigana, which leads to duplication (e.g. "漢字" becomes "漢字かんじ").
 // This function operates on bytes and is generally safe for Shift_JIS as well,
 // because <, >, r, t, p are ASCII and < is not a trailing byte in Shift_JIS.
 func SanitizeRuby(content []byte) []byte {
-	cleaned := reRT.ReplaceAll(content, []byte{})
-	cleaned = reRP.ReplaceAll(cleaned, []byte{})
-	return cleaned
+	return SanitizeRubyWithMode(content, RubyStrip)
+}
+
+// SanitizeRubyWithMode is SanitizeRuby with a choice of keeping the readings. <rp>
+// elements are always removed; in RubyBracket mode each non-empty <rt> becomes its
+// text in ASCII parentheses.
+func SanitizeRubyWithMode(content []byte, mode SanitizeRubyMode) []byte {
+	cleaned := reRP.ReplaceAll(content, []byte{})
+	if mode != RubyBracket {
+		return reRT.ReplaceAll(cleaned, []byte{})
+	}
+	return reRT.ReplaceAllFunc(cleaned, func(m []byte) []byte {
+		reading := bytes.TrimSpace(reRT.FindSubmatch(m)[1])
+		if len(reading) == 0 {
+			return nil
+		}
+		out := make([]byte, 0, len(reading)+2)
+		out = append(out, '(')
+		out = append(out, reading...)
+		return append(out, ')')
+	})
 }
@@ -2,10 +2,12 @@ package readerer
 
 import (
 	"bytes"
+	"context"
 	"net/url"
 	"os"
 	"strings"
 	"testing"
+	"unicode/utf8"
 
 	"github.com/go-shiori/go-readability"
 )
@@ -293,3 +295,460 @@ func TestSanitizeRuby(t *testing.T) {
 		})
 	}
 }
+
+func TestSanitizeRubyBracketMode(t *testing.T) {
+	tests := map[string]string{
+		"<ruby>漢字<rt>かんじ</rt></ruby>":                                    "<ruby>漢字(かんじ)</ruby>",
+		"<ruby>漢字<rp>(</rp><rt>かんじ</rt><rp>)</rp></ruby>":                "<ruby>漢字(かんじ)</ruby>",
+		"<ruby>私<rt>わたし</rt></ruby>は<ruby>猫<RT class='r'>ねこ</RT></ruby>": "<ruby>私(わたし)</ruby>は<ruby>猫(ねこ)</ruby>",
+		"<ruby>漢字<rt></rt></ruby>":                                       "<ruby>漢字</ruby>",
+	}
+	for input, want := range tests {
+		if got := string(SanitizeRubyWithMode([]byte(input), RubyBracket)); got != want {
+			t.Errorf("SanitizeRubyWithMode(%q) = %q, want %q", input, got, want)
+		}
+	}
+	if got := string(SanitizeRubyWithMode([]byte("<ruby>漢字<rt>かんじ</rt></ruby>"), RubyStrip)); got != "<ruby>漢字</ruby>" {
+		t.Errorf("strip mode = %q", got)
+	}
+}
+
+func TestScoreSentence(t *testing.T) {
+	good := ScoreSentence("今日は学校で大事なテストがありました。", "テスト")
+	if noPeriod := ScoreSentence("今日は学校で大事なテストがありました", "テスト"); noPeriod >= good {
+		t.Errorf("expected trailing 。 to score higher: %d >= %d", noPeriod, good)
+	}
+	if missing := ScoreSentence("今日は学校で大事な試験がありました。", "テスト"); missing >= good {
+		t.Errorf("expected sentence containing the word to score higher: %d >= %d", missing, good)
+	}
+	if short := ScoreSentence("テストだ。", "テスト"); short >= good {
+		t.Errorf("expected very short sentence to be penalized: %d >= %d", short, good)
+	}
+	long := strings.Repeat("長い文章が続きます、", 10) + "テストです。"
+	if s := ScoreSentence(long, "テスト"); s >= good {
+		t.Errorf("expected very long sentence to be penalized: %d >= %d", s, good)
+	}
+}
+
+func TestStreamDocumentMatchesAnalyzeDocument(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "猫が好きです。\n犬も好きですか？はい！"
+	want, err := analyzer.AnalyzeDocument(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make(chan Sentence)
+	errCh := make(chan error, 1)
+	go func() { errCh <- analyzer.StreamDocument(context.Background(), text, out) }()
+	var got []Sentence
+	for s := range out {
+		got = append(got, s)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("StreamDocument failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d sentences, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].Text != want[i].Text || len(got[i].Tokens) != len(want[i].Tokens) {
+			t.Errorf("sentence %d: got %q (%d tokens), want %q (%d tokens)", i, got[i].Text, len(got[i].Tokens), want[i].Text, len(want[i].Tokens))
+		}
+	}
+}
+
+func TestAnalyzeDocumentCustomSplitter(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	analyzer.SentenceSplitter = func(text string) []string {
+		calls++
+		return strings.Split(text, "|")
+	}
+
+	sentences, err := analyzer.AnalyzeDocument("猫が好き|犬も好き。まだ続く")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("expected custom splitter to be called once, got %d", calls)
+	}
+	if len(sentences) != 2 || sentences[0].Text != "猫が好き" || sentences[1].Text != "犬も好き。まだ続く" {
+		t.Fatalf("expected sentences from custom splitter, got %+v", sentences)
+	}
+}
+
+func TestTokenizerModeSplitsCompounds(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatalf("Failed to create analyzer: %v", err)
+	}
+	surfaces := func(mode TokenizerMode) []string {
+		analyzer.Mode = mode
+		tokens, err := analyzer.Analyze("関西国際空港")
+		if err != nil {
+			t.Fatalf("Analyze(%s) failed: %v", mode, err)
+		}
+		var out []string
+		for _, tok := range tokens {
+			out = append(out, tok.Surface)
+		}
+		return out
+	}
+
+	if got := surfaces(ModeNormal); len(got) != 1 || got[0] != "関西国際空港" {
+		t.Errorf("normal mode: expected single compound token, got %v", got)
+	}
+	if got := surfaces(ModeSearch); strings.Join(got, "/") != "関西/国際/空港" {
+		t.Errorf("search mode: expected 関西/国際/空港, got %v", got)
+	}
+
+	if _, err := ParseTokenizerMode("fast"); err == nil {
+		t.Error("expected error for unknown tokenizer mode")
+	}
+}
+
+func TestAnalyzeDocumentParagraphIndex(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := "\n猫が好き。犬も好き。\n\n　 \n鳥が飛ぶ。\n魚が泳ぐ。"
+
+	sentences, err := analyzer.AnalyzeDocument(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		text      string
+		paragraph int
+	}{
+		{"猫が好き。", 0},
+		{"犬も好き。", 0},
+		{"鳥が飛ぶ。", 1},
+		{"魚が泳ぐ。", 1},
+	}
+	if len(sentences) != len(want) {
+		t.Fatalf("expected %d sentences, got %+v", len(want), sentences)
+	}
+	for i, w := range want {
+		if sentences[i].Text != w.text || sentences[i].ParagraphIndex != w.paragraph {
+			t.Errorf("sentence %d = %q (paragraph %d), want %q (paragraph %d)",
+				i, sentences[i].Text, sentences[i].ParagraphIndex, w.text, w.paragraph)
+		}
+	}
+
+	if got := strings.Join(splitParagraphs(text), ""); got != text {
+		t.Errorf("paragraphs do not reassemble the text: %q", got)
+	}
+}
+
+func TestAnalyzePronunciation(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := analyzer.Analyze("私は学生です")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, tok := range tokens {
+		switch tok.Surface {
+		case "は":
+			found = true
+			if tok.Reading != "ハ" || tok.Pronunciation != "ワ" {
+				t.Errorf("particle は: reading %q, pronunciation %q; want ハ and ワ", tok.Reading, tok.Pronunciation)
+			}
+		case "学生":
+			if tok.Pronunciation != tok.Reading {
+				t.Errorf("学生: pronunciation %q should match reading %q", tok.Pronunciation, tok.Reading)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected a は token, got %+v", tokens)
+	}
+}
+
+func TestAnalyzeFlagsUnknownWords(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ズヴォグラッチ is made up, so Kagome has no entry for it.
+	tokens, err := analyzer.Analyze("ズヴォグラッチが好きです")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range tokens {
+		switch tok.Surface {
+		case "ズヴォグラッチ":
+			if !tok.Unknown {
+				t.Errorf("expected made-up word to be flagged unknown: %+v", tok)
+			}
+		default:
+			if tok.Unknown {
+				t.Errorf("expected dictionary word %q not to be flagged unknown", tok.Surface)
+			}
+		}
+	}
+	if len(tokens) == 0 || tokens[0].Surface != "ズヴォグラッチ" {
+		t.Fatalf("expected the made-up word as one token, got %+v", tokens)
+	}
+}
+
+func TestAnalyzeDocumentMinSentenceRunes(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer.MinSentenceRunes = 5
+	// ホーム is 3 runes but 9 bytes; 戻る is 2 runes.
+	sentences, err := analyzer.AnalyzeDocument("ホーム\n戻る\n今日はいい天気です。")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sentences) != 1 || sentences[0].Text != "今日はいい天気です。" {
+		var texts []string
+		for _, s := range sentences {
+			texts = append(texts, s.Text)
+		}
+		t.Fatalf("expected only the full sentence to be kept, got %q", texts)
+	}
+
+	analyzer.MinSentenceRunes = 0
+	if sentences, err = analyzer.AnalyzeDocument("ホーム\n戻る\n今日はいい天気です。"); err != nil || len(sentences) != 3 {
+		t.Fatalf("expected all 3 sentences with the filter off, got %d (%v)", len(sentences), err)
+	}
+}
+
+func TestAnalyzeJoinLatinWords(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	surfaces := func(text string) []string {
+		t.Helper()
+		tokens, err := analyzer.Analyze(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, tok := range tokens {
+			out = append(out, tok.Surface)
+		}
+		return out
+	}
+
+	if got := surfaces("New Yorkに行く"); strings.Join(got, "|") != "New|York|に|行く" {
+		t.Fatalf("expected words split by default, got %q", got)
+	}
+
+	analyzer.JoinLatinWords = true
+	cases := map[string]string{
+		"Go言語を学ぶ":           "Go|言語|を|学ぶ",
+		"New Yorkに行く":       "New York|に|行く",
+		"iPhone 15 Proを買った": "iPhone 15 Pro|を|買っ|た",
+		"New\nYork":         "New|York",
+	}
+	for text, want := range cases {
+		if got := surfaces(text); strings.Join(got, "|") != want {
+			t.Errorf("Analyze(%q) = %q, want %s", text, got, want)
+		}
+	}
+
+	tokens, err := analyzer.Analyze("New Yorkに行く")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok := tokens[0]; tok.BaseForm != "New York" || tok.PrimaryPOS != "名詞" || !tok.Unknown {
+		t.Errorf("unexpected joined token %+v", tok)
+	}
+}
+
+func TestAnalyzeMiddleDotNames(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	surfaces := func(text string) string {
+		t.Helper()
+		tokens, err := analyzer.Analyze(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, tok := range tokens {
+			out = append(out, tok.Surface)
+		}
+		return strings.Join(out, "|")
+	}
+
+	// Kagome segments these two names differently; the default keeps that.
+	const marie, leonardo = "マリー・アントワネットが好き", "レオナルド・ダ・ヴィンチの絵"
+	if got := surfaces(marie); got != "マリー・アントワネット|が|好き" {
+		t.Fatalf("unexpected default segmentation %q", got)
+	}
+	if got := surfaces(leonardo); got != "レオナルド|・|ダ・ヴィンチ|の|絵" {
+		t.Fatalf("unexpected default segmentation %q", got)
+	}
+
+	analyzer.MiddleDot = MiddleDotJoin
+	for text, want := range map[string]string{
+		marie:    "マリー・アントワネット|が|好き",
+		leonardo: "レオナルド・ダ・ヴィンチ|の|絵",
+		"東京・大阪":  "東京|・|大阪",
+	} {
+		if got := surfaces(text); got != want {
+			t.Errorf("join: Analyze(%q) = %q, want %s", text, got, want)
+		}
+	}
+	// Joined names read as written, like the parts MiddleDotSplit produces.
+	for text, want := range map[string]string{marie: "マリー・アントワネット", leonardo: "レオナルド・ダ・ヴィンチ"} {
+		tokens, err := analyzer.Analyze(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok := tokens[0]; tok.Reading != want || tok.Pronunciation != want {
+			t.Errorf("join: expected %q to read %q, got %+v", text, want, tok)
+		}
+	}
+
+	analyzer.MiddleDot = MiddleDotSplit
+	for text, want := range map[string]string{
+		marie:    "マリー|・|アントワネット|が|好き",
+		leonardo: "レオナルド|・|ダ|・|ヴィンチ|の|絵",
+	} {
+		if got := surfaces(text); got != want {
+			t.Errorf("split: Analyze(%q) = %q, want %s", text, got, want)
+		}
+	}
+	tokens, err := analyzer.Analyze(marie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok := tokens[2]; tok.BaseForm != "アントワネット" || tok.Reading != "アントワネット" || tok.PrimaryPOS != "名詞" {
+		t.Errorf("unexpected split word %+v", tok)
+	}
+	if tok := tokens[1]; tok.PrimaryPOS != "記号" {
+		t.Errorf("expected ・ to be a symbol, got %+v", tok)
+	}
+}
+
+func TestAnalyzeIsConjugated(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := analyzer.Analyze("猫が手紙を書いた")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string]Token{}
+	for _, tok := range tokens {
+		found[tok.Surface] = tok
+	}
+	if tok, ok := found["書い"]; !ok || tok.BaseForm != "書く" || !tok.IsConjugated {
+		t.Errorf("expected 書い (base 書く) to be conjugated, got %+v", tok)
+	}
+	if tok, ok := found["猫"]; !ok || tok.IsConjugated {
+		t.Errorf("expected 猫 not to be conjugated, got %+v", tok)
+	}
+}
+
+func TestAnalyzeDocumentKeepQuotes(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer.KeepQuotes = true
+	sentences, err := analyzer.AnalyzeDocument("「今日は晴れだ。明日は雨だ。」\n次の文。")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var texts []string
+	for _, s := range sentences {
+		texts = append(texts, strings.TrimSpace(s.Text))
+	}
+	if len(texts) != 2 || texts[0] != "「今日は晴れだ。明日は雨だ。」" || texts[1] != "次の文。" {
+		t.Fatalf("expected the quoted span to stay one sentence, got %q", texts)
+	}
+
+	analyzer.KeepQuotes = false
+	if sentences, err = analyzer.AnalyzeDocument("「今日は晴れだ。明日は雨だ。」"); err != nil || len(sentences) < 2 {
+		t.Fatalf("expected the default splitter to split inside the quote, got %d (%v)", len(sentences), err)
+	}
+}
+
+func TestAnalyzeMoraSplitter(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := analyzer.Analyze("東京")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Morae != nil {
+		t.Fatalf("expected no morae without a splitter, got %+v", tokens)
+	}
+
+	analyzer.MoraSplitter = func(reading string) []string { return strings.Split(reading, "") }
+	if tokens, err = analyzer.Analyze("東京"); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(tokens[0].Morae, "/"); got != "ト/ウ/キ/ョ/ウ" {
+		t.Errorf("expected the splitter to be applied to the reading トウキョウ, got %q", got)
+	}
+}
+
+func TestAnalyzeDocumentMaxSentenceRunes(t *testing.T) {
+	analyzer, err := NewAnalyzer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer.MaxSentenceRunes = 50
+	// 3000 runes with no sentence punctuation at all.
+	text := strings.Repeat("今日は天気がいいので散歩に行きます", 176)
+
+	sentences, err := analyzer.AnalyzeDocument(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sentences) < 3000/50 {
+		t.Fatalf("expected the text to be cut into at least %d pieces, got %d", 3000/50, len(sentences))
+	}
+	var joined strings.Builder
+	for _, s := range sentences {
+		if n := utf8.RuneCountInString(s.Text); n > 50 {
+			t.Fatalf("expected pieces of at most 50 runes, got %d: %q", n, s.Text)
+		}
+		joined.WriteString(s.Text)
+	}
+	if joined.String() != text {
+		t.Error("expected the pieces to concatenate back to the input")
+	}
+
+	// Ordinary sentences are left alone.
+	if sentences, err = analyzer.AnalyzeDocument("猫が好きです。"); err != nil || len(sentences) != 1 {
+		t.Fatalf("expected one short sentence, got %d (%v)", len(sentences), err)
+	}
+}
+
+func TestSplitLongSentencePrefersBoundaries(t *testing.T) {
+	got := splitLongSentence("あいうえおかきくけこ、さしすせそ", 12)
+	if len(got) != 2 || got[0] != "あいうえおかきくけこ、" {
+		t.Fatalf("expected a cut after 、, got %q", got)
+	}
+	got = splitLongSentence("ねこがいるカタカナカタカナ", 8)
+	if got[0] != "ねこがいる" {
+		t.Fatalf("expected a cut where hiragana meets katakana, got %q", got)
+	}
+}